@@ -2,6 +2,7 @@ package Application
 
 import (
 	"SCITEduTool/Application/manager"
+	"SCITEduTool/Application/module"
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
 	"encoding/json"
@@ -9,10 +10,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type application interface {
 	SetupWithConfig()
+	SetupDatabase()
+	ReadKeyring() (unit.KeyringConfig, error)
+	WriteKeyring(keyConf unit.KeyringConfig) error
 }
 
 type applicationImpl struct{}
@@ -21,17 +26,69 @@ var Application application = applicationImpl{}
 
 func (applicationImpl applicationImpl) SetupWithConfig() {
 	stdio.LogInfo("", "工科助手API启动中")
+	configDir := getConfigDir()
+	setupConfigDir(configDir)
+	setupServer(configDir)
+	setupMigration()
+	setupToken(configDir)
+	setupSubscription(configDir)
+	setupPrivateKey(configDir)
+	setupCalendar(configDir)
+	setupGradePoint(configDir)
+	setupUpstream(configDir)
+	setupNews(configDir)
+	setupEduSystem(configDir)
+	setupScheduler(configDir)
+	stdio.LogInfo("", "工科助手API配置读取完成，除校历外配置文件将在重启生效，祝您使用愉快~")
+}
+
+// SetupDatabase 仅读取数据库配置并连接数据库，不执行迁移，供命令行工具使用
+func (applicationImpl applicationImpl) SetupDatabase() {
+	configDir := getConfigDir()
+	setupConfigDir(configDir)
+	setupServer(configDir)
+}
+
+// ReadKeyring 读取 RSA 密钥环配置，配置文件不存在时返回空配置，供命令行工具使用
+func (applicationImpl applicationImpl) ReadKeyring() (unit.KeyringConfig, error) {
+	keyConf := unit.KeyringConfig{}
+	keyConfigContent, err := ioutil.ReadFile(getConfigDir() + "/key.json")
+	if os.IsNotExist(err) {
+		return keyConf, nil
+	}
+	if err != nil {
+		return keyConf, err
+	}
+	err = json.Unmarshal(keyConfigContent, &keyConf)
+	return keyConf, err
+}
+
+// WriteKeyring 写入 RSA 密钥环配置，先写入临时文件再替换，避免中断时损坏原有私钥
+func (applicationImpl applicationImpl) WriteKeyring(keyConf unit.KeyringConfig) error {
+	configDir := getConfigDir()
+	err := os.MkdirAll(configDir, 0755)
+	if err != nil {
+		return err
+	}
+	keyConfigContent, err := json.Marshal(keyConf)
+	if err != nil {
+		return err
+	}
+	path := configDir + "/key.json"
+	err = ioutil.WriteFile(path+".tmp", keyConfigContent, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func getConfigDir() string {
 	configDir, err := filepath.Abs(filepath.Dir(os.Args[0]))
 	if err != nil {
 		stdio.LogAssert("", "运行目录获取失败", err)
 		os.Exit(0)
 	}
-	configDir += "/config"
-	setupConfigDir(configDir)
-	setupServer(configDir)
-	setupToken(configDir)
-	setupPrivateKey(configDir)
-	stdio.LogInfo("", "工科助手API配置读取完成，配置文件将在重启生效，祝您使用愉快~")
+	return configDir + "/config"
 }
 
 func setupConfigDir(configDir string) {
@@ -73,18 +130,22 @@ func setupServer(configDir string) {
 		}
 		stdio.LocalDebug.SetupDebugConfig(sqlConf.Debug)
 		unit.InitSQL(sqlConf.Sql)
+		unit.InitTrustedProxies(sqlConf.TrustedProxies)
 		return
 	}
 	if os.IsNotExist(err) {
 		sqlConf := unit.ServerConfig{
 			Debug: false,
 			Sql: unit.SqlConfig{
+				Driver:   "mysql",
 				Username: "//输入您的数据库用户名",
 				Password: "//输入您的数据库密码",
 				IP:       "//请输入您的数据库IP",
 				Port:     "//请输入您的数据库监听端口",
 				DBName:   "//请输入您的数据库用于工科助手的数据簿名称",
+				Path:     "//使用 sqlite 时请输入数据库文件路径",
 			},
+			TrustedProxies: []string{"127.0.0.1", "::1"},
 		}
 		sqlConfigContent, err = json.Marshal(sqlConf)
 		err = ioutil.WriteFile(path, sqlConfigContent, 0644)
@@ -103,6 +164,17 @@ exit:
 	os.Exit(0)
 }
 
+func setupMigration() {
+	steps, errMessage := unit.MigrationUnit.Up(0, false)
+	if errMessage.HasInfo {
+		stdio.LogAssert("", "数据库迁移失败，请使用 migrate status 命令检查数据库版本", nil)
+		os.Exit(0)
+	}
+	if len(steps) == 0 {
+		stdio.LogVerbose("", "数据库结构已是最新版本")
+	}
+}
+
 func setupToken(configDir string) {
 	path := configDir + "/token.json"
 	_, err := os.Stat(path)
@@ -135,6 +207,16 @@ func setupToken(configDir string) {
 				"此配置修改可能会导致部分用户token失效，请谨慎修改。",
 			RefreshExpired: "//请输入refresh_token过期时间，单位秒，默认124416000（4年）。" +
 				"此配置修改可能会导致部分用户token失效，请谨慎修改。",
+			SigningKeys: []manager.TokenSigningKey{
+				{
+					Kid: "//请输入签名密钥ID，如 2024-01",
+					Secret: "//请输入签名密钥，建议设置为不少于32位的随机字符串。" +
+						"轮换时请新增密钥并修改active_kid，旧密钥需保留至其签发的令牌全部过期。",
+				},
+			},
+			ActiveKid: "//请输入当前用于签发令牌的签名密钥ID",
+			// 旧版令牌最迟在默认 refresh_token 有效期后停止使用
+			LegacyUntil: time.Now().Unix() + 124416000,
 		}
 		tokenConfigContent, err = json.Marshal(tokenConf)
 		err = ioutil.WriteFile(path, tokenConfigContent, 0644)
@@ -153,6 +235,50 @@ exit:
 	os.Exit(0)
 }
 
+func setupSubscription(configDir string) {
+	path := configDir + "/subscription.json"
+	_, err := os.Stat(path)
+	var file *os.File
+	var subscriptionConfigContent []byte
+	if err == nil {
+		file, err = os.OpenFile(path, os.O_RDONLY, 0644)
+		if err != nil {
+			stdio.LogAssert("", "订阅配置读取失败", err)
+			goto exit
+		}
+		subscriptionConfigContent, err = ioutil.ReadAll(io.Reader(file))
+		_ = file.Close()
+		subscriptionConf := manager.SubscriptionConfig{}
+		err = json.Unmarshal(subscriptionConfigContent, &subscriptionConf)
+		if err != nil {
+			stdio.LogAssert("", "订阅配置解析失败", err)
+			goto exit
+		}
+		manager.SignManager.InitSubscription(subscriptionConf)
+		return
+	}
+	if os.IsNotExist(err) {
+		subscriptionConf := manager.SubscriptionConfig{
+			Secret: "//请输入日历订阅链接的签名密钥，建议设置为不少于32位的随机字符串，请勿与应用密钥相同。" +
+				"此配置修改会导致所有已生成的订阅链接失效。",
+		}
+		subscriptionConfigContent, err = json.Marshal(subscriptionConf)
+		err = ioutil.WriteFile(path, subscriptionConfigContent, 0644)
+		if err == nil {
+			stdio.LogAssert("", "订阅配置文件不存在，已为您新建默认配置文件，请修改后重新启动", nil)
+		} else {
+			stdio.LogAssert("", "默认订阅配置文件创建失败", err)
+		}
+		goto exit
+	} else {
+		stdio.LogAssert("", "配置目录信息失败", err)
+	}
+	stdio.LogAssert("", "订阅配置获取失败", err)
+
+exit:
+	os.Exit(0)
+}
+
 func setupPrivateKey(configDir string) {
 	path := configDir + "/key.json"
 	_, err := os.Stat(path)
@@ -166,19 +292,20 @@ func setupPrivateKey(configDir string) {
 		}
 		keyConfigContent, err = ioutil.ReadAll(io.Reader(file))
 		_ = file.Close()
-		keyConf := unit.PrivateKey{}
+		keyConf := unit.KeyringConfig{}
 		err = json.Unmarshal(keyConfigContent, &keyConf)
 		if err != nil {
 			stdio.LogAssert("", "Token配置解析失败", err)
 			goto exit
 		}
-		unit.RSAStaticUnit.SetPrivateKey(keyConf)
+		unit.RSAStaticUnit.SetKeyring(keyConf)
 		return
 	}
 	if os.IsNotExist(err) {
-		tokenConf := unit.PrivateKey{
-			Content: "//请粘贴您经过base64编码后的RSA私钥，仅支持RSA/ECB/PKCS1Padding，请勿直接将私钥粘贴至此。" +
-				"此配置修改会导致所有用户登录状态失效，请谨慎修改，若需修改请提前清空数据表“user_token”。",
+		tokenConf := unit.KeyringConfig{
+			Content: "//请使用 key generate 命令生成密钥；若沿用旧版私钥，请粘贴您经过base64编码后的RSA私钥，" +
+				"仅支持RSA/ECB/PKCS1Padding，请勿直接将私钥粘贴至此。轮换密钥请使用 key generate，旧密钥需保留以解密已保存的密码。",
+			Keys: []unit.RSAKeyItem{},
 		}
 		keyConfigContent, err = json.Marshal(tokenConf)
 		err = ioutil.WriteFile(path, keyConfigContent, 0644)
@@ -196,3 +323,248 @@ func setupPrivateKey(configDir string) {
 exit:
 	os.Exit(0)
 }
+
+func setupCalendar(configDir string) {
+	path := configDir + "/calendar.json"
+	_, err := os.Stat(path)
+	var calendarConfigContent []byte
+	if err == nil {
+		if errMessage := manager.CalendarManager.InitCalendar(path); errMessage.HasInfo {
+			stdio.LogAssert("", "校历配置初始化失败", nil)
+			goto exit
+		}
+		return
+	}
+	if os.IsNotExist(err) {
+		calendarConf := manager.CalendarConfig{
+			Semesters: []manager.SemesterConfig{
+				{
+					SchoolYear: "2020-2021",
+					Semester:   2,
+					Start:      "2021-02-28",
+					Weeks:      20,
+					Holidays:   []manager.PeriodConfig{},
+					Evaluation: []manager.PeriodConfig{},
+				},
+			},
+		}
+		calendarConfigContent, err = json.MarshalIndent(calendarConf, "", "  ")
+		err = ioutil.WriteFile(path, calendarConfigContent, 0644)
+		if err != nil {
+			stdio.LogAssert("", "默认校历配置文件创建失败", err)
+			goto exit
+		}
+		stdio.LogInfo("", "校历配置文件不存在，已为您新建默认配置文件，修改后将自动重新加载")
+		if errMessage := manager.CalendarManager.InitCalendar(path); errMessage.HasInfo {
+			stdio.LogAssert("", "校历配置初始化失败", nil)
+			goto exit
+		}
+		return
+	} else {
+		stdio.LogAssert("", "配置目录信息失败", err)
+	}
+	stdio.LogAssert("", "校历配置获取失败", err)
+
+exit:
+	os.Exit(0)
+}
+
+func setupGradePoint(configDir string) {
+	path := configDir + "/gpa.json"
+	_, err := os.Stat(path)
+	var gradePointConfigContent []byte
+	if err == nil {
+		gradePointConfigContent, err = ioutil.ReadFile(path)
+		if err != nil {
+			stdio.LogAssert("", "绩点配置读取失败", err)
+			goto exit
+		}
+		gradePointConf := manager.GradePointConfig{}
+		err = json.Unmarshal(gradePointConfigContent, &gradePointConf)
+		if err != nil {
+			stdio.LogAssert("", "绩点配置解析失败", err)
+			goto exit
+		}
+		manager.GradePointManager.InitGradePoint(gradePointConf)
+		return
+	}
+	if os.IsNotExist(err) {
+		gradePointConf := manager.GetDefaultGradePointConfig()
+		gradePointConfigContent, err = json.MarshalIndent(gradePointConf, "", "  ")
+		err = ioutil.WriteFile(path, gradePointConfigContent, 0644)
+		if err != nil {
+			stdio.LogAssert("", "默认绩点配置文件创建失败", err)
+			goto exit
+		}
+		stdio.LogInfo("", "绩点配置文件不存在，已为您新建默认配置文件")
+		manager.GradePointManager.InitGradePoint(gradePointConf)
+		return
+	} else {
+		stdio.LogAssert("", "配置目录信息失败", err)
+	}
+	stdio.LogAssert("", "绩点配置获取失败", err)
+
+exit:
+	os.Exit(0)
+}
+
+func setupScheduler(configDir string) {
+	path := configDir + "/scheduler.json"
+	_, err := os.Stat(path)
+	var schedulerConfigContent []byte
+	if err == nil {
+		schedulerConfigContent, err = ioutil.ReadFile(path)
+		if err != nil {
+			stdio.LogAssert("", "定时刷新配置读取失败", err)
+			goto exit
+		}
+		schedulerConf := module.SchedulerConfig{}
+		err = json.Unmarshal(schedulerConfigContent, &schedulerConf)
+		if err != nil {
+			stdio.LogAssert("", "定时刷新配置解析失败", err)
+			goto exit
+		}
+		module.SchedulerModule.Start(schedulerConf)
+		return
+	}
+	if os.IsNotExist(err) {
+		schedulerConf := module.GetDefaultSchedulerConfig()
+		schedulerConfigContent, err = json.MarshalIndent(schedulerConf, "", "  ")
+		err = ioutil.WriteFile(path, schedulerConfigContent, 0644)
+		if err != nil {
+			stdio.LogAssert("", "默认定时刷新配置文件创建失败", err)
+			goto exit
+		}
+		stdio.LogInfo("", "定时刷新配置文件不存在，已为您新建默认配置文件")
+		module.SchedulerModule.Start(schedulerConf)
+		return
+	} else {
+		stdio.LogAssert("", "配置目录信息失败", err)
+	}
+	stdio.LogAssert("", "定时刷新配置获取失败", err)
+
+exit:
+	os.Exit(0)
+}
+
+func setupUpstream(configDir string) {
+	path := configDir + "/upstream.json"
+	_, err := os.Stat(path)
+	var upstreamConfigContent []byte
+	if err == nil {
+		upstreamConfigContent, err = ioutil.ReadFile(path)
+		if err != nil {
+			stdio.LogAssert("", "上游请求配置读取失败", err)
+			goto exit
+		}
+		upstreamConf := unit.UpstreamConfig{}
+		err = json.Unmarshal(upstreamConfigContent, &upstreamConf)
+		if err != nil {
+			stdio.LogAssert("", "上游请求配置解析失败", err)
+			goto exit
+		}
+		unit.InitUpstream(upstreamConf)
+		return
+	}
+	if os.IsNotExist(err) {
+		upstreamConf := unit.GetDefaultUpstreamConfig()
+		upstreamConfigContent, err = json.MarshalIndent(upstreamConf, "", "  ")
+		err = ioutil.WriteFile(path, upstreamConfigContent, 0644)
+		if err != nil {
+			stdio.LogAssert("", "默认上游请求配置文件创建失败", err)
+			goto exit
+		}
+		stdio.LogInfo("", "上游请求配置文件不存在，已为您新建默认配置文件")
+		unit.InitUpstream(upstreamConf)
+		return
+	} else {
+		stdio.LogAssert("", "配置目录信息失败", err)
+	}
+	stdio.LogAssert("", "上游请求配置获取失败", err)
+
+exit:
+	os.Exit(0)
+}
+
+func setupNews(configDir string) {
+	path := configDir + "/news.json"
+	_, err := os.Stat(path)
+	var newsConfigContent []byte
+	if err == nil {
+		newsConfigContent, err = ioutil.ReadFile(path)
+		if err != nil {
+			stdio.LogAssert("", "新闻配置读取失败", err)
+			goto exit
+		}
+		newsConf := module.NewsConfig{}
+		err = json.Unmarshal(newsConfigContent, &newsConf)
+		if err != nil {
+			stdio.LogAssert("", "新闻配置解析失败", err)
+			goto exit
+		}
+		module.NewsModule.InitNews(newsConf)
+		return
+	}
+	if os.IsNotExist(err) {
+		newsConf := module.GetDefaultNewsConfig()
+		newsConfigContent, err = json.MarshalIndent(newsConf, "", "  ")
+		err = ioutil.WriteFile(path, newsConfigContent, 0644)
+		if err != nil {
+			stdio.LogAssert("", "默认新闻配置文件创建失败", err)
+			goto exit
+		}
+		stdio.LogInfo("", "新闻配置文件不存在，已为您新建默认配置文件")
+		module.NewsModule.InitNews(newsConf)
+		return
+	} else {
+		stdio.LogAssert("", "配置目录信息失败", err)
+	}
+	stdio.LogAssert("", "新闻配置获取失败", err)
+
+exit:
+	os.Exit(0)
+}
+
+func setupEduSystem(configDir string) {
+	path := configDir + "/edu.json"
+	_, err := os.Stat(path)
+	var eduConfigContent []byte
+	eduConf := module.GetDefaultEduConfig()
+	if err == nil {
+		eduConfigContent, err = ioutil.ReadFile(path)
+		if err != nil {
+			stdio.LogAssert("", "教务系统配置读取失败", err)
+			goto exit
+		}
+		eduConf = module.EduConfig{}
+		err = json.Unmarshal(eduConfigContent, &eduConf)
+		if err != nil {
+			stdio.LogAssert("", "教务系统配置解析失败", err)
+			goto exit
+		}
+		goto init
+	}
+	if os.IsNotExist(err) {
+		eduConfigContent, err = json.MarshalIndent(eduConf, "", "  ")
+		err = ioutil.WriteFile(path, eduConfigContent, 0644)
+		if err != nil {
+			stdio.LogAssert("", "默认教务系统配置文件创建失败", err)
+			goto exit
+		}
+		stdio.LogInfo("", "教务系统配置文件不存在，已为您新建默认配置文件")
+		goto init
+	} else {
+		stdio.LogAssert("", "配置目录信息失败", err)
+	}
+	stdio.LogAssert("", "教务系统配置获取失败", err)
+	goto exit
+
+init:
+	if errMessage := module.InitEduSystem(eduConf); !errMessage.HasInfo {
+		return
+	}
+	stdio.LogAssert("", "教务系统初始化失败", nil)
+
+exit:
+	os.Exit(0)
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"SCITEduTool/Application/consts"
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/module"
 	"SCITEduTool/Application/stdio"
@@ -10,17 +9,19 @@ import (
 )
 
 func Achieve(w http.ResponseWriter, r *http.Request) {
+	current := manager.CalendarManager.Current()
 	base, errMessage := SetupAPI(w, r, map[string]string{
 		"access_token": "",
-		"semester":     strconv.Itoa(consts.Semester),
-		"year":         consts.SchoolYear,
+		"semester":     strconv.Itoa(current.Semester),
+		"year":         current.SchoolYear,
+		"refresh":      "0",
 	})
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
 	}
 	accessToken := base.GetParameter("access_token")
-	username, errMessage := manager.TokenUnit.Check(manager.Token{
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
 		AccessToken: accessToken,
 	})
 	if errMessage.HasInfo {
@@ -36,7 +37,9 @@ func Achieve(w http.ResponseWriter, r *http.Request) {
 	}
 	year := base.GetParameter("year")
 
-	achieve, errMessage := module.AchieveModule.Get(username, year, semester)
+	force := base.GetParameter("refresh") == "1"
+
+	achieve, errMessage := module.AchieveModule.Get(r.Context(), username, year, semester, force)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
@@ -51,3 +54,92 @@ func Achieve(w http.ResponseWriter, r *http.Request) {
 		Achieve: achieve,
 	})
 }
+
+func AchieveStats(w http.ResponseWriter, r *http.Request) {
+	current := manager.CalendarManager.Current()
+	base, errMessage := SetupAPI(w, r, map[string]string{
+		"access_token": "",
+		"semester":     strconv.Itoa(current.Semester),
+		"year":         current.SchoolYear,
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
+		AccessToken: base.GetParameter("access_token"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+
+	semester, err := strconv.Atoi(base.GetParameter("semester"))
+	if err != nil {
+		stdio.LogInfo(username, "学期参数解析失败")
+		base.OnStandardMessage(-500, "请求处理出错")
+		return
+	}
+	year := base.GetParameter("year")
+
+	stats, errMessage := module.AchieveModule.Stats(r.Context(), username, year, semester)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	base.OnObjectResult(struct {
+		Code    int                 `json:"code"`
+		Message string              `json:"message"`
+		Stats   module.AchieveStats `json:"stats"`
+	}{
+		Code:    200,
+		Message: "success.",
+		Stats:   stats,
+	})
+}
+
+func AchieveUpdates(w http.ResponseWriter, r *http.Request) {
+	base, errMessage := SetupAPI(w, r, map[string]string{
+		"access_token": "",
+		"since":        "0",
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
+		AccessToken: base.GetParameter("access_token"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+
+	since, err := strconv.ParseInt(base.GetParameter("since"), 10, 64)
+	if err != nil || since < 0 {
+		stdio.LogInfo(username, "游标参数解析失败")
+		base.OnStandardMessage(-500, "请求处理出错")
+		return
+	}
+
+	updates, errMessage := module.AchieveModule.Updates(r.Context(), username, since)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	cursor := since
+	if len(updates) > 0 {
+		cursor = updates[len(updates)-1].ID
+	}
+	base.OnObjectResult(struct {
+		Code    int                     `json:"code"`
+		Message string                  `json:"message"`
+		Updates []manager.AchieveUpdate `json:"updates"`
+		Cursor  int64                   `json:"cursor"`
+	}{
+		Code:    200,
+		Message: "success.",
+		Updates: updates,
+		Cursor:  cursor,
+	})
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"context"
 	"net/http"
 	"strconv"
 	"time"
@@ -10,6 +12,7 @@ import (
 
 type BaseAPI struct {
 	parameter         map[string]string
+	Context           context.Context
 	OnObjectResult    func(object interface{})
 	OnStandardMessage func(code int, message string)
 	GetParameter      func(key string) string
@@ -36,6 +39,7 @@ func SetupAPI(w http.ResponseWriter, r *http.Request, parameterGet map[string]st
 	}
 	//ENDIF
 	return BaseAPI{
+		Context: r.Context(),
 		OnObjectResult: func(object interface{}) {
 			stdio.OnObjectResult(w, object)
 		},
@@ -53,3 +57,21 @@ func SetupAPI(w http.ResponseWriter, r *http.Request, parameterGet map[string]st
 		},
 	}, stdio.GetEmptyErrorMessage()
 }
+
+// getDeviceInfo 读取签发令牌的设备信息，设备名称由 device 参数提供，
+// IP 仅在请求来自 server.json 中配置的可信代理时读取代理写入的请求头，仅用于展示
+func getDeviceInfo(r *http.Request, base BaseAPI) manager.DeviceInfo {
+	device := []rune(base.GetParameter("device"))
+	if len(device) > 100 {
+		device = device[:100]
+	}
+	ip := unit.ClientIP(r)
+	if len(ip) > 45 {
+		ip = ip[:45]
+	}
+	return manager.DeviceInfo{
+		Name:     string(device),
+		Platform: base.GetParameter("platform"),
+		IP:       ip,
+	}
+}
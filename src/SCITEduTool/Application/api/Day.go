@@ -1,7 +1,7 @@
 package api
 
 import (
-	"SCITEduTool/Application/consts"
+	"SCITEduTool/Application/manager"
 	base2 "SCITEduTool/Application/stdio"
 	"net/http"
 	"time"
@@ -13,7 +13,8 @@ func Day(w http.ResponseWriter, r *http.Request) {
 		errMessage.OutMessage(w)
 		return
 	}
-	timeStart := time.Date(2021, 2, 28, 0, 0, 0, 0, time.Local)
+	current := manager.CalendarManager.Current()
+	timeStart := current.Start
 	timeNow := time.Now()
 
 	left := timeNow.Sub(timeStart)
@@ -32,8 +33,8 @@ func Day(w http.ResponseWriter, r *http.Request) {
 		Message:    "success.",
 		DayCount:   int(left.Hours() / 24),
 		Date:       timeStart.In(time.Local).Format("2006/01/02"),
-		Semester:   consts.Semester,
-		SchoolYear: consts.SchoolYear,
-		Evaluation: consts.Evaluation,
+		Semester:   current.Semester,
+		SchoolYear: current.SchoolYear,
+		Evaluation: manager.CalendarManager.IsEvaluation(current, timeNow),
 	})
 }
@@ -3,19 +3,24 @@ package api
 import (
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/module"
+	"SCITEduTool/Application/stdio"
 	"net/http"
+	"strconv"
 )
 
 func Exam(w http.ResponseWriter, r *http.Request) {
+	current := manager.CalendarManager.Current()
 	base, errMessage := SetupAPI(w, r, map[string]string{
 		"access_token": "",
+		"semester":     strconv.Itoa(current.Semester),
+		"year":         current.SchoolYear,
 	})
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
 	}
 	accessToken := base.GetParameter("access_token")
-	username, errMessage := manager.TokenUnit.Check(manager.Token{
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
 		AccessToken: accessToken,
 	})
 	if errMessage.HasInfo {
@@ -23,19 +28,85 @@ func Exam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exam, errMessage := module.ExamModule.Get(username)
+	semester, err := strconv.Atoi(base.GetParameter("semester"))
+	if err != nil {
+		stdio.LogInfo(username, "学期参数解析失败")
+		base.OnStandardMessage(-500, "请求处理出错")
+		return
+	}
+	year := base.GetParameter("year")
+
+	exam, errMessage := module.ExamModule.Get(r.Context(), username, year, semester)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
 	}
 
 	base.OnObjectResult(struct {
-		Code    int               `json:"code"`
-		Message string            `json:"message"`
-		Exam    []module.ExamItem `json:"exam"`
+		Code    int                `json:"code"`
+		Message string             `json:"message"`
+		Exam    []manager.ExamItem `json:"exam"`
 	}{
 		Code:    200,
 		Message: "success.",
 		Exam:    exam.Object,
 	})
 }
+
+func ExamICSLink(w http.ResponseWriter, r *http.Request) {
+	current := manager.CalendarManager.Current()
+	base, errMessage := SetupAPI(w, r, map[string]string{
+		"access_token": "",
+		"semester":     strconv.Itoa(current.Semester),
+		"year":         current.SchoolYear,
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
+		AccessToken: base.GetParameter("access_token"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	link, errMessage := getSubscriptionLink(r.Context(), "/exam/ics", map[string]string{
+		"uid":      username,
+		"year":     base.GetParameter("year"),
+		"semester": base.GetParameter("semester"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	base.OnObjectResult(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Link    string `json:"link"`
+	}{
+		Code:    200,
+		Message: "success.",
+		Link:    link,
+	})
+}
+
+func ExamICS(w http.ResponseWriter, r *http.Request) {
+	parameter, errMessage := setupSubscription(r, "/exam/ics", "uid", "year", "semester")
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	semester, err := strconv.Atoi(parameter["semester"])
+	if err != nil {
+		stdio.GetErrorMessage(-500, "无效的参数").OutMessage(w)
+		return
+	}
+
+	calendar, errMessage := module.ExamModule.Calendar(r.Context(), parameter["uid"], parameter["year"], semester)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	onCalendarResult(w, r, "exam.ics", calendar)
+}
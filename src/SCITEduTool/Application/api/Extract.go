@@ -1,7 +1,6 @@
 package api
 
 import (
-	"SCITEduTool/Application/consts"
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/module"
 	base2 "SCITEduTool/Application/stdio"
@@ -15,11 +14,12 @@ import (
 )
 
 func Extract(w http.ResponseWriter, r *http.Request) {
+	current := manager.CalendarManager.Current()
 	base, errMessage := SetupAPI(w, r, map[string]string{
 		"access_token": "",
 		"task_id":      "-1",
-		"semester":     strconv.Itoa(consts.Semester),
-		"year":         consts.SchoolYear,
+		"semester":     strconv.Itoa(current.Semester),
+		"year":         current.SchoolYear,
 		"tasks":        "",
 	})
 	if errMessage.HasInfo {
@@ -27,7 +27,7 @@ func Extract(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	accessToken := base.GetParameter("access_token")
-	username, errMessage := manager.TokenUnit.Check(manager.Token{
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
 		AccessToken: accessToken,
 	})
 	if errMessage.HasInfo {
@@ -61,7 +61,7 @@ func Extract(w http.ResponseWriter, r *http.Request) {
 		base.OnStandardMessage(-500, "请勿一次性提交过量的任务")
 		return
 	}
-	info, errMessage := module.InfoModule.Get(username)
+	info, errMessage := module.InfoModule.Get(r.Context(), username)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
@@ -69,7 +69,7 @@ func Extract(w http.ResponseWriter, r *http.Request) {
 	if info.Identify != 1 && info.Level < 80 {
 		base.OnStandardMessage(-403, "权限不足")
 	}
-	status, errMessage := module.AchieveModule.ExtractPrepare(module.ExtractTaskInfo{
+	status, errMessage := module.AchieveModule.ExtractPrepare(r.Context(), module.ExtractTaskInfo{
 		Username:    username,
 		TaskID:      taskId,
 		Year:        base.GetParameter("year"),
@@ -101,7 +101,7 @@ func ExtractDone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	accessToken := base.GetParameter("access_token")
-	username, errMessage := manager.TokenUnit.Check(manager.Token{
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
 		AccessToken: accessToken,
 	})
 	if errMessage.HasInfo {
@@ -113,7 +113,7 @@ func ExtractDone(w http.ResponseWriter, r *http.Request) {
 		base.OnStandardMessage(-500, "无效的参数")
 		return
 	}
-	info, errMessage := module.InfoModule.Get(username)
+	info, errMessage := module.InfoModule.Get(r.Context(), username)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
@@ -145,10 +145,14 @@ func ExtractDone(w http.ResponseWriter, r *http.Request) {
 		base.OnStandardMessage(201, "已提交任务，请稍后再次访问")
 		return
 	}
-	link := module.AchieveModule.ExtractLink(module.ExtractTaskInfo{
+	link, errMessage := module.AchieveModule.ExtractLink(r.Context(), module.ExtractTaskInfo{
 		Username: username,
 		TaskID:   taskId,
 	}, accessToken)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
 	base.OnObjectResult(struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
@@ -171,7 +175,7 @@ func ExtractDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	accessToken := base.GetParameter("access_token")
-	username, errMessage := manager.TokenUnit.Check(manager.Token{
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
 		AccessToken: accessToken,
 	})
 	if errMessage.HasInfo {
@@ -183,7 +187,7 @@ func ExtractDownload(w http.ResponseWriter, r *http.Request) {
 		base.OnStandardMessage(-500, "无效的参数")
 		return
 	}
-	info, errMessage := module.InfoModule.Get(username)
+	info, errMessage := module.InfoModule.Get(r.Context(), username)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"SCITEduTool/Application/unit"
 	"encoding/json"
 	"math/rand"
 	"net/http"
@@ -8,23 +9,32 @@ import (
 )
 
 type KeyResult struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Hash    string `json:"hash"`
-	Key     string `json:"key"`
+	Code        int      `json:"code"`
+	Message     string   `json:"message"`
+	Hash        string   `json:"hash"`
+	Kid         string   `json:"kid"`
+	Key         string   `json:"key"`
+	ExchangeKey string   `json:"exchange_key,omitempty"`
+	Algorithms  []string `json:"algorithms"`
 }
 
+// GetKey 下发当前启用的 RSA 公钥与 X25519 公钥，客户端登录时需将 kid、加密方式 enc 与加密后的密码一同提交。
+// hash 仅用于 pkcs1 加密方式的旧版明文格式，新版加密方式使用 unit.Envelope
 func GetKey(w http.ResponseWriter, _ *http.Request) {
+	kid, key := unit.RSAStaticUnit.GetPublicKey()
 	keyResult := KeyResult{
 		Code:    200,
 		Message: "success.",
 		Hash:    GetRandomString(8),
-		Key: "-----BEGIN PUBLIC KEY-----\n" +
-			"MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCmBCWNtxeofYkH1e9GXKgszj4E\n" +
-			"cJojNvlesPDM201q+fiVf2X4SWPNjdduRS19dq9Koq4Dz0ul3xV6E3ydCHl88qSa\n" +
-			"94fDGZa24UueYVYE0ytYuJcOu164GlIfu48Rir0NXA2BfoQxMcSpMmLJt20rSg+E\n" +
-			"oP24zaj3ti78b1zJEwIDAQAB\n" +
-			"-----END PUBLIC KEY-----",
+		Kid:     kid,
+		Key:     key,
+	}
+	keyResult.ExchangeKey = unit.RSAStaticUnit.GetExchangeKey()
+	for _, scheme := range unit.CipherSchemes {
+		if scheme == unit.CipherHybrid && keyResult.ExchangeKey == "" {
+			continue
+		}
+		keyResult.Algorithms = append(keyResult.Algorithms, scheme)
 	}
 	result, _ := json.Marshal(keyResult)
 	_, _ = w.Write(result)
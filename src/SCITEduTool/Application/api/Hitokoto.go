@@ -11,7 +11,7 @@ func Hitokoto(w http.ResponseWriter, r *http.Request) {
 		errMessage.OutMessage(w)
 		return
 	}
-	item, errMessage := module.HitokotoModule.Get()
+	item, errMessage := module.HitokotoModule.Get(r.Context())
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
@@ -33,32 +33,32 @@ func Info(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	accessToken := base.GetParameter("access_token")
-	username, err := manager.TokenUnit.Check(manager.Token{
+	username, err := manager.TokenUnit.Check(r.Context(), manager.Token{
 		AccessToken: accessToken,
 	})
 	if err.HasInfo {
 		err.OutMessage(w)
 		return
 	}
-	info, err := module.InfoModule.Get(username)
+	info, err := module.InfoModule.Get(r.Context(), username)
 	if err.HasInfo {
 		err.OutMessage(w)
 		return
 	}
 	var ChartManager = manager.ChartManager
-	faculty, err := ChartManager.GetFacultyName(info.Faculty)
-	if err.HasInfo {
-		err.OutMessage(w)
+	faculty, chartErr := ChartManager.GetFacultyName(r.Context(), info.Faculty)
+	if chartErr != nil {
+		manager.ErrorMessage(username, chartErr).OutMessage(w)
 		return
 	}
-	specialty, err := ChartManager.GetSpecialtyName(info.Faculty, info.Specialty)
-	if err.HasInfo {
-		err.OutMessage(w)
+	specialty, chartErr := ChartManager.GetSpecialtyName(r.Context(), info.Faculty, info.Specialty)
+	if chartErr != nil {
+		manager.ErrorMessage(username, chartErr).OutMessage(w)
 		return
 	}
-	class, err := ChartManager.GetClassName(info.Faculty, info.Specialty, info.Class)
-	if err.HasInfo {
-		err.OutMessage(w)
+	class, chartErr := ChartManager.GetClassName(r.Context(), info.Faculty, info.Specialty, info.Class)
+	if chartErr != nil {
+		manager.ErrorMessage(username, chartErr).OutMessage(w)
 		return
 	}
 
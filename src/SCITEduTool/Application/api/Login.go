@@ -4,6 +4,7 @@ import (
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/module"
 	base2 "SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
 	"net/http"
 )
 
@@ -18,6 +19,9 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	base, err := SetupAPI(w, r, map[string]string{
 		"username": "",
 		"password": "",
+		"device":   "unknown",
+		"kid":      unit.LegacyKid,
+		"enc":      unit.CipherPKCS1,
 	})
 	if err.HasInfo {
 		err.OutMessage(w)
@@ -26,8 +30,21 @@ func Login(w http.ResponseWriter, r *http.Request) {
 
 	username := base.GetParameter("username")
 	password := base.GetParameter("password")
+	//IF !DEBUG
+	cipherText := unit.CipherText{
+		Scheme: base.GetParameter("enc"),
+		Kid:    base.GetParameter("kid"),
+		Data:   password,
+	}
+	_, err = unit.RSAStaticUnit.OpenEnvelope(cipherText, true)
+	if err.HasInfo {
+		err.OutMessage(w)
+		return
+	}
+	password = cipherText.String()
+	//ENDIF
 	base2.LogDebug(username, password, nil)
-	_, _, err = module.SessionModule.Get(username, password)
+	_, _, err = module.SessionModule.Get(r.Context(), username, password)
 	if err.HasInfo {
 		if err.Code == -401 {
 			base.OnObjectResult(struct {
@@ -42,7 +59,7 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	token, err := manager.TokenUnit.Build(username, password)
+	token, err := manager.TokenUnit.Build(r.Context(), username, getDeviceInfo(r, base))
 	if err.HasInfo {
 		goto outError
 	}
@@ -5,13 +5,20 @@ import (
 	"SCITEduTool/Application/module"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func News(w http.ResponseWriter, r *http.Request) {
 	base, errMessage := SetupAPI(w, r, map[string]string{
 		"action": "",
 		"tid":    "-1",
+		"nid":    "-1",
 		"page":   "-1",
+		"cursor": "-",
+		"size":   "0",
+		"q":      "-",
+		"start":  "-",
+		"end":    "-",
 	})
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
@@ -25,8 +32,12 @@ func News(w http.ResponseWriter, r *http.Request) {
 	case "list":
 		List(w, base)
 		break
-	//case "get":
-	//	break
+	case "get":
+		Get(w, base)
+		break
+	case "search":
+		Search(w, base)
+		break
 	default:
 		Headline(w, base)
 		break
@@ -34,7 +45,7 @@ func News(w http.ResponseWriter, r *http.Request) {
 }
 
 func Type(w http.ResponseWriter, api BaseAPI) {
-	charts, errMessage := module.NewsModule.GetTypeChart()
+	charts, errMessage := module.NewsModule.GetTypeChart(api.Context)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
@@ -66,11 +77,115 @@ func List(w http.ResponseWriter, api BaseAPI) {
 	}
 	pagePre := api.GetParameter("page")
 	page, err := strconv.Atoi(pagePre)
-	if err != nil || page < 0 {
+	if err != nil {
+		api.OnStandardMessage(-500, "无效的参数")
+		return
+	}
+	size, err := strconv.Atoi(api.GetParameter("size"))
+	if err != nil || size < 0 {
+		api.OnStandardMessage(-500, "无效的参数")
+		return
+	}
+	cursor := api.GetParameter("cursor")
+	if cursor == "-" {
+		// 未携带游标时按 page 分页
+		cursor = ""
+	}
+	news, cursor, hasNext, errMessage := module.NewsModule.ListNewsByType(api.Context, tid, cursor, page, size)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	api.OnObjectResult(struct {
+		Code    int                `json:"code"`
+		Message string             `json:"message"`
+		HasNext bool               `json:"has_next"`
+		Cursor  string             `json:"cursor"`
+		News    []manager.NewsItem `json:"news"`
+	}{
+		Code:    200,
+		Message: "success.",
+		HasNext: hasNext,
+		Cursor:  cursor,
+		News:    news,
+	})
+}
+
+func Get(w http.ResponseWriter, api BaseAPI) {
+	tid, err := strconv.Atoi(api.GetParameter("tid"))
+	if err != nil || tid < 0 {
+		api.OnStandardMessage(-500, "无效的参数")
+		return
+	}
+	nid, err := strconv.Atoi(api.GetParameter("nid"))
+	if err != nil || nid < 0 {
 		api.OnStandardMessage(-500, "无效的参数")
 		return
 	}
-	news, hasNext, errMessage := module.NewsModule.ListNewsByType(tid, page)
+	item, errMessage := module.NewsModule.GetNewsById(api.Context, tid, nid)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	content, errMessage := module.NewsModule.GetNewsContent(api.Context, tid, nid)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	api.OnObjectResult(struct {
+		Code        int                      `json:"code"`
+		Message     string                   `json:"message"`
+		News        manager.NewsItem         `json:"news"`
+		Content     string                   `json:"content"`
+		Images      []string                 `json:"images"`
+		Attachments []manager.NewsAttachment `json:"attachments"`
+	}{
+		Code:        200,
+		Message:     "success.",
+		News:        item,
+		Content:     content.Content,
+		Images:      content.Images,
+		Attachments: content.Attachments,
+	})
+}
+
+func Search(w http.ResponseWriter, api BaseAPI) {
+	tid, err := strconv.Atoi(api.GetParameter("tid"))
+	if err != nil {
+		api.OnStandardMessage(-500, "无效的参数")
+		return
+	}
+	page, err := strconv.Atoi(api.GetParameter("page"))
+	if err != nil {
+		api.OnStandardMessage(-500, "无效的参数")
+		return
+	}
+	if page < 0 {
+		page = 0
+	}
+	keyword := api.GetParameter("q")
+	if keyword == "-" {
+		api.OnStandardMessage(-417, "参数缺失")
+		return
+	}
+	start := api.GetParameter("start")
+	if start == "-" {
+		start = ""
+	}
+	end := api.GetParameter("end")
+	if end == "-" {
+		end = ""
+	}
+	for _, date := range []string{start, end} {
+		if date == "" {
+			continue
+		}
+		if _, err = time.Parse("2006-01-02", date); err != nil {
+			api.OnStandardMessage(-500, "无效的参数")
+			return
+		}
+	}
+	news, hasNext, errMessage := module.NewsModule.SearchNews(api.Context, keyword, tid, start, end, page)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
@@ -89,7 +204,7 @@ func List(w http.ResponseWriter, api BaseAPI) {
 }
 
 func Headline(w http.ResponseWriter, api BaseAPI) {
-	headlines, errMessage := module.NewsModule.GetHeadlines()
+	headlines, errMessage := module.NewsModule.GetHeadlines(api.Context)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
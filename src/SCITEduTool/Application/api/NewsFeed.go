@@ -0,0 +1,71 @@
+package api
+
+import (
+	"SCITEduTool/Application/module"
+	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NewsFeed 提供新闻订阅源，无需签名。/news/feed/{tid}.xml 为 RSS 2.0，/news/feed/{tid}.atom 为 Atom 1.0，
+// tid 为 headlines 时输出头条新闻
+func NewsFeed(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/news/feed/")
+	format := "rss"
+	if strings.HasSuffix(name, ".atom") {
+		format = "atom"
+		name = strings.TrimSuffix(name, ".atom")
+	} else if strings.HasSuffix(name, ".xml") {
+		name = strings.TrimSuffix(name, ".xml")
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+	if r.FormValue("format") == "atom" {
+		format = "atom"
+	}
+
+	var feed unit.Feed
+	var errMessage stdio.MessagedError
+	if name == "headlines" {
+		feed, errMessage = module.NewsModule.GetHeadlinesFeed(r.Context())
+	} else {
+		tid, err := strconv.Atoi(name)
+		if err != nil || tid < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		feed, errMessage = module.NewsModule.GetFeed(r.Context(), tid)
+	}
+	if errMessage.HasInfo {
+		if errMessage.Code == -404 {
+			http.NotFound(w, r)
+		} else {
+			errMessage.OutMessage(w)
+		}
+		return
+	}
+	feed.SelfLink = getBaseLink() + strings.TrimPrefix(r.URL.Path, "/api")
+
+	var content string
+	var err error
+	contentType := "application/rss+xml; charset=utf-8"
+	if format == "atom" {
+		content, err = unit.BuildAtom(feed)
+		contentType = "application/atom+xml; charset=utf-8"
+	} else {
+		content, err = unit.BuildRSS(feed)
+	}
+	if err != nil {
+		stdio.LogError("", "订阅源生成失败", err)
+		stdio.GetErrorMessage(-500, "请求处理出错").OutMessage(w)
+		return
+	}
+	if checkETag(w, r, "public, max-age=600", content) {
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	stdio.OnStringResult(w, content)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"SCITEduTool/Application/manager"
+	"SCITEduTool/Application/module"
+	"net/http"
+)
+
+func SchedulerStatus(w http.ResponseWriter, r *http.Request) {
+	base, errMessage := SetupAPI(w, r, map[string]string{
+		"access_token": "",
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
+		AccessToken: base.GetParameter("access_token"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	info, errMessage := module.InfoModule.Get(r.Context(), username)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	if info.Level < 80 {
+		base.OnStandardMessage(-403, "权限不足")
+		return
+	}
+	base.OnObjectResult(struct {
+		Code    int                         `json:"code"`
+		Message string                      `json:"message"`
+		Jobs    []module.SchedulerJobStatus `json:"jobs"`
+	}{
+		Code:    200,
+		Message: "success.",
+		Jobs:    module.SchedulerModule.Status(),
+	})
+}
@@ -14,19 +14,19 @@ func Springboard(w http.ResponseWriter, r *http.Request) {
 		err.OutMessage(w)
 		return
 	}
-	username, err := manager.TokenUnit.Check(manager.Token{
+	username, err := manager.TokenUnit.Check(r.Context(), manager.Token{
 		AccessToken: base.GetParameter("access_token"),
 	})
 	if err.HasInfo {
 		err.OutMessage(w)
 		return
 	}
-	password, err := manager.SessionManager.GetUserPassword(username, "")
-	if err.HasInfo {
-		err.OutMessage(w)
+	password, passwordErr := manager.SessionManager.GetUserPassword(r.Context(), username, "")
+	if passwordErr != nil {
+		manager.ErrorMessage(username, passwordErr).OutMessage(w)
 		return
 	}
-	location, _, err := module.SessionModule.GetVerifyLocation(username, password)
+	location, _, err := module.SessionModule.GetVerifyLocation(r.Context(), username, password)
 	if err.HasInfo {
 		err.OutMessage(w)
 		return
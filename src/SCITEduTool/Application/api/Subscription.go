@@ -0,0 +1,117 @@
+package api
+
+import (
+	"SCITEduTool/Application/manager"
+	"SCITEduTool/Application/stdio"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// getSubscriptionLink 生成带订阅签名的链接，订阅签名不含 ts，供无法自行签名的客户端（如日历应用）长期使用。
+// 链接携带用户当前的订阅版本 v，用户撤销订阅后版本递增，旧链接随即失效
+func getSubscriptionLink(ctx context.Context, path string, parameter map[string]string) (string, stdio.MessagedError) {
+	version, err := manager.SignManager.GetSubscriptionVersion(ctx, parameter["uid"])
+	if err != nil {
+		return "", manager.ErrorMessage(parameter["uid"], err)
+	}
+	parameter["v"] = strconv.Itoa(version)
+	sign := manager.SignManager.GetSubscriptionSign(path, parameter)
+	if sign == "" {
+		return "", stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	query := url.Values{}
+	for key, value := range parameter {
+		query.Set(key, value)
+	}
+	query.Set("sign", sign)
+	return getBaseLink() + path + "?" + query.Encode(), stdio.GetEmptyErrorMessage()
+}
+
+func getBaseLink() string {
+	link := ""
+	//IF DEBUG
+	//	link = "http://localhost:8000/api"
+	//ELSE IF
+	link = "https://tool.eclass.sgpublic.xyz/api"
+	//ENDIF
+	return link
+}
+
+// setupSubscription 读取订阅参数并校验订阅签名，path 为订阅的资源路径，需与生成链接时一致
+func setupSubscription(r *http.Request, path string, keys ...string) (map[string]string, stdio.MessagedError) {
+	parameter := make(map[string]string)
+	for _, key := range append(keys, "v") {
+		value := r.FormValue(key)
+		if value == "" {
+			stdio.LogInfo("", "{"+r.RequestURI+"} 请求参数缺失："+key)
+			return nil, stdio.GetErrorMessage(-417, "参数缺失")
+		}
+		parameter[key] = value
+	}
+	sign := manager.SignManager.GetSubscriptionSign(path, parameter)
+	if sign == "" || !hmac.Equal([]byte(sign), []byte(r.FormValue("sign"))) {
+		return nil, stdio.GetErrorMessage(-403, "服务签名错误")
+	}
+	version, err := manager.SignManager.GetSubscriptionVersion(r.Context(), parameter["uid"])
+	if err != nil {
+		return nil, manager.ErrorMessage(parameter["uid"], err)
+	}
+	if parameter["v"] != strconv.Itoa(version) {
+		stdio.LogInfo(parameter["uid"], "订阅链接已撤销")
+		return nil, stdio.GetErrorMessage(-403, "订阅链接已失效")
+	}
+	return parameter, stdio.GetEmptyErrorMessage()
+}
+
+// SubscriptionRevoke 撤销当前用户已生成的全部日历订阅链接
+func SubscriptionRevoke(w http.ResponseWriter, r *http.Request) {
+	base, errMessage := SetupAPI(w, r, map[string]string{
+		"access_token": "",
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
+		AccessToken: base.GetParameter("access_token"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	err := manager.SignManager.RevokeSubscription(r.Context(), username)
+	if err != nil {
+		manager.ErrorMessage(username, err).OutMessage(w)
+		return
+	}
+	stdio.LogInfo(username, "日历订阅链接已撤销")
+	base.OnStandardMessage(200, "success.")
+}
+
+// checkETag 设置缓存相关响应头，若客户端缓存仍有效则返回 304 并返回 true
+func checkETag(w http.ResponseWriter, r *http.Request, cacheControl string, content string) bool {
+	h := md5.New()
+	h.Write([]byte(content))
+	etag := "\"" + hex.EncodeToString(h.Sum(nil)) + "\""
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+func onCalendarResult(w http.ResponseWriter, r *http.Request, filename string, calendar string) {
+	if checkETag(w, r, "private, max-age=3600", calendar) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline;filename="+filename)
+	stdio.OnStringResult(w, calendar)
+}
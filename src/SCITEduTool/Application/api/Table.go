@@ -1,7 +1,6 @@
 package api
 
 import (
-	"SCITEduTool/Application/consts"
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/module"
 	base2 "SCITEduTool/Application/stdio"
@@ -10,17 +9,18 @@ import (
 )
 
 func Table(w http.ResponseWriter, r *http.Request) {
+	current := manager.CalendarManager.Current()
 	base, errMessage := SetupAPI(w, r, map[string]string{
 		"access_token": "",
-		"semester":     strconv.Itoa(consts.Semester),
-		"year":         consts.SchoolYear,
+		"semester":     strconv.Itoa(current.Semester),
+		"year":         current.SchoolYear,
 	})
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
 	}
 	accessToken := base.GetParameter("access_token")
-	username, errMessage := manager.TokenUnit.Check(manager.Token{
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
 		AccessToken: accessToken,
 	})
 	if errMessage.HasInfo {
@@ -36,7 +36,7 @@ func Table(w http.ResponseWriter, r *http.Request) {
 	}
 	year := base.GetParameter("year")
 
-	table, errMessage := module.TableModule.Get(username, year, semester)
+	table, errMessage := module.TableModule.Get(r.Context(), username, year, semester)
 	if errMessage.HasInfo {
 		errMessage.OutMessage(w)
 		return
@@ -51,3 +51,62 @@ func Table(w http.ResponseWriter, r *http.Request) {
 		Table:   table.Object,
 	})
 }
+
+func TableICSLink(w http.ResponseWriter, r *http.Request) {
+	current := manager.CalendarManager.Current()
+	base, errMessage := SetupAPI(w, r, map[string]string{
+		"access_token": "",
+		"semester":     strconv.Itoa(current.Semester),
+		"year":         current.SchoolYear,
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	username, errMessage := manager.TokenUnit.Check(r.Context(), manager.Token{
+		AccessToken: base.GetParameter("access_token"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	link, errMessage := getSubscriptionLink(r.Context(), "/table/ics", map[string]string{
+		"uid":      username,
+		"year":     base.GetParameter("year"),
+		"semester": base.GetParameter("semester"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	base.OnObjectResult(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Link    string `json:"link"`
+	}{
+		Code:    200,
+		Message: "success.",
+		Link:    link,
+	})
+}
+
+// TableICS 供日历应用订阅，日历应用无法携带 ts 参数，故使用不含 ts 的订阅签名校验
+func TableICS(w http.ResponseWriter, r *http.Request) {
+	parameter, errMessage := setupSubscription(r, "/table/ics", "uid", "year", "semester")
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	semester, err := strconv.Atoi(parameter["semester"])
+	if err != nil {
+		base2.GetErrorMessage(-500, "无效的参数").OutMessage(w)
+		return
+	}
+
+	calendar, errMessage := module.TableModule.Calendar(r.Context(), parameter["uid"], parameter["year"], semester)
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	onCalendarResult(w, r, "table.ics", calendar)
+}
@@ -9,28 +9,16 @@ func Token(w http.ResponseWriter, r *http.Request) {
 	base, errMessage := SetupAPI(w, r, map[string]string{
 		"access_token":  "",
 		"refresh_token": "",
+		"device":        "unknown",
 	})
 	var token manager.Token
-	var password string
-	var refresh string
-	var username string
 	if errMessage.HasInfo {
 		goto ouError
 	}
-	refresh = base.GetParameter("refresh_token")
-	username, errMessage = manager.TokenUnit.Check(manager.Token{
+	token, errMessage = manager.TokenUnit.Refresh(r.Context(), manager.Token{
 		AccessToken:  base.GetParameter("access_token"),
-		RefreshToken: refresh,
-	})
-	if errMessage.HasInfo {
-		goto ouError
-	}
-
-	password, errMessage = manager.SessionManager.GetUserPassword(username, "")
-	if errMessage.HasInfo {
-		goto ouError
-	}
-	token, errMessage = manager.TokenUnit.Build(username, password)
+		RefreshToken: base.GetParameter("refresh_token"),
+	}, getDeviceInfo(r, base))
 	if errMessage.HasInfo {
 		goto ouError
 	}
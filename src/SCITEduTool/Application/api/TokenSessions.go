@@ -0,0 +1,68 @@
+package api
+
+import (
+	"SCITEduTool/Application/manager"
+	"net/http"
+)
+
+type TokenSessionOut struct {
+	manager.DeviceSessionItem
+	Current bool `json:"current"`
+}
+
+// TokenSessions 列出当前用户的设备会话，action 为 revoke 时撤销 session_id 对应的会话
+func TokenSessions(w http.ResponseWriter, r *http.Request) {
+	base, errMessage := SetupAPI(w, r, map[string]string{
+		"access_token": "",
+		"action":       "list",
+		"session_id":   "-",
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	claims, errMessage := manager.TokenUnit.CheckClaims(r.Context(), manager.Token{
+		AccessToken: base.GetParameter("access_token"),
+	})
+	if errMessage.HasInfo {
+		errMessage.OutMessage(w)
+		return
+	}
+	username := claims.Subject
+	switch base.GetParameter("action") {
+	case "list":
+		break
+	case "revoke":
+		errMessage = manager.TokenUnit.RevokeSession(r.Context(), username, base.GetParameter("session_id"))
+		if errMessage.HasInfo {
+			errMessage.OutMessage(w)
+			return
+		}
+		base.OnStandardMessage(200, "success.")
+		return
+	default:
+		base.OnStandardMessage(-500, "无效的参数")
+		return
+	}
+	sessions, err := manager.DeviceSessionManager.ListByUser(r.Context(), username)
+	if err != nil {
+		manager.ErrorMessage(username, err).OutMessage(w)
+		return
+	}
+	sessionsOut := make([]TokenSessionOut, 0, len(sessions))
+	for _, item := range sessions {
+		sessionsOut = append(sessionsOut, TokenSessionOut{
+			DeviceSessionItem: item,
+			Current:           item.SessionId == claims.SessionID,
+		})
+	}
+	base.OnObjectResult(struct {
+		Code     int               `json:"code"`
+		Message  string            `json:"message"`
+		Sessions []TokenSessionOut `json:"sessions"`
+	}{
+		Code:     200,
+		Message:  "success.",
+		Sessions: sessionsOut,
+	})
+}
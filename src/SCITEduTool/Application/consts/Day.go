@@ -1,7 +0,0 @@
-package consts
-
-const (
-	Semester   = 2
-	SchoolYear = "2020-2021"
-	Evaluation = false
-)
@@ -0,0 +1,10 @@
+package consts
+
+// LessonTime 为课表中每个大节（对应 TableObject 的第二维）的上下课时间，格式为 [时, 分]
+var LessonTime = [5][2][2]int{
+	{{8, 20}, {10, 0}},
+	{{10, 20}, {12, 0}},
+	{{14, 0}, {15, 40}},
+	{{16, 0}, {17, 40}},
+	{{19, 0}, {20, 40}},
+}
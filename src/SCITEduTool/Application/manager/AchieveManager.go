@@ -3,6 +3,9 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
+	"database/sql"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"os"
@@ -14,14 +17,18 @@ import (
 	"github.com/xuri/excelize"
 )
 
-type achieveManager interface {
-	Get(username string, year string, semester int) (TableExtractInfo, stdio.MessagedError)
-	Update(username string, info UserInfo, year string, semester int, achieve AchieveObject) stdio.MessagedError
+type AchieveRepository interface {
+	Get(ctx context.Context, username string, year string, semester int) (TableExtractInfo, error)
+	Update(ctx context.Context, username string, info UserInfo, year string, semester int, achieve AchieveObject) error
+	GetAchieve(ctx context.Context, username string, info UserInfo, year string, semester int) (AchieveContent, error)
+	UpdateAchieve(ctx context.Context, username string, info UserInfo, year string, semester int, achieve AchieveObject) error
+	InsertUpdate(ctx context.Context, username string, year string, semester int, item CurrentAchieveItem) error
+	GetUpdates(ctx context.Context, username string, since int64, limit int) ([]AchieveUpdate, error)
 }
 
 type achieveManagerImpl struct{}
 
-var AchieveManager achieveManager = achieveManagerImpl{}
+var AchieveManager AchieveRepository = achieveManagerImpl{}
 
 type CurrentAchieveItem struct {
 	Name       string `json:"name"`
@@ -48,94 +55,78 @@ type AchieveContent struct {
 	Achieve string
 }
 
+// AchieveUpdate 新出成绩事件，ID 自增，可作为轮询游标
+type AchieveUpdate struct {
+	ID         int64  `json:"id"`
+	SchoolYear string `json:"year"`
+	Semester   int    `json:"semester"`
+	Name       string `json:"name"`
+	Mark       string `json:"mark"`
+	Credit     string `json:"credit"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// achieveColumnContent 为 student_achieve 中 a_content_XX 列存储的内容
+type achieveColumnContent struct {
+	Expired int64         `json:"expired"`
+	Achieve AchieveObject `json:"achieve"`
+}
+
 type TableExtractInfo struct {
 	Name      string
 	Data      []byte
 	ErrorInfo string
 }
 
-func (achieveManagerImpl achieveManagerImpl) Get(username string, year string, semester int) (TableExtractInfo, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+// Get 读取导出用的成绩单文件，出错时 ErrorInfo 为展示给导出任务的原因
+func (achieveManagerImpl achieveManagerImpl) Get(ctx context.Context, username string, year string, semester int) (TableExtractInfo, error) {
+	state, err := unit.Prepare(ctx, "select `u_faculty`,`u_specialty`,`u_class`,`u_name` from `user_info` where `u_id`=?")
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
 		return TableExtractInfo{
 			ErrorInfo: "服务器内部错误",
-		}, stdio.GetErrorMessage(-500, "请求处理出错")
+		}, wrapError("用户信息查询失败", err)
 	}
-	state, err := tx.Prepare("select `u_faculty`,`u_specialty`,`u_class`,`u_name` from `user_info` where `u_id`=?")
-	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
+	info := UserInfo{}
+	name := sql.NullString{}
+	err = state.QueryRowContext(ctx, username).Scan(&info.Faculty, &info.Specialty, &info.Class, &name)
+	if err == sql.ErrNoRows {
 		return TableExtractInfo{
-			ErrorInfo: "服务器内部错误",
-		}, stdio.GetErrorMessage(-500, "请求处理出错")
+			ErrorInfo: "用户信息不存在",
+		}, ErrNotFound
 	}
-	rows := state.QueryRow(username)
-	info := UserInfo{}
-	err = rows.Scan(&info.Faculty, &info.Specialty, &info.Class, &info.Name)
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库执行指令失败", err)
 		return TableExtractInfo{
-			ErrorInfo: "用户信息不存在",
-		}, stdio.GetErrorMessage(-500, "请求处理失败")
+			ErrorInfo: "服务器内部错误",
+		}, wrapError("用户信息查询失败", err)
 	}
+	info.Name = name.String
 	baseDir, err := filepath.Abs(filepath.Dir(os.Args[0]))
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "运行目录获取失败", err)
 		return TableExtractInfo{
 			ErrorInfo: "服务器内部错误",
-		}, stdio.GetErrorMessage(-500, "请求处理失败")
-	}
-	tx.Commit()
-	baseDir += "/achieve"
-	tableDir := baseDir + "/user/" + year + "/" + strconv.Itoa(semester) + "/" + strconv.Itoa(info.Faculty) + "/" + strconv.Itoa(info.Specialty) +
-		"/" + strconv.Itoa(info.Class) + "/"
-	_, err = os.Stat(tableDir)
-	if err == nil {
-		goto readFile
+		}, wrapError("运行目录获取失败", err)
 	}
+	tablePath := baseDir + "/achieve/user/" + year + "/" + strconv.Itoa(semester) + "/" + strconv.Itoa(info.Faculty) +
+		"/" + strconv.Itoa(info.Specialty) + "/" + strconv.Itoa(info.Class) + "/" + username + ".xlsx"
+	table, err := ioutil.ReadFile(tablePath)
 	if os.IsNotExist(err) {
-		stdio.LogWarn("", "成绩单目录不存在", err)
-	} else {
-		stdio.LogWarn("", "成绩单目录信息失败", err)
-	}
-	return TableExtractInfo{
-		ErrorInfo: "目标成绩单不存在",
-	}, stdio.GetErrorMessage(-500, "请求处理失败")
-
-readFile:
-	_, err = os.Stat(tableDir + username + ".xlsx")
-	if err == nil {
-		goto returnResult
-	}
-	if os.IsNotExist(err) {
-		stdio.LogWarn("", "成绩单目录信息失败", err)
-	} else {
-		stdio.LogWarn("", "成绩单目录信息失败", err)
-	}
-	return TableExtractInfo{
-		ErrorInfo: "目标成绩单不存在",
-	}, stdio.GetErrorMessage(-500, "请求处理失败")
-
-returnResult:
-	table, err := ioutil.ReadFile(tableDir + username + ".xlsx")
-	if err == nil {
 		return TableExtractInfo{
-			Name: info.Name,
-			Data: table,
-		}, stdio.GetEmptyErrorMessage()
-	} else {
-		stdio.LogError("", "成绩单读取失败", err)
+			ErrorInfo: "目标成绩单不存在",
+		}, ErrNotFound
+	}
+	if err != nil {
 		return TableExtractInfo{
 			ErrorInfo: "服务器内部错误",
-		}, stdio.GetErrorMessage(-500, "请求处理失败")
+		}, wrapError("成绩单读取失败", err)
 	}
+	return TableExtractInfo{
+		Name: info.Name,
+		Data: table,
+	}, nil
 }
 
-func (achieveManagerImpl achieveManagerImpl) Update(username string, info UserInfo, year string, semester int,
-	achieve AchieveObject) stdio.MessagedError {
+func (achieveManagerImpl achieveManagerImpl) Update(ctx context.Context, username string, info UserInfo, year string, semester int,
+	achieve AchieveObject) error {
 	var sample *os.File
 	var target *os.File
 	var table *excelize.File
@@ -145,8 +136,7 @@ func (achieveManagerImpl achieveManagerImpl) Update(username string, info UserIn
 
 	baseDir, err := filepath.Abs(filepath.Dir(os.Args[0]))
 	if err != nil {
-		stdio.LogWarn("", "运行目录获取失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("运行目录获取失败", err)
 	}
 	baseDir += "/achieve"
 	tableDir := baseDir + "/user/" + year
@@ -166,11 +156,9 @@ func (achieveManagerImpl achieveManagerImpl) Update(username string, info UserIn
 			stdio.LogInfo("", "成绩单目录创建成功")
 			goto startExtract
 		}
-		stdio.LogWarn("", "成绩单目录创建失败", err)
-	} else {
-		stdio.LogWarn("", "成绩单目录信息失败", err)
+		return wrapError("成绩单目录创建失败", err)
 	}
-	return stdio.GetErrorMessage(-500, "请求处理失败")
+	return wrapError("成绩单目录信息获取失败", err)
 
 checkExist:
 	_, err = os.Stat(tableDir + username + ".xlsx")
@@ -180,22 +168,19 @@ checkExist:
 	if os.IsNotExist(err) {
 		goto startExtract
 	} else {
-		stdio.LogWarn("", "成绩单目录信息失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("成绩单目录信息失败", err)
 	}
 
 checkExtractTime:
 	table, err = excelize.OpenFile(tableDir + username + ".xlsx")
 	if err != nil {
-		stdio.LogWarn("", "成绩单文件读取失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("成绩单文件读取失败", err)
 	}
 
 	creatTimePreString, err = table.GetCellValue("achieve", "D4")
 	_ = table.Save()
 	if err != nil {
-		stdio.LogWarn("", "成绩单文件解析失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("成绩单文件解析失败", err)
 	}
 
 	creatTimePre = strings.Split(creatTimePreString, "：")
@@ -209,7 +194,7 @@ checkExtractTime:
 		goto startExtract
 	}
 	if creatTime.Sub(time.Now()).Hours() < 2 {
-		return stdio.GetEmptyErrorMessage()
+		return nil
 	}
 
 startExtract:
@@ -221,39 +206,35 @@ startExtract:
 	sample, err = os.Open(baseDir + "/achieve_sample.xlsx")
 	//}
 	if err != nil {
-		stdio.LogWarn("", "成绩单样本文件获取失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("成绩单样本文件获取失败", err)
 	}
 	//IF DEBUG
 	//	tableDir = strings.ReplaceAll(tableDir, "/", "\\")
 	//ENDIF
 	target, err = os.OpenFile(tableDir, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
-		stdio.LogWarn("", "成绩单创建失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("成绩单创建失败", err)
 	}
 	_, err = io.Copy(target, sample)
 	sample.Close()
 	target.Close()
 	if err != nil {
-		stdio.LogWarn("", "成绩单文件复制失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("成绩单文件复制失败", err)
 	}
 	table, err = excelize.OpenFile(tableDir)
 	if err != nil {
-		stdio.LogWarn("", "成绩单文件解析失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("成绩单文件解析失败", err)
 	}
-	faculty, errMessage := ChartManager.GetFacultyName(info.Faculty)
-	if errMessage.HasInfo {
+	faculty, err := ChartManager.GetFacultyName(ctx, info.Faculty)
+	if err != nil || faculty == "" {
 		faculty = strconv.Itoa(info.Faculty)
 	}
-	specialty, errMessage := ChartManager.GetSpecialtyName(info.Faculty, info.Specialty)
-	if errMessage.HasInfo {
+	specialty, err := ChartManager.GetSpecialtyName(ctx, info.Faculty, info.Specialty)
+	if err != nil || specialty == "" {
 		specialty = strconv.Itoa(info.Specialty)
 	}
-	class, errMessage := ChartManager.GetClassName(info.Faculty, info.Specialty, info.Class)
-	if errMessage.HasInfo {
+	class, err := ChartManager.GetClassName(ctx, info.Faculty, info.Specialty, info.Class)
+	if err != nil || class == "" {
 		class = strconv.Itoa(info.Class)
 	}
 	_ = table.SetCellStr("achieve", "A2", "姓名："+info.Name)
@@ -316,9 +297,145 @@ startExtract:
 	}
 	err = table.Save()
 	if err != nil {
-		stdio.LogWarn("", "成绩单文件保存失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理失败")
+		return wrapError("成绩单文件保存失败", err)
 	} else {
-		return stdio.GetEmptyErrorMessage()
+		return nil
+	}
+}
+
+// getAchieveColumn 按入学年级计算学期对应的 a_content_XX 列，第一学年第一学期为 a_content_01，
+// 学年查询、全部成绩查询及超出 12 个学期的查询不缓存
+func getAchieveColumn(info UserInfo, year string, semester int) (string, bool) {
+	if semester != 1 && semester != 2 {
+		return "", false
+	}
+	yearStart, err := strconv.Atoi(strings.Split(year, "-")[0])
+	if err != nil {
+		return "", false
+	}
+	index := (yearStart-info.Grade)*2 + semester
+	if index < 1 || index > 12 {
+		return "", false
+	}
+	column := strconv.Itoa(index)
+	if index < 10 {
+		column = "0" + column
+	}
+	return "a_content_" + column, true
+}
+
+func (achieveManagerImpl achieveManagerImpl) GetAchieve(ctx context.Context, username string, info UserInfo, year string, semester int) (AchieveContent, error) {
+	column, ok := getAchieveColumn(info, year, semester)
+	if !ok {
+		return AchieveContent{}, nil
+	}
+	state, err := unit.Prepare(ctx, "select `"+column+"` from `student_achieve` where `u_id`=?")
+	if err != nil {
+		return AchieveContent{}, wrapError("成绩缓存查询失败", err)
+	}
+	content := sql.NullString{}
+	err = state.QueryRowContext(ctx, username).Scan(&content)
+	if err == sql.ErrNoRows {
+		return AchieveContent{}, nil
+	}
+	if err != nil {
+		return AchieveContent{}, wrapError("成绩缓存查询失败", err)
+	}
+	if !content.Valid || content.String == "" {
+		return AchieveContent{}, nil
+	}
+	columnContent := achieveColumnContent{}
+	err = json.Unmarshal([]byte(content.String), &columnContent)
+	if err != nil {
+		stdio.LogWarn(username, "成绩缓存数据解析失败", err)
+		return AchieveContent{}, nil
+	}
+	achieve, _ := json.Marshal(columnContent.Achieve)
+	return AchieveContent{
+		Exist:   true,
+		Expired: columnContent.Expired < time.Now().Unix(),
+		Achieve: string(achieve),
+	}, nil
+}
+
+func (achieveManagerImpl achieveManagerImpl) UpdateAchieve(ctx context.Context, username string, info UserInfo, year string, semester int,
+	achieve AchieveObject) error {
+	column, ok := getAchieveColumn(info, year, semester)
+	if !ok {
+		return nil
+	}
+	content, err := json.Marshal(achieveColumnContent{
+		Expired: time.Now().Unix() + 86400,
+		Achieve: achieve,
+	})
+	if err != nil {
+		return err
+	}
+	exist, err := SessionManager.CheckUserExist(ctx, username, "student_achieve")
+	if err != nil {
+		return err
+	}
+	var state *sql.Stmt
+	if !exist {
+		state, err = unit.Prepare(ctx, "insert into `student_achieve` (`u_faculty`, `u_specialty`, `u_class`, `u_grade`, `"+column+"`, `u_id`) values (?, ?, ?, ?, ?, ?)")
+	} else {
+		state, err = unit.Prepare(ctx, "update `student_achieve` set `u_faculty`=?, `u_specialty`=?, `u_class`=?, `u_grade`=?, `"+column+"`=? where `u_id`=?")
+	}
+	if err != nil {
+		return wrapError("成绩缓存写入失败", err)
+	}
+	_, err = state.ExecContext(ctx, info.Faculty, info.Specialty, info.Class, info.Grade, string(content), username)
+	if err != nil {
+		return wrapError("成绩缓存写入失败", err)
+	}
+	if !exist {
+		stdio.LogVerbose(username, "向数据库插入新成绩数据成功")
+	} else {
+		stdio.LogVerbose(username, "向数据库更新成绩数据成功")
+	}
+	return nil
+}
+
+func (achieveManagerImpl achieveManagerImpl) InsertUpdate(ctx context.Context, username string, year string, semester int, item CurrentAchieveItem) error {
+	state, err := unit.Prepare(ctx, unit.Dialect.InsertIgnore()+" `achieve_update` (`u_id`, `a_school_year`, `a_semester`, `a_name`, `a_mark`, `a_credit`, `a_create_time`) values (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return wrapError("新出成绩写入失败", err)
+	}
+	result, err := state.ExecContext(ctx, username, year, semester, item.Name, item.Mark, item.Credit, time.Now().Unix())
+	if err != nil {
+		return wrapError("新出成绩写入失败", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		// 并发刷新时同一课程可能已被记录
+		return nil
+	}
+	stdio.LogInfo(username, "新出成绩："+item.Name)
+	return nil
+}
+
+// GetUpdates 返回 ID 大于 since 的新出成绩事件，按 ID 升序排列
+func (achieveManagerImpl achieveManagerImpl) GetUpdates(ctx context.Context, username string, since int64, limit int) ([]AchieveUpdate, error) {
+	state, err := unit.Prepare(ctx, "select `a_id`,`a_school_year`,`a_semester`,`a_name`,`a_mark`,`a_credit`,`a_create_time` from `achieve_update` where `u_id`=? and `a_id`>? order by `a_id` limit ?")
+	if err != nil {
+		return nil, wrapError("新出成绩查询失败", err)
+	}
+	rows, err := state.QueryContext(ctx, username, since, limit)
+	if err != nil {
+		return nil, wrapError("新出成绩查询失败", err)
+	}
+	defer rows.Close()
+	updates := make([]AchieveUpdate, 0)
+	for rows.Next() {
+		update := AchieveUpdate{}
+		err = rows.Scan(&update.ID, &update.SchoolYear, &update.Semester, &update.Name,
+			&update.Mark, &update.Credit, &update.CreateTime)
+		if err != nil {
+			return nil, wrapError("新出成绩查询失败", err)
+		}
+		updates = append(updates, update)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError("新出成绩查询失败", err)
 	}
+	return updates, nil
 }
@@ -0,0 +1,241 @@
+package manager
+
+import (
+	"SCITEduTool/Application/stdio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type calendarManager interface {
+	InitCalendar(path string) stdio.MessagedError
+	Current() SemesterItem
+	Find(year string, semester int) (SemesterItem, bool)
+	WeekStart(item SemesterItem) time.Time
+	InWeeks(item SemesterItem, week int) bool
+	IsHoliday(item SemesterItem, date time.Time) bool
+	IsEvaluation(item SemesterItem, date time.Time) bool
+}
+
+type calendarManagerImpl struct{}
+
+var CalendarManager calendarManager = calendarManagerImpl{}
+
+type CalendarConfig struct {
+	Semesters []SemesterConfig `json:"semesters"`
+}
+
+type SemesterConfig struct {
+	SchoolYear string         `json:"school_year"`
+	Semester   int            `json:"semester"`
+	Start      string         `json:"start"`
+	Weeks      int            `json:"weeks"`
+	Holidays   []PeriodConfig `json:"holidays"`
+	Evaluation []PeriodConfig `json:"evaluation"`
+}
+
+type PeriodConfig struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type SemesterItem struct {
+	SchoolYear string
+	Semester   int
+	Start      time.Time
+	Weeks      int
+	Holidays   []PeriodItem
+	Evaluation []PeriodItem
+}
+
+type PeriodItem struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+var calendarLock sync.RWMutex
+var calendarSemesters []SemesterItem
+var calendarModTime time.Time
+
+const calendarDateLayout = "2006-01-02"
+
+func (calendarManagerImpl calendarManagerImpl) InitCalendar(path string) stdio.MessagedError {
+	errMessage := loadCalendar(path)
+	if errMessage.HasInfo {
+		return errMessage
+	}
+	go watchCalendar(path)
+	stdio.LogVerbose("", "校历配置成功")
+	return stdio.GetEmptyErrorMessage()
+}
+
+// Current 返回开学日期不晚于当前时间的最后一个学期，若均未开学则返回最早的学期
+func (calendarManagerImpl calendarManagerImpl) Current() SemesterItem {
+	calendarLock.RLock()
+	defer calendarLock.RUnlock()
+	if len(calendarSemesters) == 0 {
+		return SemesterItem{}
+	}
+	now := time.Now()
+	current := calendarSemesters[0]
+	for _, item := range calendarSemesters {
+		if item.Start.After(now) {
+			break
+		}
+		current = item
+	}
+	return current
+}
+
+func (calendarManagerImpl calendarManagerImpl) Find(year string, semester int) (SemesterItem, bool) {
+	calendarLock.RLock()
+	defer calendarLock.RUnlock()
+	for _, item := range calendarSemesters {
+		if item.SchoolYear == year && item.Semester == semester {
+			return item, true
+		}
+	}
+	return SemesterItem{}, false
+}
+
+// WeekStart 返回第一周的周一，开学日期为周日时第一周从次日开始
+func (calendarManagerImpl calendarManagerImpl) WeekStart(item SemesterItem) time.Time {
+	weekStart := item.Start
+	if weekStart.Weekday() == time.Sunday {
+		return weekStart.AddDate(0, 0, 1)
+	}
+	return weekStart.AddDate(0, 0, 1-int(weekStart.Weekday()))
+}
+
+// InWeeks 判断教学周是否在学期的周数范围内
+func (calendarManagerImpl calendarManagerImpl) InWeeks(item SemesterItem, week int) bool {
+	return week >= 1 && week <= item.Weeks
+}
+
+func (calendarManagerImpl calendarManagerImpl) IsHoliday(item SemesterItem, date time.Time) bool {
+	return inPeriods(item.Holidays, date)
+}
+
+func (calendarManagerImpl calendarManagerImpl) IsEvaluation(item SemesterItem, date time.Time) bool {
+	return inPeriods(item.Evaluation, date)
+}
+
+func inPeriods(periods []PeriodItem, date time.Time) bool {
+	for _, period := range periods {
+		if !date.Before(period.Start) && date.Before(period.End) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadCalendar(path string) stdio.MessagedError {
+	stat, err := os.Stat(path)
+	if err != nil {
+		stdio.LogWarn("", "校历配置文件信息获取失败", err)
+		return stdio.GetErrorMessage(-500, "校历配置读取失败")
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		stdio.LogWarn("", "校历配置读取失败", err)
+		return stdio.GetErrorMessage(-500, "校历配置读取失败")
+	}
+	config := CalendarConfig{}
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		stdio.LogWarn("", "校历配置解析失败", err)
+		return stdio.GetErrorMessage(-500, "校历配置解析失败")
+	}
+	semesters := make([]SemesterItem, 0, len(config.Semesters))
+	for _, semesterConfig := range config.Semesters {
+		item := SemesterItem{
+			SchoolYear: semesterConfig.SchoolYear,
+			Semester:   semesterConfig.Semester,
+			Weeks:      semesterConfig.Weeks,
+		}
+		item.Start, err = time.ParseInLocation(calendarDateLayout, semesterConfig.Start, time.Local)
+		if err != nil {
+			stdio.LogWarn("", "校历开学日期解析失败："+semesterConfig.SchoolYear, err)
+			return stdio.GetErrorMessage(-500, "校历配置解析失败")
+		}
+		if item.Weeks <= 0 {
+			stdio.LogWarn("", "校历教学周数必须大于0："+semesterConfig.SchoolYear, nil)
+			return stdio.GetErrorMessage(-500, "校历配置解析失败")
+		}
+		var errMessage stdio.MessagedError
+		item.Holidays, errMessage = parsePeriods(semesterConfig.Holidays)
+		if errMessage.HasInfo {
+			return errMessage
+		}
+		item.Evaluation, errMessage = parsePeriods(semesterConfig.Evaluation)
+		if errMessage.HasInfo {
+			return errMessage
+		}
+		semesters = append(semesters, item)
+	}
+	if len(semesters) == 0 {
+		stdio.LogWarn("", "校历配置中无学期信息", nil)
+		return stdio.GetErrorMessage(-500, "校历配置解析失败")
+	}
+	sort.Slice(semesters, func(i, j int) bool {
+		return semesters[i].Start.Before(semesters[j].Start)
+	})
+
+	calendarLock.Lock()
+	calendarSemesters = semesters
+	calendarModTime = stat.ModTime()
+	calendarLock.Unlock()
+	return stdio.GetEmptyErrorMessage()
+}
+
+// parsePeriods 解析起止日期，结束日期当天包含在区间内
+func parsePeriods(configs []PeriodConfig) ([]PeriodItem, stdio.MessagedError) {
+	periods := make([]PeriodItem, 0, len(configs))
+	for _, config := range configs {
+		start, err := time.ParseInLocation(calendarDateLayout, config.Start, time.Local)
+		if err != nil {
+			stdio.LogWarn("", "校历日期解析失败："+config.Name, err)
+			return nil, stdio.GetErrorMessage(-500, "校历配置解析失败")
+		}
+		end, err := time.ParseInLocation(calendarDateLayout, config.End, time.Local)
+		if err != nil {
+			stdio.LogWarn("", "校历日期解析失败："+config.Name, err)
+			return nil, stdio.GetErrorMessage(-500, "校历配置解析失败")
+		}
+		periods = append(periods, PeriodItem{
+			Name:  config.Name,
+			Start: start,
+			End:   end.AddDate(0, 0, 1),
+		})
+	}
+	return periods, stdio.GetEmptyErrorMessage()
+}
+
+// watchCalendar 定时检查配置文件修改时间，修改后重新加载，加载失败时保留原有配置
+func watchCalendar(path string) {
+	for range time.Tick(10 * time.Second) {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		calendarLock.RLock()
+		modified := !stat.ModTime().Equal(calendarModTime)
+		calendarLock.RUnlock()
+		if !modified {
+			continue
+		}
+		if errMessage := loadCalendar(path); errMessage.HasInfo {
+			stdio.LogWarn("", "校历配置重新加载失败，将继续使用原有配置", nil)
+			calendarLock.Lock()
+			calendarModTime = stat.ModTime()
+			calendarLock.Unlock()
+		} else {
+			stdio.LogInfo("", "校历配置已重新加载")
+		}
+	}
+}
@@ -3,103 +3,51 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"database/sql"
 )
 
-type chartManager interface {
-	GetFacultyName(fId int) (string, stdio.MessagedError)
-	GetSpecialtyName(fId int, sId int) (string, stdio.MessagedError)
-	GetClassName(fId int, sId int, cId int) (string, stdio.MessagedError)
-	GetChartIDWithClassName(cName string) (ChartIDItem, stdio.MessagedError)
-	WriteFacultyName(fId int, fName string) stdio.MessagedError
-	WriteSpecialtyName(fId int, sId int, sName string) stdio.MessagedError
-	WriteClassName(fId int, sId int, cId int, cName string) stdio.MessagedError
+type ChartRepository interface {
+	GetFacultyName(ctx context.Context, fId int) (string, error)
+	GetSpecialtyName(ctx context.Context, fId int, sId int) (string, error)
+	GetClassName(ctx context.Context, fId int, sId int, cId int) (string, error)
+	GetChartIDWithClassName(ctx context.Context, cName string) (ChartIDItem, error)
+	WriteFacultyName(ctx context.Context, fId int, fName string) error
+	WriteSpecialtyName(ctx context.Context, fId int, sId int, sName string) error
+	WriteClassName(ctx context.Context, fId int, sId int, cId int, cName string) error
 }
 
 type chartManagerImpl struct{}
 
-var ChartManager chartManager = chartManagerImpl{}
+var ChartManager ChartRepository = chartManagerImpl{}
 
-func (chartManagerImpl chartManagerImpl) GetFacultyName(fId int) (string, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+// queryChartName 查询字典中的名称，不存在时返回空字符串
+func queryChartName(ctx context.Context, query string, args ...interface{}) (string, error) {
+	state, err := unit.Prepare(ctx, query)
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", wrapError("名称字典查询失败", err)
 	}
-	state, err := tx.Prepare("select `f_name` from `faculty_chart` where `f_id`=?")
-	if err != nil {
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	rows := state.QueryRow(fId)
-	var fName string
-	err = rows.Scan(&fName)
-	if err == nil {
-		tx.Commit()
-		return fName, stdio.GetEmptyErrorMessage()
-	}
-	_ = tx.Rollback()
+	var name string
+	err = state.QueryRowContext(ctx, args...).Scan(&name)
 	if err == sql.ErrNoRows {
-		return "", stdio.GetEmptyErrorMessage()
-	} else {
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-}
-
-func (chartManagerImpl chartManagerImpl) GetSpecialtyName(fId int, sId int) (string, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
-	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", nil
 	}
-	state, err := tx.Prepare("select `s_name` from `specialty_chart` where `f_id`=? and `s_id`=?")
 	if err != nil {
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	rows := state.QueryRow(fId, sId)
-	var sName string
-	err = rows.Scan(&sName)
-	//err := rows.Scan(&item)
-	if err == nil {
-		tx.Commit()
-		return sName, stdio.GetEmptyErrorMessage()
-	}
-	_ = tx.Rollback()
-	if err == sql.ErrNoRows {
-		return "", stdio.GetEmptyErrorMessage()
-	} else {
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", wrapError("名称字典查询失败", err)
 	}
+	return name, nil
 }
 
-func (chartManagerImpl chartManagerImpl) GetClassName(fId int, sId int, cId int) (string, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
-	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	state, err := tx.Prepare("select `c_name` from `class_chart` where `f_id`=? and `s_id`=? and `c_id`=?")
-	if err != nil {
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	rows := state.QueryRow(fId, sId, cId)
-	var cName string
-	err = rows.Scan(&cName)
-	if err == nil {
-		tx.Commit()
-		return cName, stdio.GetEmptyErrorMessage()
-	}
-	_ = tx.Rollback()
-	if err == sql.ErrNoRows {
-		return "", stdio.GetEmptyErrorMessage()
-	} else {
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
-	}
+func (chartManagerImpl chartManagerImpl) GetFacultyName(ctx context.Context, fId int) (string, error) {
+	return queryChartName(ctx, "select `f_name` from `faculty_chart` where `f_id`=?", fId)
+}
+
+func (chartManagerImpl chartManagerImpl) GetSpecialtyName(ctx context.Context, fId int, sId int) (string, error) {
+	return queryChartName(ctx, "select `s_name` from `specialty_chart` where `f_id`=? and `s_id`=?", fId, sId)
+}
+
+func (chartManagerImpl chartManagerImpl) GetClassName(ctx context.Context, fId int, sId int, cId int) (string, error) {
+	return queryChartName(ctx, "select `c_name` from `class_chart` where `f_id`=? and `s_id`=? and `c_id`=?", fId, sId, cId)
 }
 
 type ChartIDItem struct {
@@ -108,146 +56,94 @@ type ChartIDItem struct {
 	SpecialtyId int
 }
 
-func (chartManagerImpl chartManagerImpl) GetChartIDWithClassName(cName string) (ChartIDItem, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
-	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return ChartIDItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	state, err := tx.Prepare("select `f_id`,`s_id` from `class_chart` where `c_name`=?")
+func (chartManagerImpl chartManagerImpl) GetChartIDWithClassName(ctx context.Context, cName string) (ChartIDItem, error) {
+	state, err := unit.Prepare(ctx, "select `f_id`,`s_id` from `class_chart` where `c_name`=?")
 	if err != nil {
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return ChartIDItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return ChartIDItem{}, wrapError("班级字典查询失败", err)
 	}
 	item := ChartIDItem{}
-	rows := state.QueryRow(cName)
-	err = rows.Scan(&item.FacultyId, &item.SpecialtyId)
-	if err == nil {
-		tx.Commit()
-		return item, stdio.GetEmptyErrorMessage()
-	}
-	_ = tx.Rollback()
+	err = state.QueryRowContext(ctx, cName).Scan(&item.FacultyId, &item.SpecialtyId)
 	if err == sql.ErrNoRows {
-		return ChartIDItem{}, stdio.GetEmptyErrorMessage()
-	} else {
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return ChartIDItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return ChartIDItem{}, nil
+	}
+	if err != nil {
+		return ChartIDItem{}, wrapError("班级字典查询失败", err)
 	}
+	item.Exist = true
+	return item, nil
 }
 
-func (chartManagerImpl chartManagerImpl) WriteFacultyName(fId int, fName string) stdio.MessagedError {
-	fNameExist, errMessage := ChartManager.GetFacultyName(fId)
-	if errMessage.HasInfo {
-		return errMessage
+// writeChartName exist 为 true 时执行 update，否则执行 insert，两条语句的参数顺序由调用方给出
+func writeChartName(ctx context.Context, exist bool, insert string, insertArgs []interface{},
+	update string, updateArgs []interface{}) error {
+	query, args := insert, insertArgs
+	if exist {
+		query, args = update, updateArgs
 	}
-	tx, err := unit.Maria.Begin()
+	state, err := unit.Prepare(ctx, query)
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	var state *sql.Stmt
-	if fNameExist == "" {
-		state, err = tx.Prepare("insert into `faculty_chart` (`f_id`, `f_name`) values (?, ?)")
-	} else {
-		state, err = tx.Prepare("update `faculty_chart` set `f_name`=? where `f_id`=?")
+		return wrapError("名称字典写入失败", err)
 	}
+	_, err = state.ExecContext(ctx, args...)
 	if err != nil {
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("名称字典写入失败", err)
 	}
-	if fNameExist == "" {
-		_, err = state.Exec(fId, fName)
-	} else {
-		_, err = state.Exec(fName, fId)
+	return nil
+}
+
+func (chartManagerImpl chartManagerImpl) WriteFacultyName(ctx context.Context, fId int, fName string) error {
+	fNameExist, err := ChartManager.GetFacultyName(ctx, fId)
+	if err != nil {
+		return err
 	}
+	err = writeChartName(ctx, fNameExist != "",
+		"insert into `faculty_chart` (`f_id`, `f_name`) values (?, ?)", []interface{}{fId, fName},
+		"update `faculty_chart` set `f_name`=? where `f_id`=?", []interface{}{fName, fId})
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return err
 	}
-	tx.Commit()
 	if fNameExist == "" {
 		stdio.LogVerbose("", "向数据库插入新学院名称字典成功")
 	} else {
 		stdio.LogVerbose("", "向数据库更新学院名称字典成功")
 	}
-	return stdio.GetEmptyErrorMessage()
+	return nil
 }
 
-func (chartManagerImpl chartManagerImpl) WriteSpecialtyName(fId int, sId int, sName string) stdio.MessagedError {
-	sNameExist, errMessage := ChartManager.GetSpecialtyName(fId, sId)
-	if errMessage.HasInfo {
-		return errMessage
-	}
-	tx, err := unit.Maria.Begin()
+func (chartManagerImpl chartManagerImpl) WriteSpecialtyName(ctx context.Context, fId int, sId int, sName string) error {
+	sNameExist, err := ChartManager.GetSpecialtyName(ctx, fId, sId)
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	var state *sql.Stmt
-	if sNameExist == "" {
-		state, err = tx.Prepare("insert into `specialty_chart` (`f_id`, `s_id`, `s_name`) values (?, ?, ?)")
-	} else {
-		state, err = tx.Prepare("update `specialty_chart` set `s_name`=? where `f_id`=? and `s_id`=?")
+		return err
 	}
+	err = writeChartName(ctx, sNameExist != "",
+		"insert into `specialty_chart` (`f_id`, `s_id`, `s_name`) values (?, ?, ?)", []interface{}{fId, sId, sName},
+		"update `specialty_chart` set `s_name`=? where `f_id`=? and `s_id`=?", []interface{}{sName, fId, sId})
 	if err != nil {
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return err
 	}
-	if sNameExist == "" {
-		_, err = state.Exec(fId, sId, sName)
-	} else {
-		_, err = state.Exec(sName, fId, sId)
-	}
-	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	tx.Commit()
 	if sNameExist == "" {
 		stdio.LogVerbose("", "向数据库插入新专业名称字典成功")
 	} else {
 		stdio.LogVerbose("", "向数据库更新专业名称字典成功")
 	}
-	return stdio.GetEmptyErrorMessage()
+	return nil
 }
 
-func (chartManagerImpl chartManagerImpl) WriteClassName(fId int, sId int, cId int, cName string) stdio.MessagedError {
-	cNameExist, errMessage := ChartManager.GetClassName(fId, sId, cId)
-	if errMessage.HasInfo {
-		return errMessage
-	}
-	tx, err := unit.Maria.Begin()
+func (chartManagerImpl chartManagerImpl) WriteClassName(ctx context.Context, fId int, sId int, cId int, cName string) error {
+	cNameExist, err := ChartManager.GetClassName(ctx, fId, sId, cId)
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	var state *sql.Stmt
-	if cNameExist == "" {
-		state, err = tx.Prepare("insert into `class_chart` (`f_id`, `s_id`, `c_id`, `c_name`) values (?, ?, ?, ?)")
-	} else {
-		state, err = tx.Prepare("update `class_chart` set `c_name`=? where `f_id`=? and `s_id`=? and `c_id`=?")
-	}
-	if err != nil {
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	if cNameExist == "" {
-		_, err = state.Exec(fId, sId, cId, cName)
-	} else {
-		_, err = state.Exec(cName, fId, sId, cId)
+		return err
 	}
+	err = writeChartName(ctx, cNameExist != "",
+		"insert into `class_chart` (`f_id`, `s_id`, `c_id`, `c_name`) values (?, ?, ?, ?)", []interface{}{fId, sId, cId, cName},
+		"update `class_chart` set `c_name`=? where `f_id`=? and `s_id`=? and `c_id`=?", []interface{}{cName, fId, sId, cId})
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return err
 	}
-	tx.Commit()
 	if cNameExist == "" {
 		stdio.LogVerbose("", "向数据库插入新班级名称字典成功")
 	} else {
 		stdio.LogVerbose("", "向数据库更新班级名称字典成功")
 	}
-	return stdio.GetEmptyErrorMessage()
+	return nil
 }
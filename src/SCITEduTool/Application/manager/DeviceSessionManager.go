@@ -0,0 +1,216 @@
+package manager
+
+import (
+	"SCITEduTool/Application/unit"
+	"context"
+	"errors"
+	"time"
+)
+
+type DeviceSessionRepository interface {
+	Insert(ctx context.Context, item DeviceSessionItem) error
+	Get(ctx context.Context, sessionId string) (DeviceSessionItem, error)
+	ListByUser(ctx context.Context, username string) ([]DeviceSessionItem, error)
+	Rotate(ctx context.Context, sessionId string, previousRefreshId string, refreshId string, ip string, lastUsed int64, expired int64) error
+	Touch(ctx context.Context, sessionId string, lastUsed int64) error
+	Revoke(ctx context.Context, username string, sessionId string) error
+	ListRevoked(ctx context.Context, timeNow int64) ([]string, error)
+	Retire(ctx context.Context, tokenId string, username string, sessionId string, expired int64) (string, error)
+}
+
+type deviceSessionManagerImpl struct{}
+
+var DeviceSessionManager DeviceSessionRepository = deviceSessionManagerImpl{}
+
+// ErrTokenRetired 未关联设备会话的 refresh_token 已换发过
+var ErrTokenRetired = errors.New("令牌已作废")
+
+// DeviceInfo 签发令牌时的设备信息
+type DeviceInfo struct {
+	Name     string
+	Platform string
+	IP       string
+}
+
+// DeviceSessionItem 设备会话，每次登录创建一个会话，同一会话换发的 refresh_token 属于同一家族。
+// RefreshId 为该会话当前唯一有效的 refresh_token 的 jti
+type DeviceSessionItem struct {
+	SessionId  string `json:"session_id"`
+	Username   string `json:"-"`
+	RefreshId  string `json:"-"`
+	Device     string `json:"device"`
+	Platform   string `json:"platform"`
+	IP         string `json:"ip"`
+	CreateTime int64  `json:"create_time"`
+	LastUsed   int64  `json:"last_used"`
+	Expired    int64  `json:"expired"`
+	Revoked    bool   `json:"-"`
+}
+
+func (deviceSessionManagerImpl deviceSessionManagerImpl) Insert(ctx context.Context, item DeviceSessionItem) error {
+	state, err := unit.Prepare(ctx, "insert into `user_device_sessions` (`s_id`, `u_id`, `s_refresh_id`, `s_device`, `s_platform`, `s_ip`, `s_create_time`, `s_last_used`, `s_expired`, `s_revoked`) values (?, ?, ?, ?, ?, ?, ?, ?, ?, 0)")
+	if err != nil {
+		return wrapError("设备会话写入失败", err)
+	}
+	_, err = state.ExecContext(ctx, item.SessionId, item.Username, item.RefreshId, item.Device, item.Platform,
+		item.IP, item.CreateTime, item.LastUsed, item.Expired)
+	if err != nil {
+		return wrapError("设备会话写入失败", err)
+	}
+	return nil
+}
+
+// Get 查询设备会话，会话不存在时返回 ErrNotFound
+func (deviceSessionManagerImpl deviceSessionManagerImpl) Get(ctx context.Context, sessionId string) (DeviceSessionItem, error) {
+	state, err := unit.Prepare(ctx, "select `u_id`,`s_refresh_id`,`s_device`,`s_platform`,`s_ip`,`s_create_time`,`s_last_used`,`s_expired`,`s_revoked` from `user_device_sessions` where `s_id`=?")
+	if err != nil {
+		return DeviceSessionItem{}, wrapError("设备会话查询失败", err)
+	}
+	item := DeviceSessionItem{
+		SessionId: sessionId,
+	}
+	revoked := 0
+	err = state.QueryRowContext(ctx, sessionId).Scan(&item.Username, &item.RefreshId, &item.Device, &item.Platform,
+		&item.IP, &item.CreateTime, &item.LastUsed, &item.Expired, &revoked)
+	if err != nil {
+		return DeviceSessionItem{}, wrapError("设备会话查询失败", err)
+	}
+	item.Revoked = revoked == 1
+	return item, nil
+}
+
+// ListByUser 按最近使用时间倒序返回用户未撤销且未过期的设备会话
+func (deviceSessionManagerImpl deviceSessionManagerImpl) ListByUser(ctx context.Context, username string) ([]DeviceSessionItem, error) {
+	state, err := unit.Prepare(ctx, "select `s_id`,`s_refresh_id`,`s_device`,`s_platform`,`s_ip`,`s_create_time`,`s_last_used`,`s_expired` from `user_device_sessions` where `u_id`=? and `s_revoked`=0 and `s_expired`>? order by `s_last_used` desc")
+	if err != nil {
+		return nil, wrapError("设备会话查询失败", err)
+	}
+	rows, err := state.QueryContext(ctx, username, time.Now().Unix())
+	if err != nil {
+		return nil, wrapError("设备会话查询失败", err)
+	}
+	defer rows.Close()
+	sessions := []DeviceSessionItem{}
+	for rows.Next() {
+		item := DeviceSessionItem{
+			Username: username,
+		}
+		err = rows.Scan(&item.SessionId, &item.RefreshId, &item.Device, &item.Platform,
+			&item.IP, &item.CreateTime, &item.LastUsed, &item.Expired)
+		if err != nil {
+			return nil, wrapError("设备会话查询失败", err)
+		}
+		sessions = append(sessions, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError("设备会话查询失败", err)
+	}
+	return sessions, nil
+}
+
+// Rotate 将会话的 refresh_token 由 previousRefreshId 替换为 refreshId，
+// previousRefreshId 已不是当前 refresh_token 或会话已撤销时返回 ErrNotFound
+func (deviceSessionManagerImpl deviceSessionManagerImpl) Rotate(ctx context.Context, sessionId string, previousRefreshId string, refreshId string, ip string, lastUsed int64, expired int64) error {
+	state, err := unit.Prepare(ctx, "update `user_device_sessions` set `s_refresh_id`=?, `s_ip`=?, `s_last_used`=?, `s_expired`=? where `s_id`=? and `s_refresh_id`=? and `s_revoked`=0")
+	if err != nil {
+		return wrapError("设备会话更新失败", err)
+	}
+	result, err := state.ExecContext(ctx, refreshId, ip, lastUsed, expired, sessionId, previousRefreshId)
+	if err != nil {
+		return wrapError("设备会话更新失败", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return wrapError("设备会话更新失败", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (deviceSessionManagerImpl deviceSessionManagerImpl) Touch(ctx context.Context, sessionId string, lastUsed int64) error {
+	state, err := unit.Prepare(ctx, "update `user_device_sessions` set `s_last_used`=? where `s_id`=? and `s_last_used`<?")
+	if err != nil {
+		return wrapError("设备会话更新失败", err)
+	}
+	_, err = state.ExecContext(ctx, lastUsed, sessionId, lastUsed)
+	if err != nil {
+		return wrapError("设备会话更新失败", err)
+	}
+	return nil
+}
+
+// Revoke 撤销用户的设备会话，会话不存在、不属于该用户或已撤销时返回 ErrNotFound
+func (deviceSessionManagerImpl deviceSessionManagerImpl) Revoke(ctx context.Context, username string, sessionId string) error {
+	state, err := unit.Prepare(ctx, "update `user_device_sessions` set `s_revoked`=1 where `s_id`=? and `u_id`=? and `s_revoked`=0")
+	if err != nil {
+		return wrapError("设备会话撤销失败", err)
+	}
+	result, err := state.ExecContext(ctx, sessionId, username)
+	if err != nil {
+		return wrapError("设备会话撤销失败", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return wrapError("设备会话撤销失败", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListRevoked 返回已撤销且未过期的会话 ID，已过期会话的令牌无需再比对
+func (deviceSessionManagerImpl deviceSessionManagerImpl) ListRevoked(ctx context.Context, timeNow int64) ([]string, error) {
+	state, err := unit.Prepare(ctx, "select `s_id` from `user_device_sessions` where `s_revoked`=1 and `s_expired`>?")
+	if err != nil {
+		return nil, wrapError("已撤销设备会话查询失败", err)
+	}
+	rows, err := state.QueryContext(ctx, timeNow)
+	if err != nil {
+		return nil, wrapError("已撤销设备会话查询失败", err)
+	}
+	defer rows.Close()
+	var revoked []string
+	for rows.Next() {
+		var sessionId string
+		if err = rows.Scan(&sessionId); err != nil {
+			return nil, wrapError("已撤销设备会话查询失败", err)
+		}
+		revoked = append(revoked, sessionId)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError("已撤销设备会话查询失败", err)
+	}
+	return revoked, nil
+}
+
+// Retire 记录未关联设备会话的 refresh_token 已换发至新会话 sessionId，tokenId 为 JWT 的 jti 或旧版令牌的摘要。
+// 该令牌此前已换发过时返回 ErrTokenRetired 与当时创建的会话 ID
+func (deviceSessionManagerImpl deviceSessionManagerImpl) Retire(ctx context.Context, tokenId string, username string, sessionId string, expired int64) (string, error) {
+	state, err := unit.Prepare(ctx, unit.Dialect.InsertIgnore()+" `user_retired_tokens` (`t_id`, `u_id`, `s_id`, `t_expired`) values (?, ?, ?, ?)")
+	if err != nil {
+		return "", wrapError("作废令牌写入失败", err)
+	}
+	result, err := state.ExecContext(ctx, tokenId, username, sessionId, expired)
+	if err != nil {
+		return "", wrapError("作废令牌写入失败", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return "", wrapError("作废令牌写入失败", err)
+	}
+	if affected > 0 {
+		return sessionId, nil
+	}
+	state, err = unit.Prepare(ctx, "select `s_id` from `user_retired_tokens` where `t_id`=?")
+	if err != nil {
+		return "", wrapError("作废令牌查询失败", err)
+	}
+	err = state.QueryRowContext(ctx, tokenId).Scan(&sessionId)
+	if err != nil {
+		return "", wrapError("作废令牌查询失败", err)
+	}
+	return sessionId, ErrTokenRetired
+}
@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type ExamRepository interface {
+	Get(ctx context.Context, username string, year string, semester int) (ExamContent, error)
+	Update(ctx context.Context, username string, year string, semester int, exam ExamObject) error
+	InsertChange(ctx context.Context, username string, year string, semester int, change ExamChange) error
+}
+
+type examManagerImpl struct{}
+
+var ExamManager ExamRepository = examManagerImpl{}
+
+type ExamItem struct {
+	Name     string        `json:"name"`
+	Time     string        `json:"time"`
+	Location string        `json:"location"`
+	SetNum   string        `json:"set_num"`
+	Room     string        `json:"room,omitempty"`
+	Role     string        `json:"role,omitempty"`
+	Changed  bool          `json:"changed"`
+	Previous *ExamPrevious `json:"previous,omitempty"`
+}
+
+type ExamPrevious struct {
+	Time     string `json:"time"`
+	Location string `json:"location"`
+	Room     string `json:"room,omitempty"`
+}
+
+type ExamObject struct {
+	Object []ExamItem `json:"exam"`
+}
+
+type ExamContent struct {
+	Exist   bool
+	Expired bool
+	Exam    string
+}
+
+type ExamChange struct {
+	Name     string
+	Previous ExamPrevious
+	Current  ExamPrevious
+}
+
+func (examManagerImpl examManagerImpl) Get(ctx context.Context, username string, year string, semester int) (ExamContent, error) {
+	state, err := unit.Prepare(ctx, "select `e_content`,`e_expired` from `exam_schedule` where `u_id`=? and `e_school_year`=? and `e_semester`=?")
+	if err != nil {
+		return ExamContent{}, wrapError("考试安排查询失败", err)
+	}
+	exam := ExamContent{}
+	var expired int64
+	err = state.QueryRowContext(ctx, username, year, semester).Scan(&exam.Exam, &expired)
+	if err == sql.ErrNoRows {
+		return ExamContent{}, nil
+	}
+	if err != nil {
+		return ExamContent{}, wrapError("考试安排查询失败", err)
+	}
+	exam.Exist = true
+	exam.Expired = expired < time.Now().Unix()
+	return exam, nil
+}
+
+func (examManagerImpl examManagerImpl) Update(ctx context.Context, username string, year string, semester int, exam ExamObject) error {
+	examContent, err := json.Marshal(exam)
+	if err != nil {
+		return err
+	}
+	exist, err := ExamManager.Get(ctx, username, year, semester)
+	if err != nil {
+		return err
+	}
+	var state *sql.Stmt
+	if !exist.Exist {
+		state, err = unit.Prepare(ctx, "insert into `exam_schedule` (`e_content`, `e_expired`, `u_id`, `e_school_year`, `e_semester`) values (?, ?, ?, ?, ?)")
+	} else {
+		state, err = unit.Prepare(ctx, "update `exam_schedule` set `e_content`=?, `e_expired`=? where `u_id`=? and `e_school_year`=? and `e_semester`=?")
+	}
+	if err != nil {
+		return wrapError("考试安排写入失败", err)
+	}
+	_, err = state.ExecContext(ctx, string(examContent), time.Now().Unix()+21600, username, year, semester)
+	if err != nil {
+		return wrapError("考试安排写入失败", err)
+	}
+	if !exist.Exist {
+		stdio.LogVerbose(username, "向数据库插入新考试安排数据成功")
+	} else {
+		stdio.LogVerbose(username, "向数据库更新考试安排数据成功")
+	}
+	return nil
+}
+
+func (examManagerImpl examManagerImpl) InsertChange(ctx context.Context, username string, year string, semester int, change ExamChange) error {
+	state, err := unit.Prepare(ctx, "insert into `exam_change` (`u_id`, `e_school_year`, `e_semester`, `e_name`, `c_previous_time`, `c_previous_location`, `c_time`, `c_location`, `c_create_time`) values (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return wrapError("考试安排变更写入失败", err)
+	}
+	_, err = state.ExecContext(ctx, username, year, semester, change.Name,
+		change.Previous.Time, joinExamLocation(change.Previous),
+		change.Current.Time, joinExamLocation(change.Current), time.Now().Unix())
+	if err != nil {
+		return wrapError("考试安排变更写入失败", err)
+	}
+	stdio.LogInfo(username, "考试安排发生变更："+change.Name)
+	return nil
+}
+
+func joinExamLocation(item ExamPrevious) string {
+	if item.Room == "" || item.Room == item.Location {
+		return item.Location
+	}
+	return item.Location + " " + item.Room
+}
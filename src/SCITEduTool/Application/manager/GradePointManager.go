@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"SCITEduTool/Application/stdio"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type gradePointManager interface {
+	InitGradePoint(conf GradePointConfig)
+	Parse(mark string) (float64, float64, bool)
+	Passed(score float64) bool
+}
+
+type gradePointManagerImpl struct{}
+
+var GradePointManager gradePointManager = gradePointManagerImpl{}
+
+// GradePointConfig 绩点换算配置，等级制成绩先按 Words 换算为百分制分数，再按 Levels 换算绩点，
+// 换算后的分数不低于 PassScore 时视为通过
+type GradePointConfig struct {
+	Levels    []GradePointLevel  `json:"levels"`
+	Words     map[string]float64 `json:"words"`
+	PassScore float64            `json:"pass_score"`
+}
+
+type GradePointLevel struct {
+	Min   float64 `json:"min"`
+	Point float64 `json:"point"`
+}
+
+var gradePointConfig = GetDefaultGradePointConfig()
+
+func GetDefaultGradePointConfig() GradePointConfig {
+	return GradePointConfig{
+		Levels: []GradePointLevel{
+			{Min: 90, Point: 4.0},
+			{Min: 85, Point: 3.7},
+			{Min: 82, Point: 3.3},
+			{Min: 78, Point: 3.0},
+			{Min: 75, Point: 2.7},
+			{Min: 72, Point: 2.3},
+			{Min: 68, Point: 2.0},
+			{Min: 64, Point: 1.5},
+			{Min: 60, Point: 1.0},
+			{Min: 0, Point: 0},
+		},
+		Words: map[string]float64{
+			"优秀":  95,
+			"良好":  85,
+			"中等":  75,
+			"及格":  65,
+			"不及格": 0,
+			"合格":  85,
+			"不合格": 0,
+			"通过":  85,
+			"不通过": 0,
+		},
+		PassScore: 60,
+	}
+}
+
+func (gradePointManagerImpl gradePointManagerImpl) InitGradePoint(conf GradePointConfig) {
+	if len(conf.Levels) == 0 {
+		stdio.LogWarn("", "绩点换算等级为空，将使用默认值", nil)
+		conf.Levels = GetDefaultGradePointConfig().Levels
+	}
+	if conf.Words == nil {
+		conf.Words = GetDefaultGradePointConfig().Words
+	}
+	if conf.PassScore <= 0 {
+		stdio.LogWarn("", "及格分数未配置，将使用默认值", nil)
+		conf.PassScore = GetDefaultGradePointConfig().PassScore
+	}
+	sort.Slice(conf.Levels, func(i, j int) bool {
+		return conf.Levels[i].Min > conf.Levels[j].Min
+	})
+	gradePointConfig = conf
+	stdio.LogVerbose("", "绩点换算配置成功")
+}
+
+// Parse 将成绩字符串换算为百分制分数与绩点，无法识别的成绩返回 false
+func (gradePointManagerImpl gradePointManagerImpl) Parse(mark string) (float64, float64, bool) {
+	mark = strings.TrimSpace(mark)
+	if mark == "" {
+		return 0, 0, false
+	}
+	score, exist := gradePointConfig.Words[mark]
+	if !exist {
+		var err error
+		score, err = strconv.ParseFloat(mark, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	for _, level := range gradePointConfig.Levels {
+		if score >= level.Min {
+			return score, level.Point, true
+		}
+	}
+	return score, 0, true
+}
+
+// Passed 判断 Parse 换算后的百分制分数是否通过
+func (gradePointManagerImpl gradePointManagerImpl) Passed(score float64) bool {
+	return score >= gradePointConfig.PassScore
+}
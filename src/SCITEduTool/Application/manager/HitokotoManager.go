@@ -3,19 +3,20 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"database/sql"
 	"time"
 )
 
-type hitokotoManager interface {
-	Get() (HitokotoItem, stdio.MessagedError)
-	Insert(item HitokotoItem) stdio.MessagedError
-	CheckHitokotoExist(index int) (bool, stdio.MessagedError)
+type HitokotoRepository interface {
+	Get(ctx context.Context) (HitokotoItem, error)
+	Insert(ctx context.Context, item HitokotoItem) error
+	CheckHitokotoExist(ctx context.Context, index int) (bool, error)
 }
 
 type hitokotoManagerImpl struct{}
 
-var HitokotoManager hitokotoManager = hitokotoManagerImpl{}
+var HitokotoManager HitokotoRepository = hitokotoManagerImpl{}
 
 type HitokotoItem struct {
 	Exist      bool
@@ -31,122 +32,71 @@ type HitokotoItem struct {
 	Length     int    `json:"length"`
 }
 
-func (hitokotoManagerImpl hitokotoManagerImpl) Get() (HitokotoItem, stdio.MessagedError) {
-	hitokoto := HitokotoItem{}
-	tx, err := unit.Maria.Begin()
-	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	state, err := tx.Prepare("select `h_id` from `hitokoto` where `h_insert_at`>?")
+// Get 随机返回一条 Hitokoto，最近一天内没有插入过新数据时返回 Exist 为 false 的空结果
+func (hitokotoManagerImpl hitokotoManagerImpl) Get(ctx context.Context) (HitokotoItem, error) {
+	state, err := unit.Prepare(ctx, "select `h_id` from `hitokoto` where `h_insert_at`>? limit 1")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return HitokotoItem{}, wrapError("Hitokoto查询失败", err)
 	}
-	rows := state.QueryRow(time.Now().Unix() - 86400)
 	hId := 0
-	err = rows.Scan(&hId)
-	if err == nil {
-		goto rand
-	}
+	err = state.QueryRowContext(ctx, time.Now().Unix()-86400).Scan(&hId)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return HitokotoItem{}, stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return HitokotoItem{}, nil
 	}
-
-rand:
-	tx, err = unit.Maria.Begin()
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return HitokotoItem{}, wrapError("Hitokoto查询失败", err)
 	}
-	state, err = tx.Prepare("select `h_content`,`h_from`,`h_length` from `hitokoto` where `h_id` >= (select floor(RAND() * (select MAX(`h_id`) from `hitokoto`))) order by `h_id` limit 1")
+
+	state, err = unit.Prepare(ctx, "select `h_content`,`h_from`,`h_length` from `hitokoto` where `h_id` >= (select "+
+		unit.Dialect.RandomBelow("(select MAX(`h_id`) from `hitokoto`)")+") order by `h_id` limit 1")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	rows = state.QueryRow()
-	err = rows.Scan(&hitokoto.Content, &hitokoto.From, &hitokoto.Length)
-	if err == nil {
-		tx.Commit()
-		hitokoto.Exist = true
-		return hitokoto, stdio.GetEmptyErrorMessage()
+		return HitokotoItem{}, wrapError("Hitokoto查询失败", err)
 	}
+	hitokoto := HitokotoItem{}
+	err = state.QueryRowContext(ctx).Scan(&hitokoto.Content, &hitokoto.From, &hitokoto.Length)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return HitokotoItem{}, stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-}
-
-func (hitokotoManagerImpl hitokotoManagerImpl) Insert(item HitokotoItem) stdio.MessagedError {
-	exit, errMessage := HitokotoManager.CheckHitokotoExist(item.Index)
-	if errMessage.HasInfo {
-		return errMessage
+		return HitokotoItem{}, nil
 	}
-	if exit {
-		return stdio.GetEmptyErrorMessage()
+	if err != nil {
+		return HitokotoItem{}, wrapError("Hitokoto查询失败", err)
 	}
+	hitokoto.Exist = true
+	return hitokoto, nil
+}
 
-	tx, err := unit.Maria.Begin()
+func (hitokotoManagerImpl hitokotoManagerImpl) Insert(ctx context.Context, item HitokotoItem) error {
+	exist, err := HitokotoManager.CheckHitokotoExist(ctx, item.Index)
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return err
 	}
-	state, err := tx.Prepare("insert into `hitokoto` (h_index, h_content, h_type, h_from, h_from_who, h_creator, h_creator_uid, h_reviewer, h_insert_at, h_length) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if exist {
+		return nil
+	}
+	state, err := unit.Prepare(ctx, "insert into `hitokoto` (h_index, h_content, h_type, h_from, h_from_who, h_creator, h_creator_uid, h_reviewer, h_insert_at, h_length) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("Hitokoto写入失败", err)
 	}
-	_, err = state.Exec(item.Index, item.Content, item.Type, item.From, item.FromWho, item.Creator,
+	_, err = state.ExecContext(ctx, item.Index, item.Content, item.Type, item.From, item.FromWho, item.Creator,
 		item.CreatorUid, item.Reviewer, time.Now().Unix(), item.Length)
-	if err == nil {
-		tx.Commit()
-		stdio.LogVerbose("", "向数据库插入新Hitokoto成功")
-		return stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库查询失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+	if err != nil {
+		return wrapError("Hitokoto写入失败", err)
 	}
+	stdio.LogVerbose("", "向数据库插入新Hitokoto成功")
+	return nil
 }
 
-func (hitokotoManagerImpl hitokotoManagerImpl) CheckHitokotoExist(index int) (bool, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+func (hitokotoManagerImpl hitokotoManagerImpl) CheckHitokotoExist(ctx context.Context, index int) (bool, error) {
+	state, err := unit.Prepare(ctx, "select `h_index` from `hitokoto` where `h_index`=?")
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return false, wrapError("Hitokoto查询失败", err)
 	}
-	var state *sql.Stmt
-	state, err = tx.Prepare("select `h_index` from `hitokoto` where `h_index`=?")
-	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	rows := state.QueryRow(index)
 	id := -1
-	err = rows.Scan(&id)
-	if err == nil {
-		tx.Commit()
-		return id != -1, stdio.GetEmptyErrorMessage()
-	}
+	err = state.QueryRowContext(ctx, index).Scan(&id)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return false, stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapError("Hitokoto查询失败", err)
 	}
+	return id != -1, nil
 }
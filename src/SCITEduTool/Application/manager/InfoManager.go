@@ -3,19 +3,21 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"database/sql"
 	"time"
 )
 
-type infoManager interface {
-	Get(username string) (UserInfo, stdio.MessagedError)
-	Update(username string, name string, faculty int, specialty int, class int, grade int) stdio.MessagedError
-	SetUserInfoExpired(username string) stdio.MessagedError
+type InfoRepository interface {
+	Get(ctx context.Context, username string) (UserInfo, error)
+	Update(ctx context.Context, username string, name string, faculty int, specialty int, class int, grade int) error
+	SetUserInfoExpired(ctx context.Context, username string) error
+	ListExpiring(ctx context.Context, before int64, limit int) ([]string, error)
 }
 
 type infoManagerImpl struct{}
 
-var InfoManager infoManager = infoManagerImpl{}
+var InfoManager InfoRepository = infoManagerImpl{}
 
 type ChartItem struct {
 	Name string
@@ -34,112 +36,101 @@ type UserInfo struct {
 	Class     int
 }
 
-func (infoManagerImpl infoManagerImpl) Get(username string) (UserInfo, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+func (infoManagerImpl infoManagerImpl) Get(ctx context.Context, username string) (UserInfo, error) {
+	state, err := unit.Prepare(ctx, "select `u_name`,`u_identify`,`u_level`,`u_faculty`,`u_specialty`,`u_class`,`u_grade`,`u_info_expired` from `user_info` where `u_id`=?")
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return UserInfo{}, wrapError("用户信息查询失败", err)
 	}
-	state, err := tx.Prepare("select `u_name`,`u_identify`,`u_level`,`u_faculty`,`u_specialty`,`u_class`,`u_grade`,`u_info_expired` from `user_info` where `u_id`=?")
-	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	rows := state.QueryRow(username)
 	info := UserInfo{}
 	var expired int64
 	name := sql.NullString{}
-	err = rows.Scan(&name, &info.Identify, &info.Level, &info.Faculty, &info.Specialty, &info.Class, &info.Grade, &expired)
-	if err == nil {
-		tx.Commit()
-		info.Exist = true
-		info.Expired = expired < time.Now().Unix()
-		if name.Valid {
-			info.Name = name.String
-		} else {
-			info.Name = ""
-		}
-		return info, stdio.GetEmptyErrorMessage()
-	}
+	err = state.QueryRowContext(ctx, username).Scan(&name, &info.Identify, &info.Level, &info.Faculty,
+		&info.Specialty, &info.Class, &info.Grade, &expired)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return UserInfo{}, stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-		return UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return UserInfo{}, nil
 	}
+	if err != nil {
+		return UserInfo{}, wrapError("用户信息查询失败", err)
+	}
+	info.Exist = true
+	info.Expired = expired < time.Now().Unix()
+	info.Name = name.String
+	return info, nil
 }
 
-func (infoManagerImpl infoManagerImpl) Update(username string, name string, faculty int, specialty int, class int, grade int) stdio.MessagedError {
-	exist, errMessage := SessionManager.CheckUserExist(username, "user_info")
-	if errMessage.HasInfo {
-		return errMessage
-	}
-	tx, err := unit.Maria.Begin()
+func (infoManagerImpl infoManagerImpl) Update(ctx context.Context, username string, name string, faculty int, specialty int, class int, grade int) error {
+	exist, err := SessionManager.CheckUserExist(ctx, username, "user_info")
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return err
 	}
 	var state *sql.Stmt
 	if !exist {
-		state, err = tx.Prepare("insert into `user_info` (`u_id`, `u_name` ,`u_faculty`, `u_specialty`, `u_class`, `u_grade`, `u_info_expired`) values (?, ?, ?, ?, ?, ?, ?)")
+		state, err = unit.Prepare(ctx, "insert into `user_info` (`u_id`, `u_name` ,`u_faculty`, `u_specialty`, `u_class`, `u_grade`, `u_info_expired`) values (?, ?, ?, ?, ?, ?, ?)")
 	} else {
-		state, err = tx.Prepare("update `user_info` set `u_name`=?, `u_faculty`=?, `u_specialty`=?, `u_class`=?, `u_grade`=?, `u_info_expired`=? where `u_id`=?")
+		state, err = unit.Prepare(ctx, "update `user_info` set `u_name`=?, `u_faculty`=?, `u_specialty`=?, `u_class`=?, `u_grade`=?, `u_info_expired`=? where `u_id`=?")
 	}
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("用户信息写入失败", err)
 	}
 	if !exist {
-		_, err = state.Exec(username, name, faculty, specialty, class, grade, time.Now().Unix()+1296000)
+		_, err = state.ExecContext(ctx, username, name, faculty, specialty, class, grade, time.Now().Unix()+1296000)
 	} else {
-		_, err = state.Exec(name, faculty, specialty, class, grade, time.Now().Unix()+1296000, username)
+		_, err = state.ExecContext(ctx, name, faculty, specialty, class, grade, time.Now().Unix()+1296000, username)
 	}
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("用户信息写入失败", err)
 	}
-	tx.Commit()
 	if !exist {
 		stdio.LogVerbose(username, "向数据库插入新用户信息成功")
 	} else {
 		stdio.LogVerbose(username, "向数据库更新用户信息成功")
 	}
-	return stdio.GetEmptyErrorMessage()
+	return nil
 }
 
-func (infoManagerImpl infoManagerImpl) SetUserInfoExpired(username string) stdio.MessagedError {
-	exist, errMessage := SessionManager.CheckUserExist(username, "user_info")
-	if errMessage.HasInfo {
-		return errMessage
+// SetUserInfoExpired 标记用户 token 失效，用户不存在时返回 ErrNotFound
+func (infoManagerImpl infoManagerImpl) SetUserInfoExpired(ctx context.Context, username string) error {
+	exist, err := SessionManager.CheckUserExist(ctx, username, "user_info")
+	if err != nil {
+		return err
 	}
 	if !exist {
-		stdio.LogWarn(username, "用户信息不存在", nil)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return ErrNotFound
 	}
-	tx, err := unit.Maria.Begin()
+	state, err := unit.Prepare(ctx, "update `user_token` set `u_token_effective`=0 where `u_id`=?")
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("用户token失效标记失败", err)
 	}
-	state, err := tx.Prepare("update `user_token` set `u_token_effective`=0 where `u_id`=?")
+	_, err = state.ExecContext(ctx, username)
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	_, err = state.Exec(username)
-	if err == nil {
-		tx.Commit()
-		stdio.LogVerbose(username, "标记用户token失效成功")
-		return stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("用户token失效标记失败", err)
+	}
+	stdio.LogVerbose(username, "标记用户token失效成功")
+	return nil
+}
+
+// ListExpiring 返回将在 before 之前过期的用户信息对应的账号
+func (infoManagerImpl infoManagerImpl) ListExpiring(ctx context.Context, before int64, limit int) ([]string, error) {
+	state, err := unit.Prepare(ctx, "select `u_id` from `user_info` where `u_info_expired`>=? and `u_info_expired`<? order by `u_info_expired` limit ?")
+	if err != nil {
+		return nil, wrapError("过期用户信息查询失败", err)
+	}
+	rows, err := state.QueryContext(ctx, time.Now().Unix(), before, limit)
+	if err != nil {
+		return nil, wrapError("过期用户信息查询失败", err)
+	}
+	defer rows.Close()
+	usernames := make([]string, 0)
+	for rows.Next() {
+		var username string
+		err = rows.Scan(&username)
+		if err != nil {
+			return nil, wrapError("过期用户信息查询失败", err)
+		}
+		usernames = append(usernames, username)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError("过期用户信息查询失败", err)
 	}
+	return usernames, nil
 }
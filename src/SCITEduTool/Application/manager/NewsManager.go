@@ -3,25 +3,32 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"strings"
 	"time"
 )
 
-type newsManager interface {
-	GetNewsById(tid int, nid int) (NewsItem, stdio.MessagedError)
-	UpdateNews(item NewsItem) stdio.MessagedError
-	GetHeadlines() (Headlines, stdio.MessagedError)
-	UpdateHeadlines(headlines []NewsItem) stdio.MessagedError
-	CheckNewsExist(tid int, nid int) (bool, stdio.MessagedError)
-	GetTypeChart() ([]NewsTypeChartItem, stdio.MessagedError)
-	UpdateTypeChart(chart []NewsTypeChartItem) stdio.MessagedError
-	CheckChartExist(nTypeId int) (bool, stdio.MessagedError)
+type NewsRepository interface {
+	GetNewsById(ctx context.Context, tid int, nid int) (NewsItem, error)
+	UpdateNews(ctx context.Context, item NewsItem) error
+	GetHeadlines(ctx context.Context) (Headlines, error)
+	UpdateHeadlines(ctx context.Context, headlines []NewsItem) error
+	GetHeadlinesExpired(ctx context.Context) (int64, error)
+	GetContent(ctx context.Context, tid int, nid int) (NewsContent, error)
+	UpdateContent(ctx context.Context, tid int, nid int, content NewsContentObject) error
+	SearchNews(ctx context.Context, query NewsSearchQuery) ([]NewsItem, bool, error)
+	ListNews(ctx context.Context, query NewsListQuery) ([]NewsItem, error)
+	CheckNewsExist(ctx context.Context, tid int, nid int) (bool, error)
+	GetTypeChart(ctx context.Context) ([]NewsTypeChartItem, error)
+	UpdateTypeChart(ctx context.Context, chart []NewsTypeChartItem) error
+	CheckChartExist(ctx context.Context, nTypeId int) (bool, error)
 }
 
 type newsManagerImpl struct{}
 
-var NewsManager newsManager = newsManagerImpl{}
+var NewsManager NewsRepository = newsManagerImpl{}
 
 type NewsItem struct {
 	Tid        int      `json:"tid"`
@@ -32,6 +39,49 @@ type NewsItem struct {
 	CreateTime string   `json:"create_time"`
 }
 
+type NewsAttachment struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+// NewsContentObject 新闻正文，Content 为过滤后的 HTML，其中的链接与图片均为绝对地址
+type NewsContentObject struct {
+	Content     string           `json:"content"`
+	Images      []string         `json:"images"`
+	Attachments []NewsAttachment `json:"attachments"`
+}
+
+type NewsContent struct {
+	Exist   bool
+	Expired bool
+	Content NewsContentObject
+}
+
+// NewsSearchQuery 新闻搜索条件，Tid 小于 0 时不限类别，Start 与 End 为空时不限日期
+type NewsSearchQuery struct {
+	Keywords []string
+	Tid      int
+	Start    string
+	End      string
+	Page     int
+	Size     int
+}
+
+// NewsListQuery 新闻列表查询条件，After 有效时返回排在其后的新闻，否则跳过 Offset 条
+type NewsListQuery struct {
+	Tid    int
+	After  NewsCursor
+	Offset int
+	Size   int
+}
+
+// NewsCursor 新闻列表游标，对应上一页最后一条新闻的发布时间与 ID
+type NewsCursor struct {
+	Valid      bool
+	CreateTime string
+	Nid        int
+}
+
 type Headlines struct {
 	Exist   bool
 	Expired bool
@@ -44,98 +94,60 @@ type NewsTypeChartItem struct {
 	Out      int    `json:"-"`
 }
 
-func (newsManagerImpl newsManagerImpl) GetNewsById(tid int, nid int) (NewsItem, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
-	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	state, err := tx.Prepare("select `n_images`,`n_title`,`n_summary`,`n_create_time` from `news` where `n_id`=? and `n_type_id`=?")
+// GetNewsById 返回已缓存的新闻，不存在时返回 ErrNotFound
+func (newsManagerImpl newsManagerImpl) GetNewsById(ctx context.Context, tid int, nid int) (NewsItem, error) {
+	state, err := unit.Prepare(ctx, "select `n_images`,`n_title`,`n_summary`,`n_create_time` from `news` where `n_id`=? and `n_type_id`=?")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return NewsItem{}, wrapError("新闻查询失败", err)
 	}
-	rows := state.QueryRow(nid, tid)
 	item := NewsItem{}
 	images := ""
-	err = rows.Scan(&images, &item.Title, &item.Summary, &item.CreateTime)
+	err = state.QueryRowContext(ctx, nid, tid).Scan(&images, &item.Title, &item.Summary, &item.CreateTime)
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return NewsItem{}, wrapError("新闻查询失败", err)
 	}
-	tx.Commit()
 	err = json.Unmarshal([]byte(images), &item)
 	if err != nil {
-		stdio.LogWarn("", "新闻图片数据解析失败", err)
-		return NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return NewsItem{}, wrapError("新闻图片数据解析失败", err)
 	}
 	item.Nid = nid
 	item.Tid = tid
-	return item, stdio.GetEmptyErrorMessage()
+	return item, nil
 }
 
-func (newsManagerImpl newsManagerImpl) UpdateNews(item NewsItem) stdio.MessagedError {
-	exist, errMessage := NewsManager.CheckNewsExist(item.Tid, item.Nid)
-	if errMessage.HasInfo {
-		return errMessage
-	}
-	tx, err := unit.Maria.Begin()
+func (newsManagerImpl newsManagerImpl) UpdateNews(ctx context.Context, item NewsItem) error {
+	exist, err := NewsManager.CheckNewsExist(ctx, item.Tid, item.Nid)
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return err
 	}
-	var state *sql.Stmt
 	if exist {
-		return stdio.GetEmptyErrorMessage()
+		return nil
 	}
-	state, err = tx.Prepare("insert into `news` (`n_id`, `n_type_id`, `n_title`, `n_summary`, `n_images`, `n_create_time`) values (?, ?, ?, ?, ?, ?)")
+	state, err := unit.Prepare(ctx, "insert into `news` (`n_id`, `n_type_id`, `n_title`, `n_summary`, `n_images`, `n_create_time`) values (?, ?, ?, ?, ?, ?)")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("新闻写入失败", err)
 	}
 	img, _ := json.Marshal(struct {
 		Images []string `json:"images"`
 	}{
 		Images: item.Images,
 	})
-	_, err = state.Exec(item.Nid, item.Tid, item.Title, item.Summary, string(img), item.CreateTime)
+	_, err = state.ExecContext(ctx, item.Nid, item.Tid, item.Title, item.Summary, string(img), item.CreateTime)
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
-	} else {
-		tx.Commit()
-		stdio.LogVerbose("", "向数据库插入新新闻成功")
-		return stdio.GetEmptyErrorMessage()
+		return wrapError("新闻写入失败", err)
 	}
+	stdio.LogVerbose("", "向数据库插入新新闻成功")
+	return nil
 }
 
-func (newsManagerImpl newsManagerImpl) GetHeadlines() (Headlines, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
-	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return Headlines{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	state, err := tx.Prepare("select `h_id`,`h_type_id`,`h_image`,`h_expired` from `news_headline` order by `h_id` desc")
+func (newsManagerImpl newsManagerImpl) GetHeadlines(ctx context.Context) (Headlines, error) {
+	state, err := unit.Prepare(ctx, "select `h_id`,`h_type_id`,`h_image`,`h_expired` from `news_headline` order by `h_id` desc")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return Headlines{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return Headlines{}, wrapError("头条新闻查询失败", err)
 	}
-	rows, err := state.Query()
+	rows, err := state.QueryContext(ctx)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			tx.Commit()
-			stdio.LogInfo("", "头条新闻数据不存在")
-			return Headlines{}, stdio.GetEmptyErrorMessage()
-		} else {
-			_ = tx.Rollback()
-			stdio.LogWarn("", "数据库SQL指令执行失败", err)
-			return Headlines{}, stdio.GetErrorMessage(-500, "请求处理出错")
-		}
+		return Headlines{}, wrapError("头条新闻查询失败", err)
 	}
 	expired := false
 	var items []NewsItem
@@ -145,15 +157,8 @@ func (newsManagerImpl newsManagerImpl) GetHeadlines() (Headlines, stdio.Messaged
 		image := ""
 		err = rows.Scan(&item.Nid, &item.Tid, &image, &itemExpired)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				tx.Commit()
-				stdio.LogInfo("", "头条新闻详情不存在")
-				return Headlines{}, stdio.GetEmptyErrorMessage()
-			} else {
-				_ = tx.Rollback()
-				stdio.LogWarn("", "数据库SQL指令执行失败", err)
-				return Headlines{}, stdio.GetErrorMessage(-500, "请求处理出错")
-			}
+			_ = rows.Close()
+			return Headlines{}, wrapError("头条新闻查询失败", err)
 		}
 		item.Images = []string{image}
 		if !expired && itemExpired < time.Now().Unix() {
@@ -162,16 +167,24 @@ func (newsManagerImpl newsManagerImpl) GetHeadlines() (Headlines, stdio.Messaged
 		}
 		items = append(items, item)
 	}
+	err = rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		return Headlines{}, wrapError("头条新闻查询失败", err)
+	}
 	if items == nil {
 		stdio.LogInfo("", "头条新闻详情不存在")
-		return Headlines{}, stdio.GetEmptyErrorMessage()
+		return Headlines{}, nil
 	}
 	var itemResult []NewsItem
-	tx.Commit()
 	for _, item := range items {
-		localItem, errMessage := NewsManager.GetNewsById(item.Tid, item.Nid)
-		if errMessage.HasInfo {
-			return Headlines{}, stdio.GetEmptyErrorMessage()
+		localItem, err := NewsManager.GetNewsById(ctx, item.Tid, item.Nid)
+		if err == ErrNotFound {
+			stdio.LogInfo("", "头条新闻详情不存在")
+			return Headlines{}, nil
+		}
+		if err != nil {
+			return Headlines{}, err
 		}
 		item.Title = localItem.Title
 		item.Summary = localItem.Summary
@@ -181,181 +194,307 @@ func (newsManagerImpl newsManagerImpl) GetHeadlines() (Headlines, stdio.Messaged
 		Exist:   true,
 		Expired: expired,
 		News:    itemResult,
-	}, stdio.GetEmptyErrorMessage()
+	}, nil
 }
 
-func (newsManagerImpl newsManagerImpl) UpdateHeadlines(headlines []NewsItem) stdio.MessagedError {
-	tx, err := unit.Maria.Begin()
+// UpdateHeadlines 在同一事务中替换全部头条新闻
+func (newsManagerImpl newsManagerImpl) UpdateHeadlines(ctx context.Context, headlines []NewsItem) error {
+	tx, err := unit.DB.BeginTx(ctx, nil)
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("数据库开始事务失败", err)
 	}
 	//goland:noinspection SqlWithoutWhere
-	state, err := tx.Prepare("delete from `news_headline`")
+	state, err := unit.PrepareTx(ctx, tx, "delete from `news_headline`")
+	if err == nil {
+		_, err = state.ExecContext(ctx)
+	}
 	if err != nil {
 		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("头条新闻清空失败", err)
 	}
-	_, err = state.Exec()
+	state, err = unit.PrepareTx(ctx, tx, "insert into `news_headline` (`h_id`,`h_type_id`,`h_image`,`h_expired`) values (?, ?, ?, ?)")
 	if err != nil {
 		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
-	} else {
-		tx.Commit()
+		return wrapError("头条新闻写入失败", err)
 	}
 	for _, item := range headlines {
-		tx, err := unit.Maria.Begin()
-		if err != nil {
-			stdio.LogWarn("", "数据库开始事务失败", err)
-			return stdio.GetErrorMessage(-500, "请求处理出错")
-		}
-		state, err := tx.Prepare("insert into `news_headline` (`h_id`,`h_type_id`,`h_image`,`h_expired`) values (?, ?, ?, ?)")
-		if err != nil {
-			_ = tx.Rollback()
-			stdio.LogWarn("", "数据库准备SQL指令失败", err)
-			return stdio.GetErrorMessage(-500, "请求处理出错")
-		}
-		_, err = state.Exec(item.Nid, item.Tid, item.Images[0], time.Now().Unix()+86400)
+		_, err = state.ExecContext(ctx, item.Nid, item.Tid, item.Images[0], time.Now().Unix()+86400)
 		if err != nil {
 			_ = tx.Rollback()
-			stdio.LogWarn("", "数据库准备SQL指令失败", err)
-			return stdio.GetErrorMessage(-500, "请求处理出错")
-		} else {
-			stdio.LogInfo("", "向数据库更新头条新闻成功")
-			tx.Commit()
+			return wrapError("头条新闻写入失败", err)
 		}
 	}
-	return stdio.GetEmptyErrorMessage()
-}
-
-func (newsManagerImpl newsManagerImpl) CheckNewsExist(tid int, nid int) (bool, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+	err = tx.Commit()
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("数据库提交事务失败", err)
 	}
-	var state *sql.Stmt
-	state, err = tx.Prepare("select `n_id` from `news` where `n_id`=? and `n_type_id`=?")
+	stdio.LogInfo("", "向数据库更新头条新闻成功")
+	return nil
+}
+
+func (newsManagerImpl newsManagerImpl) CheckNewsExist(ctx context.Context, tid int, nid int) (bool, error) {
+	return checkNewsRowExist(ctx, "select `n_id` from `news` where `n_id`=? and `n_type_id`=?", nid, tid)
+}
+
+func checkNewsRowExist(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	state, err := unit.Prepare(ctx, query)
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return false, wrapError("新闻查询失败", err)
 	}
-	rows := state.QueryRow(nid, tid)
 	id := -1
-	err = rows.Scan(&id)
-	if err == nil {
-		tx.Commit()
-		return id != -1, stdio.GetEmptyErrorMessage()
-	}
+	err = state.QueryRowContext(ctx, args...).Scan(&id)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return false, stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return false, nil
 	}
-}
-
-func (newsManagerImpl newsManagerImpl) GetTypeChart() ([]NewsTypeChartItem, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
+		return false, wrapError("新闻查询失败", err)
 	}
-	var state *sql.Stmt
-	state, err = tx.Prepare("select * from `news_chart`")
+	return id != -1, nil
+}
+
+func (newsManagerImpl newsManagerImpl) GetTypeChart(ctx context.Context) ([]NewsTypeChartItem, error) {
+	state, err := unit.Prepare(ctx, "select `n_type_id`,`n_name`,`n_out` from `news_chart`")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
+		return nil, wrapError("新闻类型字典查询失败", err)
 	}
-	rows, err := state.Query()
+	rows, err := state.QueryContext(ctx)
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
+		return nil, wrapError("新闻类型字典查询失败", err)
 	}
+	defer rows.Close()
 	var charts []NewsTypeChartItem
 	for rows.Next() {
 		chart := NewsTypeChartItem{}
 		err = rows.Scan(&chart.TypeId, &chart.TypeName, &chart.Out)
 		if err != nil {
-			_ = tx.Rollback()
-			stdio.LogWarn("", "数据库SQL指令执行失败", err)
-			return nil, stdio.GetErrorMessage(-500, "请求处理出错")
+			return nil, wrapError("新闻类型字典查询失败", err)
 		}
 		charts = append(charts, chart)
 	}
-	return charts, stdio.GetEmptyErrorMessage()
+	if err = rows.Err(); err != nil {
+		return nil, wrapError("新闻类型字典查询失败", err)
+	}
+	return charts, nil
 }
 
-func (newsManagerImpl newsManagerImpl) UpdateTypeChart(chart []NewsTypeChartItem) stdio.MessagedError {
+func (newsManagerImpl newsManagerImpl) UpdateTypeChart(ctx context.Context, chart []NewsTypeChartItem) error {
 	for _, item := range chart {
-		exist, errMessage := NewsManager.CheckChartExist(item.TypeId)
-		if errMessage.HasInfo {
-			return errMessage
-		}
-		tx, err := unit.Maria.Begin()
+		exist, err := NewsManager.CheckChartExist(ctx, item.TypeId)
 		if err != nil {
-			stdio.LogWarn("", "数据库开始事务失败", err)
-			return stdio.GetErrorMessage(-500, "请求处理出错")
+			return err
 		}
 		var state *sql.Stmt
 		if exist {
-			state, err = tx.Prepare("update `news_chart` set `n_name`=? where `n_type_id`=?")
+			state, err = unit.Prepare(ctx, "update `news_chart` set `n_name`=? where `n_type_id`=?")
 		} else {
-			state, err = tx.Prepare("insert into `news_chart` (`n_name`, `n_type_id`) values (?, ?)")
+			state, err = unit.Prepare(ctx, "insert into `news_chart` (`n_name`, `n_type_id`) values (?, ?)")
 		}
 		if err != nil {
-			stdio.LogWarn("", "数据库准备SQL指令失败", err)
-			return stdio.GetErrorMessage(-500, "请求处理出错")
+			return wrapError("新闻类型字典写入失败", err)
 		}
-		_, err = state.Exec(item.TypeName, item.TypeId)
+		_, err = state.ExecContext(ctx, item.TypeName, item.TypeId)
 		if err != nil {
-			_ = tx.Rollback()
-			stdio.LogWarn("", "数据库SQL指令执行失败", err)
-			return stdio.GetErrorMessage(-500, "请求处理出错")
+			return wrapError("新闻类型字典写入失败", err)
 		}
-		tx.Commit()
 		if exist {
-			stdio.LogInfo("", "向数据库插入新新闻类型字典成功")
-		} else {
 			stdio.LogInfo("", "向数据库更新新闻类型字典成功")
+		} else {
+			stdio.LogInfo("", "向数据库插入新新闻类型字典成功")
 		}
 	}
-	return stdio.GetEmptyErrorMessage()
+	return nil
 }
 
-func (newsManagerImpl newsManagerImpl) CheckChartExist(nTypeId int) (bool, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+func (newsManagerImpl newsManagerImpl) CheckChartExist(ctx context.Context, nTypeId int) (bool, error) {
+	return checkNewsRowExist(ctx, "select `n_type_id` from `news_chart` where `n_type_id`=?", nTypeId)
+}
+
+// GetHeadlinesExpired 返回头条新闻中最早的过期时间，无头条数据时返回 0
+func (newsManagerImpl newsManagerImpl) GetHeadlinesExpired(ctx context.Context) (int64, error) {
+	state, err := unit.Prepare(ctx, "select min(`h_expired`) from `news_headline`")
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return 0, wrapError("头条新闻查询失败", err)
 	}
-	var state *sql.Stmt
-	state, err = tx.Prepare("select `n_type_id` from `news_chart` where `n_type_id`=?")
+	expired := sql.NullInt64{}
+	err = state.QueryRowContext(ctx).Scan(&expired)
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return 0, wrapError("头条新闻查询失败", err)
 	}
-	rows := state.QueryRow(nTypeId)
-	id := ""
-	err = rows.Scan(&id)
-	if err == nil {
-		tx.Commit()
-		return id != "", stdio.GetEmptyErrorMessage()
+	return expired.Int64, nil
+}
+
+func (newsManagerImpl newsManagerImpl) GetContent(ctx context.Context, tid int, nid int) (NewsContent, error) {
+	state, err := unit.Prepare(ctx, "select `n_content`,`n_extra`,`n_expired` from `news_content` where `n_id`=? and `n_type_id`=?")
+	if err != nil {
+		return NewsContent{}, wrapError("新闻正文查询失败", err)
 	}
+	content := NewsContent{}
+	extra := ""
+	var expired int64
+	err = state.QueryRowContext(ctx, nid, tid).Scan(&content.Content.Content, &extra, &expired)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return false, stdio.GetEmptyErrorMessage()
+		return NewsContent{}, nil
+	}
+	if err != nil {
+		return NewsContent{}, wrapError("新闻正文查询失败", err)
+	}
+	err = json.Unmarshal([]byte(extra), &content.Content)
+	if err != nil {
+		return NewsContent{}, wrapError("新闻附件数据解析失败", err)
+	}
+	content.Exist = true
+	content.Expired = expired < time.Now().Unix()
+	return content, nil
+}
+
+func (newsManagerImpl newsManagerImpl) UpdateContent(ctx context.Context, tid int, nid int, content NewsContentObject) error {
+	extra, err := json.Marshal(struct {
+		Images      []string         `json:"images"`
+		Attachments []NewsAttachment `json:"attachments"`
+	}{
+		Images:      content.Images,
+		Attachments: content.Attachments,
+	})
+	if err != nil {
+		return err
+	}
+	exist, err := checkNewsRowExist(ctx, "select `n_id` from `news_content` where `n_id`=? and `n_type_id`=?", nid, tid)
+	if err != nil {
+		return err
+	}
+	var state *sql.Stmt
+	if !exist {
+		state, err = unit.Prepare(ctx, "insert into `news_content` (`n_content`, `n_extra`, `n_expired`, `n_id`, `n_type_id`) values (?, ?, ?, ?, ?)")
 	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
+		state, err = unit.Prepare(ctx, "update `news_content` set `n_content`=?, `n_extra`=?, `n_expired`=? where `n_id`=? and `n_type_id`=?")
+	}
+	if err != nil {
+		return wrapError("新闻正文写入失败", err)
+	}
+	_, err = state.ExecContext(ctx, content.Content, string(extra), time.Now().Unix()+604800, nid, tid)
+	if err != nil {
+		return wrapError("新闻正文写入失败", err)
+	}
+	stdio.LogVerbose("", "向数据库更新新闻正文成功")
+	return nil
+}
+
+// SearchNews 按关键词搜索已缓存的新闻，每个关键词须出现在标题、简介或正文中，
+// 标题命中权重为 3，简介为 2，正文为 1，得分相同时按发布时间倒序排列
+func (newsManagerImpl newsManagerImpl) SearchNews(ctx context.Context, query NewsSearchQuery) ([]NewsItem, bool, error) {
+	var scores []string
+	var conditions []string
+	var scoreArgs []interface{}
+	var conditionArgs []interface{}
+	for _, keyword := range query.Keywords {
+		pattern := "%" + escapeLike(keyword) + "%"
+		like := "like ?" + unit.Dialect.LikeEscape()
+		scores = append(scores, "(n.`n_title` "+like+")*3 + (n.`n_summary` "+like+")*2 + (ifnull(c.`n_content`, '') "+like+")")
+		scoreArgs = append(scoreArgs, pattern, pattern, pattern)
+		conditions = append(conditions, "(n.`n_title` "+like+" or n.`n_summary` "+like+" or c.`n_content` "+like+")")
+		conditionArgs = append(conditionArgs, pattern, pattern, pattern)
+	}
+	if query.Tid >= 0 {
+		conditions = append(conditions, "n.`n_type_id`=?")
+		conditionArgs = append(conditionArgs, query.Tid)
+	}
+	if query.Start != "" {
+		conditions = append(conditions, "n.`n_create_time`>=?")
+		conditionArgs = append(conditionArgs, query.Start)
+	}
+	if query.End != "" {
+		conditions = append(conditions, "n.`n_create_time`<=?")
+		conditionArgs = append(conditionArgs, query.End)
+	}
+	if len(scores) == 0 {
+		scores = append(scores, "0")
+	}
+	if len(conditions) == 0 {
+		conditions = append(conditions, "1=1")
+	}
+	args := append(scoreArgs, conditionArgs...)
+	args = append(args, query.Size+1, query.Page*query.Size)
+
+	state, err := unit.Prepare(ctx, "select n.`n_id`,n.`n_type_id`,n.`n_images`,n.`n_title`,n.`n_summary`,n.`n_create_time`, "+
+		strings.Join(scores, " + ")+" as `n_score` from `news` n left join `news_content` c on c.`n_id`=n.`n_id` and c.`n_type_id`=n.`n_type_id` where "+
+		strings.Join(conditions, " and ")+" order by `n_score` desc, n.`n_create_time` desc, n.`n_id` desc limit ? offset ?")
+	if err != nil {
+		return nil, false, wrapError("新闻搜索失败", err)
+	}
+	rows, err := state.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, false, wrapError("新闻搜索失败", err)
+	}
+	defer rows.Close()
+	items := make([]NewsItem, 0)
+	for rows.Next() {
+		item := NewsItem{}
+		images := ""
+		var score int
+		err = rows.Scan(&item.Nid, &item.Tid, &images, &item.Title, &item.Summary, &item.CreateTime, &score)
+		if err != nil {
+			return nil, false, wrapError("新闻搜索失败", err)
+		}
+		err = json.Unmarshal([]byte(images), &item)
+		if err != nil {
+			stdio.LogWarn("", "新闻图片数据解析失败", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, false, wrapError("新闻搜索失败", err)
+	}
+	hasNext := len(items) > query.Size
+	if hasNext {
+		items = items[:query.Size]
+	}
+	return items, hasNext, nil
+}
+
+func escapeLike(keyword string) string {
+	keyword = strings.ReplaceAll(keyword, "\\", "\\\\")
+	keyword = strings.ReplaceAll(keyword, "%", "\\%")
+	keyword = strings.ReplaceAll(keyword, "_", "\\_")
+	return keyword
+}
+
+// ListNews 返回指定类别中已缓存的新闻，按发布时间、ID 倒序排列
+func (newsManagerImpl newsManagerImpl) ListNews(ctx context.Context, query NewsListQuery) ([]NewsItem, error) {
+	tid := query.Tid
+	condition := "`n_type_id`=?"
+	args := []interface{}{tid}
+	if query.After.Valid {
+		condition += " and (`n_create_time`<? or (`n_create_time`=? and `n_id`<?))"
+		args = append(args, query.After.CreateTime, query.After.CreateTime, query.After.Nid)
+	}
+	args = append(args, query.Size, query.Offset)
+	state, err := unit.Prepare(ctx, "select `n_id`,`n_images`,`n_title`,`n_summary`,`n_create_time` from `news` where "+condition+" order by `n_create_time` desc, `n_id` desc limit ? offset ?")
+	if err != nil {
+		return nil, wrapError("新闻列表查询失败", err)
+	}
+	rows, err := state.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, wrapError("新闻列表查询失败", err)
+	}
+	defer rows.Close()
+	items := make([]NewsItem, 0)
+	for rows.Next() {
+		item := NewsItem{Tid: tid}
+		images := ""
+		err = rows.Scan(&item.Nid, &images, &item.Title, &item.Summary, &item.CreateTime)
+		if err != nil {
+			return nil, wrapError("新闻列表查询失败", err)
+		}
+		err = json.Unmarshal([]byte(images), &item)
+		if err != nil {
+			stdio.LogWarn("", "新闻图片数据解析失败", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError("新闻列表查询失败", err)
 	}
-	return false, stdio.GetErrorMessage(-500, "请求处理出错")
+	return items, nil
 }
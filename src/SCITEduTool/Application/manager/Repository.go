@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"SCITEduTool/Application/stdio"
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// 各 XxxRepository 接口为数据访问层，方法均接收请求的 context，客户端断开时进行中的查询随之取消。
+// XxxManager 变量默认为基于 unit.DB 的实现，测试时可替换为内存实现
+
+// ErrNotFound 目标记录不存在
+var ErrNotFound = errors.New("记录不存在")
+
+// RepositoryError 数据访问失败，Op 为失败的操作，可通过 errors.Is 判断是否由 context 取消导致
+type RepositoryError struct {
+	Op  string
+	Err error
+}
+
+func (repositoryError *RepositoryError) Error() string {
+	return repositoryError.Op + "，信息：" + repositoryError.Err.Error()
+}
+
+func (repositoryError *RepositoryError) Unwrap() error {
+	return repositoryError.Err
+}
+
+func wrapError(op string, err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return &RepositoryError{
+		Op:  op,
+		Err: err,
+	}
+}
+
+// ErrorMessage 将仓库返回的错误记录日志并转换为接口错误信息，err 为 nil 时返回空错误信息
+func ErrorMessage(username string, err error) stdio.MessagedError {
+	switch {
+	case err == nil:
+		return stdio.GetEmptyErrorMessage()
+	case errors.Is(err, context.Canceled):
+		stdio.LogDebug(username, "请求已取消", err)
+		return stdio.GetErrorMessage(-499, "请求已取消")
+	case errors.Is(err, context.DeadlineExceeded):
+		stdio.LogWarn(username, "请求超时", err)
+		return stdio.GetErrorMessage(-504, "请求超时")
+	case errors.Is(err, ErrNotFound):
+		stdio.LogInfo(username, "请求的数据不存在")
+		return stdio.GetErrorMessage(-404, "数据不存在")
+	default:
+		stdio.LogWarn(username, "数据访问失败", err)
+		return stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+}
@@ -3,20 +3,23 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"database/sql"
+	"errors"
+	"strconv"
 	"time"
 )
 
-type sessionManager interface {
-	Get(username string) (SessionItem, stdio.MessagedError)
-	Update(username string, password string, session string, identify int) stdio.MessagedError
-	GetUserPassword(username string, password string) (string, stdio.MessagedError)
-	CheckUserExist(username string, table string) (bool, stdio.MessagedError)
+type SessionRepository interface {
+	Get(ctx context.Context, username string) (SessionItem, error)
+	Update(ctx context.Context, username string, password string, session string, identify int) error
+	GetUserPassword(ctx context.Context, username string, password string) (string, error)
+	CheckUserExist(ctx context.Context, username string, table string) (bool, error)
 }
 
 type sessionManagerImpl struct{}
 
-var SessionManager sessionManager = sessionManagerImpl{}
+var SessionManager SessionRepository = sessionManagerImpl{}
 
 type userSessionItem struct {
 	Session   string
@@ -32,63 +35,35 @@ type SessionItem struct {
 	Effective bool
 }
 
-func (sessionManagerImpl sessionManagerImpl) Get(username string) (SessionItem, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+func (sessionManagerImpl sessionManagerImpl) Get(ctx context.Context, username string) (SessionItem, error) {
+	state, err := unit.Prepare(ctx, "select `u_session`,`u_session_expired`,`u_token_effective` from `user_token` where `u_id`=?")
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return SessionItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return SessionItem{}, wrapError("用户会话查询失败", err)
 	}
-	state, err := tx.Prepare("select `u_session`,`u_session_expired`,`u_token_effective` from `user_token` where `u_id`=?")
-	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return SessionItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	rows := state.QueryRow(username)
 	var item userSessionItem
-	err = rows.Scan(&item.Session, &item.Expired, &item.Effective)
-	//err := rows.Scan(&item)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			tx.Commit()
-			stdio.LogInfo(username, "用户不存在")
-			return SessionItem{}, stdio.GetEmptyErrorMessage()
-		} else {
-			_ = tx.Rollback()
-			stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-			return SessionItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-		}
+	err = state.QueryRowContext(ctx, username).Scan(&item.Session, &item.Expired, &item.Effective)
+	if err == sql.ErrNoRows {
+		stdio.LogInfo(username, "用户不存在")
+		return SessionItem{}, nil
 	}
-	tx.Commit()
-	tx, err = unit.Maria.Begin()
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return SessionItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return SessionItem{}, wrapError("用户会话查询失败", err)
 	}
-	state, err = tx.Prepare("select `u_identify` from `user_info` where `u_id`=?")
+	state, err = unit.Prepare(ctx, "select `u_identify` from `user_info` where `u_id`=?")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return SessionItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return SessionItem{}, wrapError("用户身份查询失败", err)
 	}
-	rows = state.QueryRow(username)
 	identify := -1
-	err = rows.Scan(&identify)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			tx.Commit()
-			stdio.LogInfo(username, "用户身份未知")
-			return SessionItem{}, stdio.GetEmptyErrorMessage()
-		} else {
-			_ = tx.Rollback()
-			stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-			return SessionItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-		}
-	}
-	tx.Commit()
+	err = state.QueryRowContext(ctx, username).Scan(&identify)
+	if err == sql.ErrNoRows {
+		stdio.LogInfo(username, "用户身份未知")
+		return SessionItem{}, nil
+	}
+	if err != nil {
+		return SessionItem{}, wrapError("用户身份查询失败", err)
+	}
 	if identify < 0 {
-		stdio.LogWarn(username, "用户身份获取失败", nil)
-		return SessionItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return SessionItem{}, wrapError("用户身份查询失败", errors.New("identify: "+strconv.Itoa(identify)))
 	}
 	if item.Session != "" {
 		return SessionItem{
@@ -97,152 +72,109 @@ func (sessionManagerImpl sessionManagerImpl) Get(username string) (SessionItem,
 			Exist:     true,
 			Effective: item.Effective == 1,
 			Expired:   item.Expired < time.Now().Unix(),
-		}, stdio.GetEmptyErrorMessage()
+		}, nil
 	} else {
 		return SessionItem{
 			Exist: false,
-		}, stdio.GetEmptyErrorMessage()
+		}, nil
 	}
 }
 
-func (sessionManagerImpl sessionManagerImpl) Update(username string, password string, session string, identify int) stdio.MessagedError {
-	exist, errMessage := SessionManager.CheckUserExist(username, "user_token")
-	if errMessage.HasInfo {
-		return errMessage
+// Update 在同一事务中写入用户会话与身份
+func (sessionManagerImpl sessionManagerImpl) Update(ctx context.Context, username string, password string, session string, identify int) error {
+	tokenExist, err := SessionManager.CheckUserExist(ctx, username, "user_token")
+	if err != nil {
+		return err
+	}
+	infoExist, err := SessionManager.CheckUserExist(ctx, username, "user_info")
+	if err != nil {
+		return err
 	}
-	tx, err := unit.Maria.Begin()
+	tx, err := unit.DB.BeginTx(ctx, nil)
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("数据库开始事务失败", err)
 	}
 	var state *sql.Stmt
-	if !exist {
-		state, err = tx.Prepare("insert into `user_token` (`u_id`, `u_password` ,`u_session`, `u_session_expired`, `u_token_effective`) values (?, ?, ?, ?, 1)")
+	if !tokenExist {
+		state, err = unit.PrepareTx(ctx, tx, "insert into `user_token` (`u_id`, `u_password` ,`u_session`, `u_session_expired`, `u_token_effective`) values (?, ?, ?, ?, 1)")
 	} else {
-		state, err = tx.Prepare("update `user_token` set `u_session`=?, `u_session_expired`=?, `u_token_effective`=1, `u_password`=? where `u_id`=?")
+		state, err = unit.PrepareTx(ctx, tx, "update `user_token` set `u_session`=?, `u_session_expired`=?, `u_token_effective`=1, `u_password`=? where `u_id`=?")
 	}
 	if err != nil {
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		_ = tx.Rollback()
+		return wrapError("用户会话写入失败", err)
 	}
-	if !exist {
-		_, err = state.Exec(username, password, session, time.Now().Unix()+1800)
-	} else {
-		_, err = state.Exec(session, time.Now().Unix()+1800, password, username)
-	}
-	if err == nil {
-		tx.Commit()
-		if !exist {
-			stdio.LogVerbose(username, "向数据库插入新 ASP.NET_SessionId 成功")
-		} else {
-			stdio.LogVerbose(username, "向数据库更新 ASP.NET_SessionId 成功")
-		}
+	if !tokenExist {
+		_, err = state.ExecContext(ctx, username, password, session, time.Now().Unix()+1800)
 	} else {
+		_, err = state.ExecContext(ctx, session, time.Now().Unix()+1800, password, username)
+	}
+	if err != nil {
 		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("用户会话写入失败", err)
 	}
-
-	exist, errMessage = SessionManager.CheckUserExist(username, "user_info")
-	if errMessage.HasInfo {
-		return errMessage
+	if !infoExist {
+		state, err = unit.PrepareTx(ctx, tx, "insert into `user_info` (`u_id`, `u_identify`, `u_info_expired`) values (?, ?, 0)")
+	} else {
+		state, err = unit.PrepareTx(ctx, tx, "update `user_info` set `u_identify`=? where `u_id`=?")
 	}
-	tx, err = unit.Maria.Begin()
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		_ = tx.Rollback()
+		return wrapError("用户身份写入失败", err)
 	}
-	if !exist {
-		state, err = tx.Prepare("insert into `user_info` (`u_id`, `u_identify`, `u_info_expired`) values (?, ?, 0)")
+	if !infoExist {
+		_, err = state.ExecContext(ctx, username, identify)
 	} else {
-		state, err = tx.Prepare("update `user_info` set `u_identify`=? where `u_id`=?")
+		_, err = state.ExecContext(ctx, identify, username)
 	}
 	if err != nil {
 		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("用户身份写入失败", err)
 	}
-	if !exist {
-		_, err = state.Exec(username, identify)
-	} else {
-		_, err = state.Exec(identify, username)
-	}
-	if err == nil {
-		tx.Commit()
-		if !exist {
-			stdio.LogVerbose(username, "向数据库插入新用户身份成功")
-		} else {
-			stdio.LogVerbose(username, "向数据库更新用户身份成功")
-		}
-		return stdio.GetEmptyErrorMessage()
+	err = tx.Commit()
+	if err != nil {
+		return wrapError("数据库提交事务失败", err)
+	}
+	if !tokenExist {
+		stdio.LogVerbose(username, "向数据库插入新 ASP.NET_SessionId 成功")
 	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库查询失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		stdio.LogVerbose(username, "向数据库更新 ASP.NET_SessionId 成功")
 	}
+	return nil
 }
 
-func (sessionManagerImpl sessionManagerImpl) GetUserPassword(username string, password string) (string, stdio.MessagedError) {
-	pass := password
-	if pass == "" {
-		tx, err := unit.Maria.Begin()
-		if err != nil {
-			stdio.LogWarn(username, "数据库开始事务失败", err)
-			return "", stdio.GetErrorMessage(-500, "请求处理出错")
-		}
-		var state *sql.Stmt
-		state, err = tx.Prepare("select `u_password` from `user_token` where `u_id`=?")
-		if err != nil {
-			_ = tx.Rollback()
-			stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-			return "", stdio.GetErrorMessage(-500, "请求处理出错")
-		}
-		rows := state.QueryRow(username)
-		err = rows.Scan(&pass)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				tx.Commit()
-				return "", stdio.GetEmptyErrorMessage()
-			} else {
-				_ = tx.Rollback()
-				stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-				return "", stdio.GetErrorMessage(-500, "请求处理出错")
-			}
-		}
-		tx.Commit()
-		if pass == "" {
-			return "", stdio.GetEmptyErrorMessage()
-		}
-	}
-	return pass, stdio.GetEmptyErrorMessage()
-}
-
-func (sessionManagerImpl sessionManagerImpl) CheckUserExist(username string, table string) (bool, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+// GetUserPassword password 不为空时直接返回，否则返回数据库中保存的密码，用户不存在时返回空字符串
+func (sessionManagerImpl sessionManagerImpl) GetUserPassword(ctx context.Context, username string, password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	state, err := unit.Prepare(ctx, "select `u_password` from `user_token` where `u_id`=?")
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", wrapError("用户密码查询失败", err)
+	}
+	err = state.QueryRowContext(ctx, username).Scan(&password)
+	if err == sql.ErrNoRows {
+		return "", nil
 	}
-	var state *sql.Stmt
-	state, err = tx.Prepare("select `u_id` from `" + table + "` where `u_id`=?")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", wrapError("用户密码查询失败", err)
 	}
-	rows := state.QueryRow(username)
-	id := ""
-	err = rows.Scan(&id)
-	if err == nil {
-		tx.Commit()
-		return id != "", stdio.GetEmptyErrorMessage()
+	return password, nil
+}
+
+// CheckUserExist table 须为程序内的常量表名
+func (sessionManagerImpl sessionManagerImpl) CheckUserExist(ctx context.Context, username string, table string) (bool, error) {
+	state, err := unit.Prepare(ctx, "select `u_id` from `"+table+"` where `u_id`=?")
+	if err != nil {
+		return false, wrapError("用户记录查询失败", err)
 	}
+	id := ""
+	err = state.QueryRowContext(ctx, username).Scan(&id)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return false, stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库SQL指令执行失败", err)
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapError("用户记录查询失败", err)
 	}
-	return false, stdio.GetErrorMessage(-500, "请求处理出错")
+	return id != "", nil
 }
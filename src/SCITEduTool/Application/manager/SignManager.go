@@ -3,33 +3,53 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"net/http"
 	"sort"
+	"strings"
 )
 
-type signManager interface {
+type SignRepository interface {
 	InsertParameter(request *http.Request, parameter map[string]string) (map[string]string, bool, stdio.MessagedError)
-	GetDefaultAppKey() string
-	GetAppSecretByAppKey(appKey string, platform string) string
-	GetDefaultAppSecretByPlatform(platform string) string
+	GetDefaultAppKey(ctx context.Context) (string, error)
+	GetAppSecretByAppKey(ctx context.Context, appKey string, platform string) (string, error)
+	GetDefaultAppSecretByPlatform(ctx context.Context, platform string) (string, error)
+	InitSubscription(conf SubscriptionConfig)
+	GetSubscriptionSign(path string, parameter map[string]string) string
+	GetSubscriptionVersion(ctx context.Context, username string) (int, error)
+	RevokeSubscription(ctx context.Context, username string) error
 }
 
 type signManagerImpl struct{}
 
-var SignManager signManager = signManagerImpl{}
+var SignManager SignRepository = signManagerImpl{}
+
+// SubscriptionConfig 日历订阅配置，secret 为订阅链接的签名密钥，仅服务端持有，不下发至任何客户端
+type SubscriptionConfig struct {
+	Secret string `json:"secret"`
+}
+
+var subscriptionSecret []byte
 
 func (signManagerImpl signManagerImpl) InsertParameter(request *http.Request, parameter map[string]string) (map[string]string, bool, stdio.MessagedError) {
 	if parameter == nil {
 		parameter = make(map[string]string)
 	}
+	ctx := request.Context()
 	//IF !DEBUG
+	defaultAppKey, err := SignManager.GetDefaultAppKey(ctx)
+	if err != nil {
+		return nil, false, ErrorMessage("", err)
+	}
 	parameter["ts"] = ""
 	parameter["sign"] = ""
 	parameter["platform"] = "web"
-	parameter["app_key"] = SignManager.GetDefaultAppKey()
+	parameter["app_key"] = defaultAppKey
 	//ENDIF
 	parString := ""
 	var parameterKeys []string
@@ -61,7 +81,10 @@ func (signManagerImpl signManagerImpl) InsertParameter(request *http.Request, pa
 	//IF DEBUG
 	//	return parameter, true, StdOutUnit.GetEmptyErrorMessage()
 	//ENDIF
-	appSecret := SignManager.GetAppSecretByAppKey(parameter["app_key"], parameter["platform"])
+	appSecret, err := SignManager.GetAppSecretByAppKey(ctx, parameter["app_key"], parameter["platform"])
+	if err != nil {
+		return nil, false, ErrorMessage("", err)
+	}
 	if appSecret == "" {
 		stdio.LogDebug("", parameter["app_key"], nil)
 		stdio.LogDebug("", parameter["platform"], nil)
@@ -93,89 +116,113 @@ func getParameter(request *http.Request, key string) string {
 	return value
 }
 
-func (signManagerImpl signManagerImpl) GetDefaultAppKey() string {
-	tx, err := unit.Maria.Begin()
+// querySignKey 查询签名密钥表，不存在时返回空字符串
+func querySignKey(ctx context.Context, query string, args ...interface{}) (string, error) {
+	state, err := unit.Prepare(ctx, query)
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return ""
+		return "", wrapError("应用密钥查询失败", err)
+	}
+	value := ""
+	err = state.QueryRowContext(ctx, args...).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
 	}
-	state, err := tx.Prepare("select `app_key` from `sign_keys` where `platform`='web' order by `build` desc limit 1")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
+		return "", wrapError("应用密钥查询失败", err)
+	}
+	return value, nil
+}
+
+func (signManagerImpl signManagerImpl) GetDefaultAppKey(ctx context.Context) (string, error) {
+	return querySignKey(ctx, "select `app_key` from `sign_keys` where `platform`='web' order by `build` desc limit 1")
+}
+
+func (signManagerImpl signManagerImpl) GetAppSecretByAppKey(ctx context.Context, appKey string, platform string) (string, error) {
+	return querySignKey(ctx, "select `app_secret` from `sign_keys` where `app_key`=? and `platform`=?", appKey, platform)
+}
+
+func (signManagerImpl signManagerImpl) GetDefaultAppSecretByPlatform(ctx context.Context, platform string) (string, error) {
+	return querySignKey(ctx, "select `app_secret` from `sign_keys` where `platform`=? order by `build` desc limit 1", platform)
+}
+
+func (signManagerImpl signManagerImpl) InitSubscription(conf SubscriptionConfig) {
+	if len(conf.Secret) < 32 || strings.Contains(conf.Secret, "//") {
+		stdio.LogWarn("", "订阅签名密钥未配置或长度不足32位，日历订阅将不可用", nil)
+		subscriptionSecret = nil
+		return
+	}
+	subscriptionSecret = []byte(conf.Secret)
+	stdio.LogVerbose("", "日历订阅配置成功")
+}
+
+// GetSubscriptionSign 使用仅服务端持有的订阅密钥计算 HMAC-SHA256 订阅签名，签名内容为 path?排序后的参数，
+// 绑定订阅的资源路径，避免课表订阅签名被用于其它订阅。parameter 需包含用户当前的订阅版本 v，
+// 未配置订阅密钥时返回空字符串
+func (signManagerImpl signManagerImpl) GetSubscriptionSign(path string, parameter map[string]string) string {
+	if subscriptionSecret == nil {
 		return ""
 	}
-	rows := state.QueryRow()
-	appKey := ""
-	err = rows.Scan(&appKey)
-	if err == nil {
-		tx.Commit()
-		return appKey
+	parString := ""
+	var parameterKeys []string
+	for key := range parameter {
+		if key == "sign" {
+			continue
+		}
+		parameterKeys = append(parameterKeys, key)
 	}
-	if err == sql.ErrNoRows {
-		tx.Commit()
-		return ""
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return ""
+	sort.Strings(parameterKeys)
+	for _, key := range parameterKeys {
+		if parString != "" {
+			parString += "&"
+		}
+		parString += key + "=" + parameter[key]
 	}
+	h := hmac.New(sha256.New, subscriptionSecret)
+	h.Write([]byte(path + "?" + parString))
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-func (signManagerImpl signManagerImpl) GetAppSecretByAppKey(appKey string, platform string) string {
-	tx, err := unit.Maria.Begin()
-	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return ""
-	}
-	state, err := tx.Prepare("select `app_secret` from `sign_keys` where `app_key`=? and `platform`=?")
+// GetSubscriptionVersion 返回用户当前的订阅版本，未撤销过订阅的用户为 0
+func (signManagerImpl signManagerImpl) GetSubscriptionVersion(ctx context.Context, username string) (int, error) {
+	state, err := unit.Prepare(ctx, "select `s_version` from `user_subscription` where `u_id`=?")
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return ""
-	}
-	rows := state.QueryRow(appKey, platform)
-	secret := ""
-	err = rows.Scan(&secret)
-	if err == nil {
-		tx.Commit()
-		return secret
+		return 0, wrapError("订阅版本查询失败", err)
 	}
+	version := 0
+	err = state.QueryRowContext(ctx, username).Scan(&version)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return ""
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return ""
+		return 0, nil
 	}
+	if err != nil {
+		return 0, wrapError("订阅版本查询失败", err)
+	}
+	return version, nil
 }
 
-func (signManagerImpl signManagerImpl) GetDefaultAppSecretByPlatform(platform string) string {
-	tx, err := unit.Maria.Begin()
+// RevokeSubscription 递增用户的订阅版本，此前生成的订阅链接随即失效
+func (signManagerImpl signManagerImpl) RevokeSubscription(ctx context.Context, username string) error {
+	state, err := unit.Prepare(ctx, "update `user_subscription` set `s_version`=`s_version`+1 where `u_id`=?")
 	if err != nil {
-		stdio.LogWarn("", "数据库开始事务失败", err)
-		return ""
+		return wrapError("订阅版本更新失败", err)
 	}
-	state, err := tx.Prepare("select `app_secret` from `sign_keys` where `platform`=? order by `build` desc limit 1")
+	result, err := state.ExecContext(ctx, username)
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库准备SQL指令失败", err)
-		return ""
+		return wrapError("订阅版本更新失败", err)
 	}
-	rows := state.QueryRow(platform)
-	secret := ""
-	err = rows.Scan(&secret)
-	if err == nil {
-		tx.Commit()
-		return secret
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return wrapError("订阅版本更新失败", err)
 	}
-	if err == sql.ErrNoRows {
-		tx.Commit()
-		return ""
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn("", "数据库SQL指令执行失败", err)
-		return ""
+	if affected > 0 {
+		return nil
+	}
+	state, err = unit.Prepare(ctx, "insert into `user_subscription` (`u_id`, `s_version`) values (?, 1)")
+	if err != nil {
+		return wrapError("订阅版本写入失败", err)
+	}
+	_, err = state.ExecContext(ctx, username)
+	if err != nil {
+		return wrapError("订阅版本写入失败", err)
 	}
+	return nil
 }
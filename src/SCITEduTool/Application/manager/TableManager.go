@@ -3,26 +3,31 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"time"
 )
 
-type tableManager interface {
-	Get(username string, info UserInfo, year string, semester int) (TableContent, stdio.MessagedError)
-	Update(username string, info UserInfo, year string, semester int, tableId string, table TableObject) stdio.MessagedError
-	CheckTableExist(username string, tableId string) (bool, stdio.MessagedError)
+type TableRepository interface {
+	Get(ctx context.Context, info UserInfo, year string, semester int) (TableContent, error)
+	Update(ctx context.Context, username string, info UserInfo, year string, semester int, tableId string, table TableObject) error
+	CheckTableExist(ctx context.Context, tableId string) (bool, error)
+	GetTeacher(ctx context.Context, username string, year string, semester int) (TableContent, error)
+	UpdateTeacher(ctx context.Context, username string, year string, semester int, table TableObject) error
+	ListExpiring(ctx context.Context, year string, semester int, before int64, limit int) ([]string, error)
 }
 
 type tableManagerImpl struct{}
 
-var TableManager tableManager = tableManagerImpl{}
+var TableManager TableRepository = tableManagerImpl{}
 
 type LessonSingleItem struct {
 	Name    string `json:"name"`
 	Range   []int  `json:"range"`
 	Teacher string `json:"teacher"`
 	Room    string `json:"room"`
+	Class   string `json:"class,omitempty"`
 }
 
 type LessonItem struct {
@@ -39,112 +44,144 @@ type TableContent struct {
 	Table   string
 }
 
-func (tableManagerImpl tableManagerImpl) Get(username string, info UserInfo, year string, semester int) (TableContent, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+func (tableManagerImpl tableManagerImpl) Get(ctx context.Context, info UserInfo, year string, semester int) (TableContent, error) {
+	state, err := unit.Prepare(ctx, "select `t_content`,`t_expired` from `class_schedule` where `t_faculty`=? and `t_specialty`=? and `t_class`=? and `t_school_year`=? and `t_semester`=?")
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return TableContent{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return TableContent{}, wrapError("课表查询失败", err)
 	}
-	state, err := tx.Prepare("select `t_content`,`t_expired` from `class_schedule` where `t_faculty`=? and `t_specialty`=? and `t_class`=? and `t_school_year`=? and `t_semester`=?")
-	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return TableContent{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	rows := state.QueryRow(info.Faculty, info.Specialty, info.Class, year, semester)
+	return scanTableContent(state.QueryRowContext(ctx, info.Faculty, info.Specialty, info.Class, year, semester))
+}
+
+func scanTableContent(row *sql.Row) (TableContent, error) {
 	table := TableContent{}
 	var expired int64
-	err = rows.Scan(&table.Table, &expired)
-	if err == nil {
-		tx.Commit()
-		table.Exist = true
-		table.Expired = expired < time.Now().Unix()
-		return table, stdio.GetEmptyErrorMessage()
-	}
+	err := row.Scan(&table.Table, &expired)
 	if err == sql.ErrNoRows {
-		tx.Commit()
-		return TableContent{}, stdio.GetEmptyErrorMessage()
-	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-		return TableContent{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return TableContent{}, nil
+	}
+	if err != nil {
+		return TableContent{}, wrapError("课表查询失败", err)
 	}
+	table.Exist = true
+	table.Expired = expired < time.Now().Unix()
+	return table, nil
 }
 
-func (tableManagerImpl tableManagerImpl) Update(username string, info UserInfo, year string, semester int, tableId string, table TableObject) stdio.MessagedError {
+func (tableManagerImpl tableManagerImpl) Update(ctx context.Context, username string, info UserInfo, year string, semester int, tableId string, table TableObject) error {
 	tableContent, err := json.Marshal(table)
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return err
 	}
 	tableString := string(tableContent)
 
-	exist, errMessage := TableManager.CheckTableExist(username, tableId)
-	if errMessage.HasInfo {
-		return errMessage
-	}
-	tx, err := unit.Maria.Begin()
+	exist, err := TableManager.CheckTableExist(ctx, tableId)
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return err
 	}
 	var state *sql.Stmt
 	if !exist {
-		state, err = tx.Prepare("insert into `class_schedule` (`t_id`, `t_faculty` ,`t_specialty`, `t_class`, `t_grade`, `t_school_year`, `t_semester`, `t_content`, `t_expired`) values (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		state, err = unit.Prepare(ctx, "insert into `class_schedule` (`t_id`, `t_faculty` ,`t_specialty`, `t_class`, `t_grade`, `t_school_year`, `t_semester`, `t_content`, `t_expired`) values (?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	} else {
-		state, err = tx.Prepare("update `class_schedule` set `t_content`=?, `t_expired`=? where `t_id`=?")
+		state, err = unit.Prepare(ctx, "update `class_schedule` set `t_content`=?, `t_expired`=? where `t_id`=?")
 	}
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("课表写入失败", err)
 	}
 	if !exist {
-		_, err = state.Exec(tableId, info.Faculty, info.Specialty, info.Class, info.Grade, year, semester, tableString,
+		_, err = state.ExecContext(ctx, tableId, info.Faculty, info.Specialty, info.Class, info.Grade, year, semester, tableString,
 			time.Now().Unix()+1296000)
 	} else {
-		_, err = state.Exec(tableString, time.Now().Unix()+1296000, tableId)
+		_, err = state.ExecContext(ctx, tableString, time.Now().Unix()+1296000, tableId)
 	}
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库SQL指令执行失败", err)
-		return stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("课表写入失败", err)
 	}
-	tx.Commit()
 	if !exist {
 		stdio.LogVerbose(username, "向数据库插入新课表数据成功")
 	} else {
 		stdio.LogVerbose(username, "向数据库更新课表数据成功")
 	}
-	return stdio.GetEmptyErrorMessage()
+	return nil
+}
+
+func (tableManagerImpl tableManagerImpl) CheckTableExist(ctx context.Context, tableId string) (bool, error) {
+	state, err := unit.Prepare(ctx, "select `t_id` from `class_schedule` where `t_id`=?")
+	if err != nil {
+		return false, wrapError("课表查询失败", err)
+	}
+	id := ""
+	err = state.QueryRowContext(ctx, tableId).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, wrapError("课表查询失败", err)
+	}
+	return id != "", nil
 }
 
-func (tableManagerImpl tableManagerImpl) CheckTableExist(username string, tableId string) (bool, stdio.MessagedError) {
-	tx, err := unit.Maria.Begin()
+func (tableManagerImpl tableManagerImpl) GetTeacher(ctx context.Context, username string, year string, semester int) (TableContent, error) {
+	state, err := unit.Prepare(ctx, "select `t_content`,`t_expired` from `teacher_schedule` where `t_teacher`=? and `t_school_year`=? and `t_semester`=?")
 	if err != nil {
-		stdio.LogWarn(username, "数据库开始事务失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return TableContent{}, wrapError("教师课表查询失败", err)
+	}
+	return scanTableContent(state.QueryRowContext(ctx, username, year, semester))
+}
+
+func (tableManagerImpl tableManagerImpl) UpdateTeacher(ctx context.Context, username string, year string, semester int, table TableObject) error {
+	tableContent, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	exist, err := TableManager.GetTeacher(ctx, username, year, semester)
+	if err != nil {
+		return err
 	}
 	var state *sql.Stmt
-	state, err = tx.Prepare("select `t_id` from `class_schedule` where `t_id`=?")
+	if !exist.Exist {
+		state, err = unit.Prepare(ctx, "insert into `teacher_schedule` (`t_content`, `t_expired`, `t_teacher`, `t_school_year`, `t_semester`) values (?, ?, ?, ?, ?)")
+	} else {
+		state, err = unit.Prepare(ctx, "update `teacher_schedule` set `t_content`=?, `t_expired`=? where `t_teacher`=? and `t_school_year`=? and `t_semester`=?")
+	}
 	if err != nil {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库准备SQL指令失败", err)
-		return false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return wrapError("教师课表写入失败", err)
 	}
-	rows := state.QueryRow(tableId)
-	id := ""
-	err = rows.Scan(&id)
-	if err == nil {
-		tx.Commit()
-		return id != "", stdio.GetEmptyErrorMessage()
+	_, err = state.ExecContext(ctx, string(tableContent), time.Now().Unix()+1296000, username, year, semester)
+	if err != nil {
+		return wrapError("教师课表写入失败", err)
 	}
-	if err == sql.ErrNoRows {
-		tx.Commit()
-		return false, stdio.GetEmptyErrorMessage()
+	if !exist.Exist {
+		stdio.LogVerbose(username, "向数据库插入新教师课表数据成功")
 	} else {
-		_ = tx.Rollback()
-		stdio.LogWarn(username, "数据库SQL指令执行失败", err)
+		stdio.LogVerbose(username, "向数据库更新教师课表数据成功")
+	}
+	return nil
+}
+
+// ListExpiring 返回指定学期中将在 before 之前过期的班级课表，每个班级取一名学生账号用于刷新
+func (tableManagerImpl tableManagerImpl) ListExpiring(ctx context.Context, year string, semester int, before int64, limit int) ([]string, error) {
+	state, err := unit.Prepare(ctx, "select (select `u_id` from `user_info` where `u_faculty`=`t_faculty` and `u_specialty`=`t_specialty` and `u_class`=`t_class` and `u_grade`=`t_grade` and `u_identify`=0 limit 1) from `class_schedule` where `t_school_year`=? and `t_semester`=? and `t_expired`>=? and `t_expired`<? order by `t_expired` limit ?")
+	if err != nil {
+		return nil, wrapError("过期课表查询失败", err)
 	}
-	return false, stdio.GetErrorMessage(-500, "请求处理出错")
+	rows, err := state.QueryContext(ctx, year, semester, time.Now().Unix(), before, limit)
+	if err != nil {
+		return nil, wrapError("过期课表查询失败", err)
+	}
+	defer rows.Close()
+	usernames := make([]string, 0)
+	for rows.Next() {
+		username := sql.NullString{}
+		err = rows.Scan(&username)
+		if err != nil {
+			return nil, wrapError("过期课表查询失败", err)
+		}
+		if username.Valid {
+			usernames = append(usernames, username.String)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, wrapError("过期课表查询失败", err)
+	}
+	return usernames, nil
 }
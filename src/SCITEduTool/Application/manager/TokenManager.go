@@ -3,37 +3,79 @@ package manager
 import (
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type tokenUnit interface {
 	InitKey(tokenConf TokenConfig)
-	Build(username string, password string) (Token, stdio.MessagedError)
-	Check(token Token) (string, stdio.MessagedError)
+	Build(ctx context.Context, username string, device DeviceInfo) (Token, stdio.MessagedError)
+	Refresh(ctx context.Context, token Token, device DeviceInfo) (Token, stdio.MessagedError)
+	Check(ctx context.Context, token Token) (string, stdio.MessagedError)
+	CheckClaims(ctx context.Context, token Token) (TokenClaims, stdio.MessagedError)
+	RevokeSession(ctx context.Context, username string, sessionId string) stdio.MessagedError
 }
 
 type tokenUnitImpl struct{}
 
 var TokenUnit tokenUnit = tokenUnitImpl{}
 
+// TokenConfig 令牌配置，token_key 与 token_secret 仅用于校验旧版令牌，未配置 signing_keys 时兼作签名密钥。
+// signing_keys 中 active_kid 对应的密钥用于签发新令牌，其余密钥仅用于校验轮换前签发的令牌；
+// legacy_until 为停止接受旧版令牌的时间戳，必须配置，为负数时不限制
 type TokenConfig struct {
-	TokenKey       string `json:"token_key"`
-	TokenSecret    string `json:"token_secret"`
-	AccessExpired  string `json:"access_expired"`
-	RefreshExpired string `json:"refresh_expired"`
+	TokenKey       string            `json:"token_key"`
+	TokenSecret    string            `json:"token_secret"`
+	AccessExpired  string            `json:"access_expired"`
+	RefreshExpired string            `json:"refresh_expired"`
+	SigningKeys    []TokenSigningKey `json:"signing_keys"`
+	ActiveKid      string            `json:"active_kid"`
+	LegacyUntil    int64             `json:"legacy_until"`
 }
 
+type TokenSigningKey struct {
+	Kid    string `json:"kid"`
+	Secret string `json:"secret"`
+}
+
+const tokenIssuer = "SCITEduTool"
+
+// tokenLeeway 校验 nbf 时允许的时钟误差，单位秒
+const tokenLeeway = 60
+
+// revocationRefreshInterval 已撤销会话缓存的重新加载间隔，单位秒，其他实例撤销的会话最迟在该间隔后生效
+const revocationRefreshInterval = 60
+
+// sessionTouchInterval 同一设备会话最近使用时间的最短更新间隔，单位秒
+const sessionTouchInterval = 300
+
+const (
+	tokenVersionLegacy = 1
+	tokenVersionJWT    = 2
+)
+
 var tokenKey string
 var tokenSecret string
 var access int64
 var refresh int64
+var signingKeys map[string][]byte
+var activeKid string
+var legacyUntil int64
+
+var revokedSessions = revocationCache{
+	sessions: make(map[string]bool),
+	touched:  make(map[string]int64),
+}
 
 type Token struct {
 	AccessToken  string
@@ -46,6 +88,20 @@ type TokenCheckResult struct {
 	RefreshEffective bool
 }
 
+// TokenClaims JWT 载荷，TokenUse 为 access 或 refresh，SessionID 为签发令牌的设备会话 ID。
+// 旧版令牌及设备会话上线前签发的令牌 SessionID 为空
+type TokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+	TokenUse  string `json:"token_use"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// TokenBody 旧版令牌摘要内容
 type TokenBody struct {
 	Password string
 	Time     int64
@@ -63,6 +119,24 @@ func (tokenUnitImpl tokenUnitImpl) InitKey(tokenConf TokenConfig) {
 	}
 	tokenKey = tokenConf.TokenKey
 	tokenSecret = tokenConf.TokenSecret
+	signingKeys = make(map[string][]byte)
+	for _, key := range tokenConf.SigningKeys {
+		if key.Kid == "" || strings.Contains(key.Kid, "//") ||
+			len(key.Secret) < 32 || strings.Contains(key.Secret, "//") {
+			stdio.LogAssert("", "signing_keys中存在为空、格式不正确或长度不足32位的密钥", nil)
+			os.Exit(0)
+		}
+		signingKeys[key.Kid] = []byte(key.Secret)
+	}
+	activeKid = tokenConf.ActiveKid
+	if len(signingKeys) == 0 {
+		stdio.LogWarn("", "未配置signing_keys，将使用token_secret签发令牌，建议尽快配置独立的签名密钥", nil)
+		activeKid = "default"
+		signingKeys[activeKid] = []byte(tokenSecret)
+	} else if _, exist := signingKeys[activeKid]; !exist {
+		stdio.LogAssert("", "active_kid对应的签名密钥不存在", nil)
+		os.Exit(0)
+	}
 	access, err = strconv.ParseInt(tokenConf.AccessExpired, 10, 64)
 	if err != nil {
 		stdio.LogWarn("", "access_token过期时间解析失败，将使用默认值", err)
@@ -72,71 +146,314 @@ func (tokenUnitImpl tokenUnitImpl) InitKey(tokenConf TokenConfig) {
 	if err != nil {
 		stdio.LogWarn("", "refresh_token过期时间解析失败，将使用默认值", err)
 		refresh = 124416000
-	} else {
-		stdio.LogVerbose("", "Token配置成功")
 	}
+	legacyUntil = tokenConf.LegacyUntil
+	if legacyUntil == 0 {
+		stdio.LogAssert("", "未配置legacy_until，请配置停止接受旧版令牌的时间戳，配置为负数时不限制", nil)
+		os.Exit(0)
+	} else if legacyUntil < 0 {
+		stdio.LogWarn("", "legacy_until为负数，旧版令牌将永久有效，建议尽快配置停止使用的时间戳", nil)
+	}
+	stdio.LogVerbose("", "Token配置成功")
+}
+
+// Build 为用户创建设备会话，并使用 active_kid 对应的密钥签发 HS256 JWT 格式的 access_token 与 refresh_token
+func (tokenUnitImpl tokenUnitImpl) Build(ctx context.Context, username string, device DeviceInfo) (Token, stdio.MessagedError) {
+	return buildSession(ctx, username, newTokenID(), device)
+}
+
+func buildSession(ctx context.Context, username string, sessionId string, device DeviceInfo) (Token, stdio.MessagedError) {
+	timeNow := time.Now().Unix()
+	token, refreshClaims, errMessage := issueToken(username, sessionId, timeNow)
+	if errMessage.HasInfo {
+		return Token{}, errMessage
+	}
+	err := DeviceSessionManager.Insert(ctx, DeviceSessionItem{
+		SessionId:  sessionId,
+		Username:   username,
+		RefreshId:  refreshClaims.ID,
+		Device:     device.Name,
+		Platform:   device.Platform,
+		IP:         device.IP,
+		CreateTime: timeNow,
+		LastUsed:   timeNow,
+		Expired:    refreshClaims.ExpiresAt,
+	})
+	if err != nil {
+		return Token{}, ErrorMessage(username, err)
+	}
+	return token, stdio.GetEmptyErrorMessage()
 }
 
-func (tokenUnitImpl tokenUnitImpl) Build(username string, password string) (Token, stdio.MessagedError) {
-	token := Token{
-		AccessToken:  "",
-		RefreshToken: "",
+// Refresh 校验 access_token 与 refresh_token 后换发令牌，新令牌沿用原设备会话，原 refresh_token 随即作废。
+// 已作废的 refresh_token 再次使用时撤销整个会话并记录安全事件；旧版令牌及未关联设备会话的令牌仅可换发一次，
+// 换发时创建新会话，此后再次使用视同已作废的 refresh_token
+func (tokenUnitImpl tokenUnitImpl) Refresh(ctx context.Context, token Token, device DeviceInfo) (Token, stdio.MessagedError) {
+	if token.RefreshToken == "" {
+		stdio.LogInfo("", "无refresh_token可验证")
+		return Token{}, stdio.GetErrorMessage(-403, "无法验证的令牌")
+	}
+	accessClaims, refreshClaims, errMessage := checkToken(ctx, token)
+	if errMessage.HasInfo {
+		return Token{}, errMessage
+	}
+	username := accessClaims.Subject
+	if accessClaims.SessionID == "" {
+		return migrateSession(ctx, username, token, refreshClaims, device)
+	}
+	session, err := DeviceSessionManager.Get(ctx, accessClaims.SessionID)
+	if err == ErrNotFound {
+		stdio.LogInfo(username, "设备会话不存在，将创建新会话")
+		return migrateSession(ctx, username, token, refreshClaims, device)
+	}
+	if err != nil {
+		return Token{}, ErrorMessage(username, err)
+	}
+	if session.Revoked || session.Username != username {
+		stdio.LogInfo(username, "设备会话已撤销")
+		return Token{}, stdio.GetErrorMessage(-403, "令牌失效")
+	}
+	if refreshClaims.ID != session.RefreshId {
+		return Token{}, revokeReusedSession(ctx, session, device)
 	}
 	timeNow := time.Now().Unix()
-	headerPre := username + "&" + strconv.FormatInt(timeNow, 10)
-	for len(headerPre)%3 != 0 {
-		headerPre += "%"
+	newToken, newRefreshClaims, errMessage := issueToken(username, session.SessionId, timeNow)
+	if errMessage.HasInfo {
+		return Token{}, errMessage
+	}
+	err = DeviceSessionManager.Rotate(ctx, session.SessionId, refreshClaims.ID, newRefreshClaims.ID,
+		device.IP, timeNow, newRefreshClaims.ExpiresAt)
+	if err == ErrNotFound {
+		// 同一 refresh_token 被并发换发，已由其他请求作废
+		return Token{}, revokeReusedSession(ctx, session, device)
 	}
-	header := base64.StdEncoding.EncodeToString([]byte(headerPre))
-	token.AccessToken += header + "."
+	if err != nil {
+		return Token{}, ErrorMessage(username, err)
+	}
+	return newToken, stdio.GetEmptyErrorMessage()
+}
 
-	passwordPre := password
-	//IF DEBUG
-	var err stdio.MessagedError
-	passwordPre, err = unit.RSAStaticUnit.DecodePublicEncode(passwordPre)
-	if err.HasInfo {
-		return Token{}, err
+// Check 校验令牌并返回用户名，同时传入 refresh_token 时 access_token 过期仍可通过校验。
+// JWT 格式的令牌校验签名、声明及所属设备会话是否已撤销，旧版令牌在 legacy_until 前仍按原方式校验
+func (tokenUnitImpl tokenUnitImpl) Check(ctx context.Context, token Token) (string, stdio.MessagedError) {
+	claims, errMessage := TokenUnit.CheckClaims(ctx, token)
+	return claims.Subject, errMessage
+}
+
+// CheckClaims 同 Check，返回 access_token 的声明，旧版令牌仅包含用户名
+func (tokenUnitImpl tokenUnitImpl) CheckClaims(ctx context.Context, token Token) (TokenClaims, stdio.MessagedError) {
+	claims, _, errMessage := checkToken(ctx, token)
+	if errMessage.HasInfo || claims.SessionID == "" {
+		return claims, errMessage
 	}
-	if len(passwordPre) <= 8 {
-		return Token{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	timeNow := time.Now().Unix()
+	if revokedSessions.shouldTouch(claims.SessionID, timeNow) {
+		err := DeviceSessionManager.Touch(ctx, claims.SessionID, timeNow)
+		if err != nil {
+			stdio.LogWarn(claims.Subject, "设备会话使用时间更新失败", err)
+		}
 	}
-	passwordPre = passwordPre[8:]
-	//ENDIF
+	return claims, errMessage
+}
 
-	accessBodyPre, _ := json.Marshal(TokenBody{
-		Password: passwordPre,
-		Time:     timeNow,
-		Type:     "access",
-		Key:      tokenKey,
-	})
-	refreshBodyPre, _ := json.Marshal(TokenBody{
-		Password: passwordPre,
-		Time:     timeNow,
-		Type:     "refresh",
-		Key:      tokenKey,
-	})
-	token.AccessToken = getMD5(accessBodyPre) + "." + token.AccessToken
-	token.RefreshToken = getMD5(refreshBodyPre) + "."
+// RevokeSession 撤销用户的设备会话，该会话签发的令牌随即失效
+func (tokenUnitImpl tokenUnitImpl) RevokeSession(ctx context.Context, username string, sessionId string) stdio.MessagedError {
+	err := DeviceSessionManager.Revoke(ctx, username, sessionId)
+	if err != nil {
+		return ErrorMessage(username, err)
+	}
+	revokedSessions.add(sessionId)
+	stdio.LogInfo(username, "设备会话已撤销："+sessionId)
+	return stdio.GetEmptyErrorMessage()
+}
 
-	accessFooterPre := token.AccessToken + tokenSecret
-	refreshFooterPre := token.RefreshToken + header + "." + tokenSecret
+// migrateSession 为未关联设备会话的 refresh_token 创建新会话，并记录该令牌已作废，
+// 同一令牌再次换发时撤销其创建的会话
+func migrateSession(ctx context.Context, username string, token Token, refreshClaims TokenClaims, device DeviceInfo) (Token, stdio.MessagedError) {
+	tokenId := refreshClaims.ID
+	expired := refreshClaims.ExpiresAt
+	if getTokenVersion(token.AccessToken) == tokenVersionLegacy {
+		digest := sha256.Sum256([]byte(token.RefreshToken))
+		tokenId = hex.EncodeToString(digest[:])
+		expired = time.Now().Unix() + refresh
+	}
+	sessionId, err := DeviceSessionManager.Retire(ctx, tokenId, username, newTokenID(), expired)
+	if err == ErrTokenRetired {
+		session, err := DeviceSessionManager.Get(ctx, sessionId)
+		if err == ErrNotFound {
+			stdio.LogWarn(username, "安全事件：已作废的refresh_token被再次使用，请求IP："+device.IP, nil)
+			return Token{}, stdio.GetErrorMessage(-403, "令牌失效")
+		}
+		if err != nil {
+			return Token{}, ErrorMessage(username, err)
+		}
+		return Token{}, revokeReusedSession(ctx, session, device)
+	}
+	if err != nil {
+		return Token{}, ErrorMessage(username, err)
+	}
+	return buildSession(ctx, username, sessionId, device)
+}
 
-	token.AccessToken += getMD5([]byte(accessFooterPre))
-	token.RefreshToken += getFullMD5([]byte(refreshFooterPre))
-	return token, stdio.GetEmptyErrorMessage()
+// revokeReusedSession 已作废的 refresh_token 被再次使用，说明令牌可能已泄露，撤销整个会话
+func revokeReusedSession(ctx context.Context, session DeviceSessionItem, device DeviceInfo) stdio.MessagedError {
+	stdio.LogWarn(session.Username, "安全事件：已作废的refresh_token被再次使用，将撤销设备会话："+session.SessionId+
+		"，设备："+session.Device+"，请求IP："+device.IP, nil)
+	err := DeviceSessionManager.Revoke(ctx, session.Username, session.SessionId)
+	if err != nil && err != ErrNotFound {
+		return ErrorMessage(session.Username, err)
+	}
+	revokedSessions.add(session.SessionId)
+	return stdio.GetErrorMessage(-403, "令牌失效")
 }
 
-func (tokenUnitImpl tokenUnitImpl) Check(token Token) (string, stdio.MessagedError) {
-	username := ""
+// checkToken 校验令牌，返回 access_token 与 refresh_token 的声明，未传入 refresh_token 时其声明为空
+func checkToken(ctx context.Context, token Token) (TokenClaims, TokenClaims, stdio.MessagedError) {
 	if token.AccessToken == "" {
 		if token.RefreshToken != "" {
 			stdio.LogInfo("", "refresh_token无法验证")
 		} else {
 			stdio.LogInfo("", "无token可验证")
 		}
-		return "", stdio.GetErrorMessage(-403, "无法验证的令牌")
+		return TokenClaims{}, TokenClaims{}, stdio.GetErrorMessage(-403, "无法验证的令牌")
+	}
+	if getTokenVersion(token.AccessToken) == tokenVersionJWT {
+		accessClaims, refreshClaims, errMessage := checkSignedToken(token)
+		if errMessage.HasInfo || accessClaims.SessionID == "" {
+			return accessClaims, refreshClaims, errMessage
+		}
+		revoked, err := revokedSessions.contains(ctx, accessClaims.SessionID)
+		if err != nil {
+			return accessClaims, refreshClaims, ErrorMessage(accessClaims.Subject, err)
+		}
+		if revoked {
+			stdio.LogInfo(accessClaims.Subject, "设备会话已撤销")
+			return accessClaims, refreshClaims, stdio.GetErrorMessage(-403, "令牌失效")
+		}
+		return accessClaims, refreshClaims, stdio.GetEmptyErrorMessage()
+	}
+	if legacyUntil >= 0 && time.Now().Unix() > legacyUntil {
+		stdio.LogInfo("", "旧版令牌已停止使用")
+		return TokenClaims{}, TokenClaims{}, stdio.GetErrorMessage(-403, "令牌失效")
+	}
+	username, errMessage := checkLegacyToken(ctx, token)
+	return TokenClaims{
+		Subject: username,
+	}, TokenClaims{}, errMessage
+}
+
+// getTokenVersion 旧版 access_token 首段为 16 位十六进制摘要，JWT 首段为 base64url 编码的头部
+func getTokenVersion(token string) int {
+	prefix := strings.SplitN(token, ".", 2)[0]
+	if len(prefix) == 16 {
+		if _, err := hex.DecodeString(prefix); err == nil {
+			return tokenVersionLegacy
+		}
+	}
+	return tokenVersionJWT
+}
+
+// issueToken 签发属于设备会话的 access_token 与 refresh_token，并返回 refresh_token 的声明
+func issueToken(username string, sessionId string, timeNow int64) (Token, TokenClaims, stdio.MessagedError) {
+	accessToken, _, errMessage := signToken(TokenClaims{
+		Subject:   username,
+		IssuedAt:  timeNow,
+		ExpiresAt: timeNow + access,
+		TokenUse:  "access",
+		SessionID: sessionId,
+	})
+	if errMessage.HasInfo {
+		return Token{}, TokenClaims{}, errMessage
+	}
+	refreshToken, refreshClaims, errMessage := signToken(TokenClaims{
+		Subject:   username,
+		IssuedAt:  timeNow,
+		ExpiresAt: timeNow + refresh,
+		TokenUse:  "refresh",
+		SessionID: sessionId,
+	})
+	if errMessage.HasInfo {
+		return Token{}, TokenClaims{}, errMessage
 	}
+	return Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, refreshClaims, stdio.GetEmptyErrorMessage()
+}
+
+func signToken(claims TokenClaims) (string, TokenClaims, stdio.MessagedError) {
+	claims.Issuer = tokenIssuer
+	claims.NotBefore = claims.IssuedAt
+	claims.ID = newTokenID()
+	token, err := unit.SignJWT(activeKid, signingKeys[activeKid], claims)
+	if err != nil {
+		stdio.LogError(claims.Subject, "令牌签发失败", err)
+		return "", claims, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	return token, claims, stdio.GetEmptyErrorMessage()
+}
+
+func newTokenID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// parseSignedToken 校验 JWT 签名、签发者、类型与生效时间，不校验过期时间
+func parseSignedToken(token string, tokenUse string) (TokenClaims, stdio.MessagedError) {
+	claims := TokenClaims{}
+	_, err := unit.ParseJWT(token, func(kid string) []byte {
+		return signingKeys[kid]
+	}, &claims)
+	if err != nil {
+		stdio.LogInfo("", tokenUse+"_token无效，信息："+err.Error())
+		return claims, stdio.GetErrorMessage(-403, "令牌无效")
+	}
+	if claims.Issuer != tokenIssuer || claims.TokenUse != tokenUse || claims.Subject == "" {
+		stdio.LogInfo("", tokenUse+"_token声明无效")
+		return claims, stdio.GetErrorMessage(-403, "令牌无效")
+	}
+	if claims.NotBefore > time.Now().Unix()+tokenLeeway {
+		stdio.LogInfo(claims.Subject, tokenUse+"_token尚未生效")
+		return claims, stdio.GetErrorMessage(-403, "令牌无效")
+	}
+	return claims, stdio.GetEmptyErrorMessage()
+}
 
+func checkSignedToken(token Token) (TokenClaims, TokenClaims, stdio.MessagedError) {
+	accessClaims, errMessage := parseSignedToken(token.AccessToken, "access")
+	if errMessage.HasInfo {
+		return TokenClaims{}, TokenClaims{}, errMessage
+	}
+	username := accessClaims.Subject
+	timeNow := time.Now().Unix()
+	if accessClaims.ExpiresAt < timeNow {
+		stdio.LogInfo(username, "access_token过期")
+		if token.RefreshToken == "" {
+			return accessClaims, TokenClaims{}, stdio.GetErrorMessage(-403, "令牌失效")
+		}
+	}
+	if token.RefreshToken == "" {
+		return accessClaims, TokenClaims{}, stdio.GetEmptyErrorMessage()
+	}
+	refreshClaims, errMessage := parseSignedToken(token.RefreshToken, "refresh")
+	if errMessage.HasInfo {
+		return accessClaims, refreshClaims, errMessage
+	}
+	if refreshClaims.Subject != username || refreshClaims.SessionID != accessClaims.SessionID {
+		stdio.LogInfo(username, "refresh_token与access_token不匹配")
+		return accessClaims, refreshClaims, stdio.GetErrorMessage(-403, "令牌无效")
+	}
+	if refreshClaims.ExpiresAt < timeNow {
+		stdio.LogInfo(username, "refresh_token过期")
+		return accessClaims, refreshClaims, stdio.GetErrorMessage(-403, "令牌失效")
+	}
+	return accessClaims, refreshClaims, stdio.GetEmptyErrorMessage()
+}
+
+// checkLegacyToken 校验旧版 MD5 令牌，需读取用户保存的密码
+func checkLegacyToken(ctx context.Context, token Token) (string, stdio.MessagedError) {
+	username := ""
 	accessPre := strings.Split(token.AccessToken, ".")
 	if len(accessPre) != 3 {
 		stdio.LogInfo("", "access_token格式错误")
@@ -153,20 +470,19 @@ func (tokenUnitImpl tokenUnitImpl) Check(token Token) (string, stdio.MessagedErr
 		return "", stdio.GetErrorMessage(-403, "令牌无效")
 	}
 	username = header[0]
-	password, errMessage := SessionManager.GetUserPassword(username, "")
-	if errMessage.HasInfo {
-		return "", errMessage
+	password, err := SessionManager.GetUserPassword(ctx, username, "")
+	if err != nil {
+		return "", ErrorMessage(username, err)
 	}
+	var errMessage stdio.MessagedError
 
 	//IF DEBUG
-	password, errMessage = unit.RSAStaticUnit.DecodePublicEncode(password)
+	var envelope unit.Envelope
+	envelope, errMessage = unit.RSAStaticUnit.OpenEnvelope(unit.ParseCipherText(password), false)
 	if errMessage.HasInfo {
 		return "", errMessage
 	}
-	if len(password) <= 8 {
-		return "", stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	password = password[8:]
+	password = envelope.Data
 	//ENDIF
 
 	if password == "" {
@@ -242,3 +558,69 @@ func getFullMD5(data []byte) string {
 func getMD5(data []byte) string {
 	return getFullMD5(data)[8:24]
 }
+
+// revocationCache 已撤销设备会话的内存缓存，定期从数据库重新加载以同步其他实例的撤销操作；
+// touched 记录各会话最近一次写入使用时间的时间，用于限制写入频率
+type revocationCache struct {
+	lock     sync.RWMutex
+	sessions map[string]bool
+	loadedAt int64
+	touched  map[string]int64
+}
+
+func (cache *revocationCache) contains(ctx context.Context, sessionId string) (bool, error) {
+	timeNow := time.Now().Unix()
+	cache.lock.RLock()
+	revoked := cache.sessions[sessionId]
+	expired := cache.loadedAt+revocationRefreshInterval < timeNow
+	cache.lock.RUnlock()
+	if revoked || !expired {
+		return revoked, nil
+	}
+	err := cache.reload(ctx, timeNow)
+	if err != nil {
+		return false, err
+	}
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	return cache.sessions[sessionId], nil
+}
+
+func (cache *revocationCache) reload(ctx context.Context, timeNow int64) error {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.loadedAt+revocationRefreshInterval >= timeNow {
+		return nil
+	}
+	revoked, err := DeviceSessionManager.ListRevoked(ctx, timeNow)
+	if err != nil {
+		return err
+	}
+	cache.sessions = make(map[string]bool, len(revoked))
+	for _, sessionId := range revoked {
+		cache.sessions[sessionId] = true
+	}
+	for sessionId, touchedAt := range cache.touched {
+		if touchedAt+sessionTouchInterval < timeNow {
+			delete(cache.touched, sessionId)
+		}
+	}
+	cache.loadedAt = timeNow
+	return nil
+}
+
+func (cache *revocationCache) add(sessionId string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.sessions[sessionId] = true
+}
+
+func (cache *revocationCache) shouldTouch(sessionId string, timeNow int64) bool {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.touched[sessionId]+sessionTouchInterval > timeNow {
+		return false
+	}
+	cache.touched[sessionId] = timeNow
+	return true
+}
@@ -0,0 +1,286 @@
+package manager
+
+import (
+	"SCITEduTool/Application/unit"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testUsername = "2019010101"
+
+var testDevice = DeviceInfo{
+	Name:     "test",
+	Platform: "android",
+	IP:       "127.0.0.1",
+}
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "token")
+	if err != nil {
+		panic(err)
+	}
+	unit.InitSQL(unit.SqlConfig{
+		Driver: "sqlite",
+		Path:   filepath.Join(dir, "test.db"),
+	})
+	if _, errMessage := unit.MigrationUnit.Up(0, false); errMessage.HasInfo {
+		panic("数据库迁移失败")
+	}
+	TokenUnit.InitKey(TokenConfig{
+		TokenKey:       "0123456789abcdef",
+		TokenSecret:    "0123456789abcdef0123456789abcdef",
+		AccessExpired:  "2592000",
+		RefreshExpired: "124416000",
+		SigningKeys: []TokenSigningKey{
+			{Kid: "test", Secret: "0123456789abcdef0123456789abcdef"},
+		},
+		ActiveKid:   "test",
+		LegacyUntil: -1,
+	})
+	code := m.Run()
+	_ = unit.DB.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func buildToken(t *testing.T) Token {
+	token, errMessage := TokenUnit.Build(context.Background(), testUsername, testDevice)
+	if errMessage.HasInfo {
+		t.Fatalf("令牌签发失败：%d", errMessage.Code)
+	}
+	return token
+}
+
+func refreshToken(t *testing.T, token Token) Token {
+	newToken, errMessage := TokenUnit.Refresh(context.Background(), token, testDevice)
+	if errMessage.HasInfo {
+		t.Fatalf("令牌换发失败：%d", errMessage.Code)
+	}
+	return newToken
+}
+
+func sessionOf(t *testing.T, token Token) string {
+	claims, errMessage := parseSignedToken(token.AccessToken, "access")
+	if errMessage.HasInfo {
+		t.Fatalf("access_token解析失败：%d", errMessage.Code)
+	}
+	return claims.SessionID
+}
+
+// legacySessionToken 签发设备会话上线前格式的令牌，不包含 sid
+func legacySessionToken(t *testing.T) Token {
+	token, _, errMessage := issueToken(testUsername, "", time.Now().Unix())
+	if errMessage.HasInfo {
+		t.Fatalf("令牌签发失败：%d", errMessage.Code)
+	}
+	return token
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare 返回待换发的令牌及需检查撤销状态的会话
+		prepare func(t *testing.T) (Token, string)
+		code    int
+		revoked bool
+	}{
+		{
+			name: "换发当前令牌",
+			prepare: func(t *testing.T) (Token, string) {
+				token := buildToken(t)
+				return token, sessionOf(t, token)
+			},
+		},
+		{
+			name: "连续换发",
+			prepare: func(t *testing.T) (Token, string) {
+				token := refreshToken(t, buildToken(t))
+				return token, sessionOf(t, token)
+			},
+		},
+		{
+			name: "已作废的令牌被再次使用",
+			prepare: func(t *testing.T) (Token, string) {
+				token := buildToken(t)
+				refreshToken(t, token)
+				return token, sessionOf(t, token)
+			},
+			code:    -403,
+			revoked: true,
+		},
+		{
+			name: "会话已撤销",
+			prepare: func(t *testing.T) (Token, string) {
+				token := buildToken(t)
+				sessionId := sessionOf(t, token)
+				if errMessage := TokenUnit.RevokeSession(context.Background(), testUsername, sessionId); errMessage.HasInfo {
+					t.Fatalf("设备会话撤销失败：%d", errMessage.Code)
+				}
+				return token, sessionId
+			},
+			code:    -403,
+			revoked: true,
+		},
+		{
+			name: "缺少refresh_token",
+			prepare: func(t *testing.T) (Token, string) {
+				token := buildToken(t)
+				token.RefreshToken = ""
+				return token, sessionOf(t, token)
+			},
+			code: -403,
+		},
+		{
+			name: "未关联会话的令牌首次换发",
+			prepare: func(t *testing.T) (Token, string) {
+				return legacySessionToken(t), ""
+			},
+		},
+		{
+			name: "未关联会话的令牌再次换发",
+			prepare: func(t *testing.T) (Token, string) {
+				token := legacySessionToken(t)
+				return token, sessionOf(t, refreshToken(t, token))
+			},
+			code:    -403,
+			revoked: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, sessionId := test.prepare(t)
+			newToken, errMessage := TokenUnit.Refresh(context.Background(), token, testDevice)
+			if errMessage.Code != test.code {
+				t.Fatalf("换发结果应为 %d，实际为 %d", test.code, errMessage.Code)
+			}
+			if test.code == 0 {
+				if newToken.RefreshToken == "" || newToken.RefreshToken == token.RefreshToken {
+					t.Fatal("换发后应返回新的refresh_token")
+				}
+				if sessionId != "" && sessionOf(t, newToken) != sessionId {
+					t.Fatal("换发后的令牌应沿用原设备会话")
+				}
+				if _, errMessage = TokenUnit.Check(context.Background(), newToken); errMessage.HasInfo {
+					t.Fatalf("换发后的令牌校验失败：%d", errMessage.Code)
+				}
+			}
+			if sessionId == "" {
+				return
+			}
+			session, err := DeviceSessionManager.Get(context.Background(), sessionId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.Revoked != test.revoked {
+				t.Fatalf("会话撤销状态应为 %v，实际为 %v", test.revoked, session.Revoked)
+			}
+		})
+	}
+}
+
+func TestRefreshRevokesLatestToken(t *testing.T) {
+	token := buildToken(t)
+	latest := refreshToken(t, token)
+	if _, errMessage := TokenUnit.Refresh(context.Background(), token, testDevice); errMessage.Code != -403 {
+		t.Fatalf("已作废的令牌换发应返回 -403，实际为 %d", errMessage.Code)
+	}
+	if _, errMessage := TokenUnit.Check(context.Background(), latest); errMessage.Code != -403 {
+		t.Fatalf("会话撤销后最新令牌应失效，实际为 %d", errMessage.Code)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous func(session DeviceSessionItem) string
+		revoke   bool
+		err      error
+	}{
+		{
+			name:     "当前refresh_token",
+			previous: func(session DeviceSessionItem) string { return session.RefreshId },
+		},
+		{
+			name:     "已被其他请求换发",
+			previous: func(session DeviceSessionItem) string { return newTokenID() },
+			err:      ErrNotFound,
+		},
+		{
+			name:     "会话已撤销",
+			previous: func(session DeviceSessionItem) string { return session.RefreshId },
+			revoke:   true,
+			err:      ErrNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			session, err := DeviceSessionManager.Get(ctx, sessionOf(t, buildToken(t)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.revoke {
+				if err = DeviceSessionManager.Revoke(ctx, testUsername, session.SessionId); err != nil {
+					t.Fatal(err)
+				}
+			}
+			refreshId := newTokenID()
+			timeNow := time.Now().Unix()
+			err = DeviceSessionManager.Rotate(ctx, session.SessionId, test.previous(session), refreshId, testDevice.IP,
+				timeNow, timeNow+refresh)
+			if err != test.err {
+				t.Fatalf("换发结果应为 %v，实际为 %v", test.err, err)
+			}
+			if test.err != nil {
+				return
+			}
+			// 同一 refresh_token 的第二次换发应失败
+			err = DeviceSessionManager.Rotate(ctx, session.SessionId, session.RefreshId, newTokenID(), testDevice.IP,
+				timeNow, timeNow+refresh)
+			if err != ErrNotFound {
+				t.Fatalf("重复换发应返回 ErrNotFound，实际为 %v", err)
+			}
+		})
+	}
+}
+
+func TestRevokeReusedSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke bool
+	}{
+		{name: "会话未撤销"},
+		{name: "会话已被并发请求撤销", revoke: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			token := buildToken(t)
+			session, err := DeviceSessionManager.Get(ctx, sessionOf(t, token))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.revoke {
+				if err = DeviceSessionManager.Revoke(ctx, testUsername, session.SessionId); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if errMessage := revokeReusedSession(ctx, session, testDevice); errMessage.Code != -403 {
+				t.Fatalf("应返回 -403，实际为 %d", errMessage.Code)
+			}
+			session, err = DeviceSessionManager.Get(ctx, session.SessionId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !session.Revoked {
+				t.Fatal("会话应已撤销")
+			}
+			if _, errMessage := TokenUnit.Check(ctx, token); errMessage.Code != -403 {
+				t.Fatalf("会话撤销后令牌应失效，实际为 %d", errMessage.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package mock
+
+import (
+	"SCITEduTool/Application/module"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// fixtures 内置的 HTML 夹具，使模拟服务器不依赖运行目录
+//
+//go:embed fixtures/zhengfang
+var fixtures embed.FS
+
+// ZhengFangAccount 模拟教务系统账号，Password 为统一身份认证实际收到的明文密码
+type ZhengFangAccount struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Identify int    `json:"identify"`
+}
+
+// ZhengFangHandler 模拟正方教务系统及统一身份认证，页面内容取自录制的 HTML 夹具。
+// 夹具目录结构为 accounts.json 与 <username>/<page>.html，
+// 回发请求依次尝试 <page>_<字段值>.html、<page>_post.html 与 <page>.html，字段见 zhengFangPostKeys
+type ZhengFangHandler struct {
+	fixtures           fs.FS
+	accounts           map[string]ZhengFangAccount
+	viewStateGenerator map[string]string
+
+	lock     sync.Mutex
+	lts      map[string]bool
+	tgts     map[string]string
+	tickets  map[string]string
+	portals  map[string]string
+	sessions map[string]string
+}
+
+// zhengFangPostKeys 回发请求中用于选择夹具的表单字段
+var zhengFangPostKeys = map[string][]string{
+	"tjkbcx": {"__EVENTTARGET"},
+	"xscj":   {"ddlXN", "ddlXQ"},
+	"xskscx": {"xnd", "xqd"},
+}
+
+var fixtureNameRegexp = regexp.MustCompile("^[0-9A-Za-z_-]+$")
+
+// DefaultFixtures 返回内置的正方教务系统夹具
+func DefaultFixtures() fs.FS {
+	sub, _ := fs.Sub(fixtures, "fixtures/zhengfang")
+	return sub
+}
+
+// NewZhengFangHandler 使用 dir 目录中的夹具创建模拟服务器，dir 为空时使用内置夹具
+func NewZhengFangHandler(dir string) (*ZhengFangHandler, error) {
+	if dir == "" {
+		return NewZhengFangHandlerFS(DefaultFixtures())
+	}
+	return NewZhengFangHandlerFS(os.DirFS(dir))
+}
+
+func NewZhengFangHandlerFS(fixtures fs.FS) (*ZhengFangHandler, error) {
+	content, err := fs.ReadFile(fixtures, "accounts.json")
+	if err != nil {
+		return nil, err
+	}
+	var accounts []ZhengFangAccount
+	err = json.Unmarshal(content, &accounts)
+	if err != nil {
+		return nil, err
+	}
+	handler := &ZhengFangHandler{
+		fixtures:           fixtures,
+		accounts:           make(map[string]ZhengFangAccount),
+		viewStateGenerator: module.GetDefaultZhengFangConfig().ViewStateGenerator,
+		lts:                make(map[string]bool),
+		tgts:               make(map[string]string),
+		tickets:            make(map[string]string),
+		portals:            make(map[string]string),
+		sessions:           make(map[string]string),
+	}
+	for _, account := range accounts {
+		if !fixtureNameRegexp.MatchString(account.Username) {
+			return nil, errors.New("invalid username: " + account.Username)
+		}
+		handler.accounts[account.Username] = account
+	}
+	return handler, nil
+}
+
+// NewZhengFangServer 启动模拟服务器，dir 为空时使用内置夹具，返回的配置可直接用于 module.InitEduSystem
+func NewZhengFangServer(dir string) (*httptest.Server, module.ZhengFangConfig, error) {
+	handler, err := NewZhengFangHandler(dir)
+	if err != nil {
+		return nil, module.ZhengFangConfig{}, err
+	}
+	server := httptest.NewServer(handler)
+	return server, GetZhengFangConfig(server.URL), nil
+}
+
+// GetZhengFangConfig 返回指向模拟服务器的教务系统配置
+func GetZhengFangConfig(serverUrl string) module.ZhengFangConfig {
+	conf := module.GetDefaultZhengFangConfig()
+	conf.BaseUrl = strings.TrimSuffix(serverUrl, "/")
+	conf.CasUrl = conf.BaseUrl + "/zfca"
+	return conf
+}
+
+func (handler *ZhengFangHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == "/zfca/login" && r.URL.Query().Get("yhlx") != "":
+		handler.casService(w, r)
+	case path == "/zfca/login":
+		handler.casLoginPage(w, r)
+	case strings.HasPrefix(path, "/zfca/login;jsessionid="):
+		handler.casLogin(w, r)
+	case path == "/zfca/portal":
+		handler.casPortal(w, r)
+	case path == "/zfca/portal/auth":
+		handler.casPortalAuth(w, r)
+	case path == "/zfca/portal/home":
+		handler.casPortalHome(w, r)
+	case path == "/xs_main.aspx":
+		handler.eduMain(w, r)
+	case strings.HasSuffix(path, ".aspx"):
+		handler.eduPage(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "/"), ".aspx"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (handler *ZhengFangHandler) casLoginPage(w http.ResponseWriter, r *http.Request) {
+	lt := "LT-" + randomId()
+	handler.lock.Lock()
+	handler.lts[lt] = true
+	handler.lock.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: randomId(), Path: "/zfca"})
+	writeHTML(w, `<html><body><form id="fm1" method="post">`+
+		`<div class="btn"><span><input type="hidden" name="lt" value="`+lt+`"/></span></div>`+
+		`</form></body></html>`)
+}
+
+func (handler *ZhengFangHandler) casLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.ParseForm() != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	handler.lock.Lock()
+	validLt := handler.lts[r.PostForm.Get("lt")]
+	delete(handler.lts, r.PostForm.Get("lt"))
+	handler.lock.Unlock()
+	account, exist := handler.accounts[r.PostForm.Get("username")]
+	if !validLt || !exist || account.Password != r.PostForm.Get("password") {
+		writeHTML(w, `<html><body><div id="msg" class="errors">用户名或密码错误</div></body></html>`)
+		return
+	}
+	tgt := "TGT-" + randomId()
+	ticket := "ST-" + randomId()
+	handler.lock.Lock()
+	handler.tgts[tgt] = account.Username
+	handler.tickets[ticket] = account.Username
+	handler.lock.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "CASTGC", Value: tgt, Path: "/zfca"})
+	redirect(w, r, "/zfca/portal?ticket="+ticket)
+}
+
+func (handler *ZhengFangHandler) casPortal(w http.ResponseWriter, r *http.Request) {
+	username, exist := handler.consumeTicket(r.URL.Query().Get("ticket"))
+	if !exist {
+		http.Error(w, "invalid ticket", http.StatusForbidden)
+		return
+	}
+	portal := randomId()
+	handler.lock.Lock()
+	handler.portals[portal] = username
+	handler.lock.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: portal, Path: "/zfca/portal"})
+	redirect(w, r, "/zfca/portal/auth")
+}
+
+func (handler *ZhengFangHandler) casPortalAuth(w http.ResponseWriter, r *http.Request) {
+	if _, exist := handler.tgtUser(r); !exist {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	redirect(w, r, "/zfca/portal/home")
+}
+
+func (handler *ZhengFangHandler) casPortalHome(w http.ResponseWriter, r *http.Request) {
+	var username string
+	exist := false
+	handler.lock.Lock()
+	for _, cookie := range r.Cookies() {
+		if cookie.Name != "JSESSIONID" {
+			continue
+		}
+		if username, exist = handler.portals[cookie.Value]; exist {
+			break
+		}
+	}
+	handler.lock.Unlock()
+	if !exist {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	identities := []string{"student", "teacher"}
+	writeHTML(w, `<html><body><a href="login?yhlx=`+identities[handler.accounts[username].Identify]+
+		`">教务管理系统</a></body></html>`)
+}
+
+func (handler *ZhengFangHandler) casService(w http.ResponseWriter, r *http.Request) {
+	username, exist := handler.tgtUser(r)
+	if !exist {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ticket := "ST-" + randomId()
+	handler.lock.Lock()
+	handler.tickets[ticket] = username
+	handler.lock.Unlock()
+	redirect(w, r, "/xs_main.aspx?xh="+username+"&ticket="+ticket)
+}
+
+func (handler *ZhengFangHandler) eduMain(w http.ResponseWriter, r *http.Request) {
+	username, exist := handler.consumeTicket(r.URL.Query().Get("ticket"))
+	if !exist {
+		redirect(w, r, "/default2.aspx")
+		return
+	}
+	session := randomId()[:24]
+	handler.lock.Lock()
+	handler.sessions[session] = username
+	handler.lock.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "ASP.NET_SessionId", Value: session, Path: "/", HttpOnly: true})
+	writeHTML(w, `<html><body><span id="xhxm">`+username+`同学</span></body></html>`)
+}
+
+// eduPage 校验 ASP.NET_SessionId 与学号后返回页面夹具，会话无效时与教务系统一样跳转到登录页
+func (handler *ZhengFangHandler) eduPage(w http.ResponseWriter, r *http.Request, page string) {
+	username := ""
+	if cookie, err := r.Cookie("ASP.NET_SessionId"); err == nil {
+		handler.lock.Lock()
+		username = handler.sessions[cookie.Value]
+		handler.lock.Unlock()
+	}
+	query := r.URL.Query()
+	if username == "" || (query.Get("xh") != username && query.Get("zgh") != username) {
+		redirect(w, r, "/default2.aspx")
+		return
+	}
+	names := []string{page}
+	if r.Method == "POST" {
+		if r.ParseForm() != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		generator, exist := handler.viewStateGenerator[page]
+		if exist && r.PostForm.Get("__VIEWSTATEGENERATOR") != generator {
+			http.Error(w, "Validation of viewstate MAC failed.", http.StatusInternalServerError)
+			return
+		}
+		var values []string
+		for _, key := range zhengFangPostKeys[page] {
+			if value := r.PostForm.Get(key); value != "" {
+				values = append(values, value)
+			}
+		}
+		names = append([]string{page + "_post"}, names...)
+		if len(values) > 0 {
+			names = append([]string{page + "_" + strings.Join(values, "_")}, names...)
+		}
+	}
+	for _, name := range names {
+		if !fixtureNameRegexp.MatchString(name) {
+			continue
+		}
+		content, err := fs.ReadFile(handler.fixtures, path.Join(username, name+".html"))
+		if err == nil {
+			writeHTML(w, string(content))
+			return
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (handler *ZhengFangHandler) consumeTicket(ticket string) (string, bool) {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	username, exist := handler.tickets[ticket]
+	delete(handler.tickets, ticket)
+	return username, exist
+}
+
+func (handler *ZhengFangHandler) tgtUser(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie("CASTGC")
+	if err != nil {
+		return "", false
+	}
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	username, exist := handler.tgts[cookie.Value]
+	return username, exist
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, path string) {
+	w.Header().Set("Location", "http://"+r.Host+path)
+	w.WriteHeader(http.StatusFound)
+}
+
+func writeHTML(w http.ResponseWriter, content string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(content))
+}
+
+func randomId() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,185 @@
+package mock_test
+
+import (
+	"SCITEduTool/Application/manager"
+	"SCITEduTool/Application/mock"
+	"SCITEduTool/Application/module"
+	"SCITEduTool/Application/unit"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testUsername = "2019010101"
+	testPassword = "123456"
+	testYear     = "2020-2021"
+	testSemester = 1
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "zhengfang")
+	if err != nil {
+		panic(err)
+	}
+	unit.InitSQL(unit.SqlConfig{
+		Driver: "sqlite",
+		Path:   filepath.Join(dir, "test.db"),
+	})
+	if _, errMessage := unit.MigrationUnit.Up(0, false); errMessage.HasInfo {
+		panic("数据库迁移失败")
+	}
+	code := m.Run()
+	_ = unit.DB.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setupServer 启动使用仓库内夹具的模拟服务器，并将教务系统指向该服务器
+func setupServer(t *testing.T) {
+	setupServerWith(t, "fixtures/zhengfang")
+}
+
+func setupServerWith(t *testing.T, dir string) {
+	server, conf, err := mock.NewZhengFangServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	errMessage := module.InitEduSystem(module.EduConfig{
+		System:    "zhengfang",
+		ZhengFang: conf,
+	})
+	if errMessage.HasInfo {
+		t.Fatal("教务系统配置失败")
+	}
+}
+
+// encryptPassword 以登录接口的 pkcs1 格式加密密码
+func encryptPassword(t *testing.T, password string) string {
+	item, err := unit.GenerateRSAKey("test", 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unit.RSAStaticUnit.SetKeyring(unit.KeyringConfig{
+		Keys:      []unit.RSAKeyItem{item},
+		ActiveKid: item.Kid,
+	})
+	key, err := unit.ParseRSAKey(item.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := rsa.EncryptPKCS1v15(rand.Reader, &key.PublicKey, []byte("12345678"+password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unit.CipherText{
+		Scheme: unit.CipherPKCS1,
+		Kid:    item.Kid,
+		Data:   base64.StdEncoding.EncodeToString(data),
+	}.String()
+}
+
+func login(t *testing.T) (string, manager.UserInfo) {
+	setupServer(t)
+	ctx := context.Background()
+	session, identify, errMessage := module.CurrentEduSystem.Login(ctx, testUsername, encryptPassword(t, testPassword))
+	if errMessage.HasInfo {
+		t.Fatalf("登录失败：%d", errMessage.Code)
+	}
+	if session == "" || identify != 0 {
+		t.Fatalf("登录结果错误：session=%q identify=%d", session, identify)
+	}
+	info, errMessage := module.CurrentEduSystem.Info(ctx, testUsername, session, identify)
+	if errMessage.HasInfo {
+		t.Fatalf("用户信息获取失败：%d", errMessage.Code)
+	}
+	return session, info
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	setupServer(t)
+	_, _, errMessage := module.CurrentEduSystem.Login(context.Background(), testUsername, encryptPassword(t, "wrong"))
+	if errMessage.Code != -401 {
+		t.Fatalf("密码错误时应返回 -401，实际为 %d", errMessage.Code)
+	}
+}
+
+func TestEmbeddedFixtures(t *testing.T) {
+	setupServerWith(t, "")
+	_, _, errMessage := module.CurrentEduSystem.Login(context.Background(), testUsername, encryptPassword(t, testPassword))
+	if errMessage.HasInfo {
+		t.Fatalf("使用内置夹具登录失败：%d", errMessage.Code)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	_, info := login(t)
+	if info.Name != "张三" || info.Identify != 0 || info.Grade != 2019 || info.Faculty != 5 ||
+		info.Specialty != 501 || info.Class != 1 {
+		t.Fatalf("用户信息解析错误：%+v", info)
+	}
+}
+
+func TestTable(t *testing.T) {
+	session, info := login(t)
+	table, errMessage := module.CurrentEduSystem.Table(context.Background(), testUsername, info, testYear, testSemester, session)
+	if errMessage.HasInfo {
+		t.Fatalf("课表获取失败：%d", errMessage.Code)
+	}
+	first := table.Object[0][0].Data
+	if len(first) != 1 || first[0].Name != "高等数学" || first[0].Teacher != "李四" || first[0].Room != "A101" ||
+		len(first[0].Range) != 16 {
+		t.Fatalf("周一第一节课表解析错误：%+v", first)
+	}
+	english := table.Object[2][0].Data
+	if len(english) != 2 || english[0].Name != "大学英语" || english[1].Name != "大学英语听说" ||
+		english[0].Range[0] != 1 || english[1].Range[0] != 2 {
+		t.Fatalf("单双周课表解析错误：%+v", english)
+	}
+	programming := table.Object[1][1].Data
+	if len(programming) != 1 || programming[0].Range[8] != 10 {
+		t.Fatalf("停课周课表解析错误：%+v", programming)
+	}
+}
+
+func TestAchieve(t *testing.T) {
+	session, info := login(t)
+	achieve, errMessage := module.CurrentEduSystem.Achieve(context.Background(), testUsername, info, testYear, testSemester, session)
+	if errMessage.HasInfo {
+		t.Fatalf("成绩获取失败：%d", errMessage.Code)
+	}
+	if len(achieve.Current) != 4 || len(achieve.Failed) != 1 {
+		t.Fatalf("成绩单条数错误：%+v", achieve)
+	}
+	english := achieve.Current[2]
+	if english.Name != "大学英语" || english.Mark != "55" || english.Retake != "65" || english.Credit != "3.0" {
+		t.Fatalf("补考成绩解析错误：%+v", english)
+	}
+	if achieve.Current[1].Mark != "优秀" {
+		t.Fatalf("等级制成绩解析错误：%+v", achieve.Current[1])
+	}
+	if achieve.Failed[0].Name != "线性代数" || achieve.Failed[0].Mark != "45" {
+		t.Fatalf("未通过成绩解析错误：%+v", achieve.Failed[0])
+	}
+}
+
+func TestExam(t *testing.T) {
+	session, info := login(t)
+	exam, errMessage := module.CurrentEduSystem.Exam(context.Background(), testUsername, session, info.Identify, testYear, testSemester)
+	if errMessage.HasInfo {
+		t.Fatalf("考试安排获取失败：%d", errMessage.Code)
+	}
+	if len(exam.Object) != 2 {
+		t.Fatalf("考试安排条数错误：%+v", exam)
+	}
+	first := exam.Object[0]
+	if first.Name != "高等数学" || first.Time != "2021年01月12日(08:30-10:30)" || first.Location != "A101" ||
+		first.SetNum != "12" {
+		t.Fatalf("考试安排解析错误：%+v", first)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -18,17 +21,40 @@ import (
 )
 
 type achieveModule interface {
-	ExtractPrepare(info ExtractTaskInfo) (TaskStatus, stdio.MessagedError)
+	ExtractPrepare(ctx context.Context, info ExtractTaskInfo) (TaskStatus, stdio.MessagedError)
 	ExtractFinal(info ExtractTaskInfo) stdio.MessagedError
-	ExtractLink(info ExtractTaskInfo, accessToken string) string
-	Get(username string, year string, semester int) (manager.AchieveObject, stdio.MessagedError)
-	Refresh(username string, year string, semester int, session string, info manager.UserInfo) (manager.AchieveObject, stdio.MessagedError)
+	ExtractLink(ctx context.Context, info ExtractTaskInfo, accessToken string) (string, stdio.MessagedError)
+	Get(ctx context.Context, username string, year string, semester int, force bool) (manager.AchieveObject, stdio.MessagedError)
+	Refresh(ctx context.Context, username string, year string, semester int, session string, info manager.UserInfo) (manager.AchieveObject, stdio.MessagedError)
+	Stats(ctx context.Context, username string, year string, semester int) (AchieveStats, stdio.MessagedError)
+	Updates(ctx context.Context, username string, since int64) ([]manager.AchieveUpdate, stdio.MessagedError)
 }
 
 type achieveModuleImpl struct{}
 
 var AchieveModule achieveModule = achieveModuleImpl{}
 
+type AchieveStats struct {
+	GPA          float64              `json:"gpa"`
+	AverageScore float64              `json:"average_score"`
+	TotalCredit  float64              `json:"total_credit"`
+	EarnedCredit float64              `json:"earned_credit"`
+	CourseCount  int                  `json:"course_count"`
+	FailedCount  int                  `json:"failed_count"`
+	RetakeCount  int                  `json:"retake_count"`
+	Courses      []CourseAchieveStats `json:"courses"`
+}
+
+type CourseAchieveStats struct {
+	Name   string  `json:"name"`
+	Credit float64 `json:"credit"`
+	Score  float64 `json:"score"`
+	Point  float64 `json:"point"`
+	Passed bool    `json:"passed"`
+	// Retake 为 none、retake（补考）或 rebuild（重修）
+	Retake string `json:"retake"`
+}
+
 type ExtractTaskInfo struct {
 	Username    string
 	TaskID      int
@@ -61,7 +87,7 @@ type FailedTaskInfo struct {
 	ErrorInfo string `json:"error_info"`
 }
 
-func (achieveModuleImpl achieveModuleImpl) ExtractPrepare(info ExtractTaskInfo) (TaskStatus, stdio.MessagedError) {
+func (achieveModuleImpl achieveModuleImpl) ExtractPrepare(ctx context.Context, info ExtractTaskInfo) (TaskStatus, stdio.MessagedError) {
 	status := TaskStatus{
 		TaskID:  info.TaskID,
 		Success: make([]SingleTaskInfo, 0),
@@ -95,8 +121,8 @@ func (achieveModuleImpl achieveModuleImpl) ExtractPrepare(info ExtractTaskInfo)
 			})
 			continue
 		}
-		data, errMessage := manager.AchieveManager.Get(singleTask.Username, info.Year, info.Semester)
-		if errMessage.HasInfo {
+		data, err := manager.AchieveManager.Get(ctx, singleTask.Username, info.Year, info.Semester)
+		if err != nil {
 			status.Failed = append(status.Failed, FailedTaskInfo{
 				Name:      singleTask.Name,
 				Username:  singleTask.Username,
@@ -104,7 +130,7 @@ func (achieveModuleImpl achieveModuleImpl) ExtractPrepare(info ExtractTaskInfo)
 			})
 			continue
 		}
-		err := ioutil.WriteFile(extractPath+singleTask.Username+".xlsx", data.Data, 0644)
+		err = ioutil.WriteFile(extractPath+singleTask.Username+".xlsx", data.Data, 0644)
 		if err != nil {
 			status.Failed = append(status.Failed, FailedTaskInfo{
 				Name:      singleTask.Name,
@@ -148,8 +174,11 @@ func (achieveModuleImpl achieveModuleImpl) ExtractFinal(info ExtractTaskInfo) st
 	return stdio.GetEmptyErrorMessage()
 }
 
-func (achieveModuleImpl achieveModuleImpl) ExtractLink(info ExtractTaskInfo, accessToken string) string {
-	appSecret := manager.SignManager.GetDefaultAppSecretByPlatform("web")
+func (achieveModuleImpl achieveModuleImpl) ExtractLink(ctx context.Context, info ExtractTaskInfo, accessToken string) (string, stdio.MessagedError) {
+	appSecret, err := manager.SignManager.GetDefaultAppSecretByPlatform(ctx, "web")
+	if err != nil {
+		return "", manager.ErrorMessage(info.Username, err)
+	}
 	arg := "access_token=" + accessToken + "&task_id=" +
 		strconv.Itoa(info.TaskID) + "&ts=" + strconv.Itoa(info.TaskID*300)
 	h := md5.New()
@@ -162,20 +191,35 @@ func (achieveModuleImpl achieveModuleImpl) ExtractLink(info ExtractTaskInfo, acc
 	//ELSE IF
 	link = "https://tool.eclass.sgpublic.xyz/api/achieve/extract/download?"
 	//ENDIF
-	return link + arg
+	return link + arg, stdio.GetEmptyErrorMessage()
 }
 
-func (achieveModuleImpl achieveModuleImpl) Get(username string, year string, semester int) (manager.AchieveObject,
+func (achieveModuleImpl achieveModuleImpl) Get(ctx context.Context, username string, year string, semester int, force bool) (manager.AchieveObject,
 	stdio.MessagedError) {
-	session, _, errMessage := SessionModule.Get(username, "")
+	info, errMessage := InfoModule.Get(ctx, username)
 	if errMessage.HasInfo {
 		return manager.AchieveObject{}, errMessage
 	}
-	info, errMessage := InfoModule.Get(username)
+	if !force {
+		achieve, err := manager.AchieveManager.GetAchieve(ctx, username, info, year, semester)
+		if err != nil {
+			return manager.AchieveObject{}, manager.ErrorMessage(username, err)
+		}
+		if achieve.Exist && !achieve.Expired {
+			var object = manager.AchieveObject{}
+			err := json.Unmarshal([]byte(achieve.Achieve), &object)
+			if err != nil {
+				return manager.AchieveObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+			}
+			return object, stdio.GetEmptyErrorMessage()
+		}
+	}
+
+	session, _, errMessage := SessionModule.Get(ctx, username, "")
 	if errMessage.HasInfo {
 		return manager.AchieveObject{}, errMessage
 	}
-	tableContent, errMessage := AchieveModule.Refresh(username, year, semester, session, info)
+	tableContent, errMessage := AchieveModule.Refresh(ctx, username, year, semester, session, info)
 	if errMessage.HasInfo {
 		return manager.AchieveObject{}, errMessage
 	} else {
@@ -183,42 +227,44 @@ func (achieveModuleImpl achieveModuleImpl) Get(username string, year string, sem
 	}
 }
 
-func (achieveModuleImpl achieveModuleImpl) Refresh(username string, year string, semester int, session string,
+func (achieveModuleImpl achieveModuleImpl) Refresh(ctx context.Context, username string, year string, semester int, session string,
 	info manager.UserInfo) (manager.AchieveObject,
 	stdio.MessagedError) {
-	switch info.Identify {
-	case 0:
-		return studentAchieve(username, year, semester, session, info)
-	case 1:
-		return teacherAchieve()
-	default:
-		return manager.AchieveObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	achieveObject, errMessage := CurrentEduSystem.Achieve(ctx, username, info, year, semester, session)
+	if errMessage.HasInfo {
+		return manager.AchieveObject{}, errMessage
+	}
+	err := manager.AchieveManager.Update(ctx, username, info, year, semester, achieveObject)
+	if err != nil {
+		stdio.LogWarn(username, "成绩单文件生成失败", err)
+	}
+	previous, err := manager.AchieveManager.GetAchieve(ctx, username, info, year, semester)
+	if err == nil && previous.Exist {
+		diffAchieve(ctx, username, year, semester, previous, achieveObject)
 	}
+	err = manager.AchieveManager.UpdateAchieve(ctx, username, info, year, semester, achieveObject)
+	if err != nil {
+		return manager.AchieveObject{}, manager.ErrorMessage(username, err)
+	}
+	return achieveObject, stdio.GetEmptyErrorMessage()
 }
 
-func studentAchieve(username string, year string, semester int, session string,
-	info manager.UserInfo) (manager.AchieveObject,
-	stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
+func (zhengFangSystem zhengFangSystem) studentAchieve(ctx context.Context, username string, year string, semester int,
+	session string) (manager.AchieveObject, stdio.MessagedError) {
 	Button1 := "按学期查询"
 	if year == "all" {
 		Button1 = "在校学习成绩查询"
 	} else if semester == 0 {
 		Button1 = "按学年查询"
 	}
-	urlString := "http://218.6.163.93:8081/xscj.aspx?xh=" + username
-	req, _ := http.NewRequest("GET", urlString, nil)
+	urlString := zhengFangSystem.page("xscj") + "?xh=" + username
+	req, _ := http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 	req.Header.Add("Referer", urlString)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := client.Do(req)
+	resp, err := unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return manager.AchieveObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.AchieveObject{}, unit.UpstreamErrorMessage(username, err)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
@@ -232,20 +278,19 @@ func studentAchieve(username string, year string, semester int, session string,
 
 	form := url.Values{}
 	form.Set("__VIEWSTATE", viewState)
-	form.Set("__VIEWSTATEGENERATOR", "17EB693E")
+	form.Set("__VIEWSTATEGENERATOR", zhengFangSystem.viewStateGenerator("xscj"))
 	form.Set("ddlXN", year)
 	form.Set("ddlXQ", strconv.Itoa(semester))
 	form.Set("txtQSCJ", "0")
 	form.Set("txtZZCJ", "100")
 	form.Set("Button1", Button1)
-	req, _ = http.NewRequest("POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
+	req, _ = http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
 	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 	req.Header.Add("Referer", urlString)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err = client.Do(req)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return manager.AchieveObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.AchieveObject{}, unit.UpstreamErrorMessage(username, err)
 	}
 
 	body, err = ioutil.ReadAll(resp.Body)
@@ -321,10 +366,97 @@ next:
 	}
 
 result:
-	manager.AchieveManager.Update(username, info, year, semester, achieveObject)
 	return achieveObject, stdio.GetEmptyErrorMessage()
 }
 
-func teacherAchieve() (manager.AchieveObject, stdio.MessagedError) {
-	return manager.AchieveObject{}, stdio.GetErrorMessage(-500, "什么？老师还有成绩单？(°Д°≡°Д°)")
+// diffAchieve 对比已存储的成绩，为新出现的课程记录新出成绩事件，首次获取成绩时不记录
+func diffAchieve(ctx context.Context, username string, year string, semester int, previous manager.AchieveContent, current manager.AchieveObject) {
+	previousObject := manager.AchieveObject{}
+	err := json.Unmarshal([]byte(previous.Achieve), &previousObject)
+	if err != nil {
+		return
+	}
+	previousItems := make(map[string]bool)
+	for _, item := range previousObject.Current {
+		previousItems[item.Name] = true
+	}
+	for _, item := range current.Current {
+		if previousItems[item.Name] {
+			continue
+		}
+		err = manager.AchieveManager.InsertUpdate(ctx, username, year, semester, item)
+		if err != nil {
+			stdio.LogWarn(username, "新出成绩记录失败", err)
+		}
+	}
+}
+
+func (achieveModuleImpl achieveModuleImpl) Updates(ctx context.Context, username string, since int64) ([]manager.AchieveUpdate, stdio.MessagedError) {
+	updates, err := manager.AchieveManager.GetUpdates(ctx, username, since, 50)
+	if err != nil {
+		return nil, manager.ErrorMessage(username, err)
+	}
+	return updates, stdio.GetEmptyErrorMessage()
+}
+
+// Stats 计算学分加权平均绩点与学分统计，课程成绩取原成绩、补考成绩与重修成绩中的最高值，
+// 无法识别成绩的课程不计入绩点
+func (achieveModuleImpl achieveModuleImpl) Stats(ctx context.Context, username string, year string, semester int) (AchieveStats, stdio.MessagedError) {
+	achieve, errMessage := AchieveModule.Get(ctx, username, year, semester, false)
+	if errMessage.HasInfo {
+		return AchieveStats{}, errMessage
+	}
+	stats := AchieveStats{
+		Courses: []CourseAchieveStats{},
+	}
+	var weightedPoint float64
+	var weightedScore float64
+	var weightedCredit float64
+	for _, item := range achieve.Current {
+		course := CourseAchieveStats{
+			Name:   item.Name,
+			Retake: "none",
+		}
+		course.Credit, _ = strconv.ParseFloat(strings.TrimSpace(item.Credit), 64)
+		score, point, ok := manager.GradePointManager.Parse(item.Mark)
+		if retakeScore, retakePoint, retakeOk := manager.GradePointManager.Parse(item.Retake); retakeOk {
+			course.Retake = "retake"
+			if !ok || retakeScore > score {
+				score, point, ok = retakeScore, retakePoint, true
+			}
+		}
+		if rebuildScore, rebuildPoint, rebuildOk := manager.GradePointManager.Parse(item.Rebuild); rebuildOk {
+			course.Retake = "rebuild"
+			if !ok || rebuildScore > score {
+				score, point, ok = rebuildScore, rebuildPoint, true
+			}
+		}
+		if course.Retake != "none" {
+			stats.RetakeCount++
+		}
+		stats.CourseCount++
+		stats.TotalCredit += course.Credit
+		if !ok {
+			stats.Courses = append(stats.Courses, course)
+			continue
+		}
+		course.Score = score
+		course.Point = point
+		course.Passed = manager.GradePointManager.Passed(score)
+		if course.Passed {
+			stats.EarnedCredit += course.Credit
+		} else {
+			stats.FailedCount++
+		}
+		weightedPoint += point * course.Credit
+		weightedScore += score * course.Credit
+		weightedCredit += course.Credit
+		stats.Courses = append(stats.Courses, course)
+	}
+	if weightedCredit > 0 {
+		stats.GPA = math.Round(weightedPoint/weightedCredit*100) / 100
+		stats.AverageScore = math.Round(weightedScore/weightedCredit*100) / 100
+	}
+	stdio.LogVerbose(username, "用户获取成绩统计成功")
+	return stats, stdio.GetEmptyErrorMessage()
 }
@@ -0,0 +1,45 @@
+package module
+
+import (
+	"SCITEduTool/Application/manager"
+	"SCITEduTool/Application/stdio"
+	"context"
+)
+
+// EduSystem 教务系统适配接口，各模块通过 CurrentEduSystem 访问上游教务系统。
+// 课表与用户信息依赖上游系统内部编号（如课表 ID、院系专业编号），由实现方负责写入数据库，ctx 取消时应尽快返回
+type EduSystem interface {
+	Name() string
+	VerifyLocation(ctx context.Context, username string, password string) (string, int, stdio.MessagedError)
+	Login(ctx context.Context, username string, password string) (string, int, stdio.MessagedError)
+	Info(ctx context.Context, username string, session string, identify int) (manager.UserInfo, stdio.MessagedError)
+	Table(ctx context.Context, username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError)
+	Achieve(ctx context.Context, username string, info manager.UserInfo, year string, semester int, session string) (manager.AchieveObject, stdio.MessagedError)
+	Exam(ctx context.Context, username string, session string, identify int, year string, semester int) (manager.ExamObject, stdio.MessagedError)
+}
+
+type EduConfig struct {
+	System    string          `json:"system"`
+	ZhengFang ZhengFangConfig `json:"zhengfang"`
+}
+
+var CurrentEduSystem EduSystem = newZhengFangSystem(GetDefaultZhengFangConfig())
+
+func GetDefaultEduConfig() EduConfig {
+	return EduConfig{
+		System:    "zhengfang",
+		ZhengFang: GetDefaultZhengFangConfig(),
+	}
+}
+
+func InitEduSystem(conf EduConfig) stdio.MessagedError {
+	switch conf.System {
+	case "", "zhengfang":
+		CurrentEduSystem = newZhengFangSystem(conf.ZhengFang)
+	default:
+		stdio.LogWarn("", "不支持的教务系统类型："+conf.System, nil)
+		return stdio.GetErrorMessage(-500, "教务系统配置解析失败")
+	}
+	stdio.LogVerbose("", "教务系统配置成功："+CurrentEduSystem.Name())
+	return stdio.GetEmptyErrorMessage()
+}
@@ -1,74 +1,177 @@
 package module
 
 import (
+	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"context"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
 )
 
 type examModule interface {
-	Get(username string) (ExamObject, stdio.MessagedError)
-	Refresh(username string, session string, identify int) (ExamObject, stdio.MessagedError)
+	Get(ctx context.Context, username string, year string, semester int) (manager.ExamObject, stdio.MessagedError)
+	Refresh(ctx context.Context, username string, session string, identify int, year string, semester int) (manager.ExamObject, stdio.MessagedError)
+	Calendar(ctx context.Context, username string, year string, semester int) (string, stdio.MessagedError)
 }
 
 type examModuleImpl struct{}
 
 var ExamModule examModule = examModuleImpl{}
 
-type ExamItem struct {
-	Name     string `json:"name"`
-	Time     string `json:"time"`
-	Location string `json:"location"`
-	SetNum   string `json:"set_num"`
-}
-
-type ExamObject struct {
-	Object []ExamItem `json:"exam"`
-}
+func (examModuleImpl examModuleImpl) Get(ctx context.Context, username string, year string, semester int) (manager.ExamObject, stdio.MessagedError) {
+	exam, err := manager.ExamManager.Get(ctx, username, year, semester)
+	if err != nil {
+		return manager.ExamObject{}, manager.ErrorMessage(username, err)
+	}
+	if exam.Exist && !exam.Expired {
+		var object = manager.ExamObject{}
+		err = json.Unmarshal([]byte(exam.Exam), &object)
+		if err != nil {
+			return manager.ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		}
+		return object, stdio.GetEmptyErrorMessage()
+	}
 
-func (examModuleImpl examModuleImpl) Get(username string) (ExamObject, stdio.MessagedError) {
-	session, identify, errMessage := SessionModule.Get(username, "")
+	session, identify, errMessage := SessionModule.Get(ctx, username, "")
 	if errMessage.HasInfo {
-		return ExamObject{}, errMessage
+		return manager.ExamObject{}, errMessage
 	}
-	examContent, errMessage := ExamModule.Refresh(username, session, identify)
+	examContent, errMessage := ExamModule.Refresh(ctx, username, session, identify, year, semester)
 	if errMessage.HasInfo {
-		return ExamObject{}, errMessage
+		return manager.ExamObject{}, errMessage
 	} else {
 		return examContent, stdio.GetEmptyErrorMessage()
 	}
 }
 
-func (examModuleImpl examModuleImpl) Refresh(username string, session string, identify int) (ExamObject,
-	stdio.MessagedError) {
-	switch identify {
-	case 0:
-		return studentExam(username, session)
-	case 1:
-		return teacherExam()
-	default:
-		return ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+func (examModuleImpl examModuleImpl) Refresh(ctx context.Context, username string, session string, identify int, year string,
+	semester int) (manager.ExamObject, stdio.MessagedError) {
+	examObject, errMessage := CurrentEduSystem.Exam(ctx, username, session, identify, year, semester)
+	if errMessage.HasInfo {
+		return manager.ExamObject{}, errMessage
 	}
+
+	stored, err := manager.ExamManager.Get(ctx, username, year, semester)
+	if err != nil {
+		return manager.ExamObject{}, manager.ErrorMessage(username, err)
+	}
+	if stored.Exist {
+		previous := manager.ExamObject{}
+		err = json.Unmarshal([]byte(stored.Exam), &previous)
+		if err != nil {
+			stdio.LogWarn(username, "已缓存考试安排解析失败", err)
+		} else {
+			diffExam(ctx, username, year, semester, previous, examObject)
+		}
+	}
+	err = manager.ExamManager.Update(ctx, username, year, semester, examObject)
+	if err != nil {
+		return manager.ExamObject{}, manager.ErrorMessage(username, err)
+	}
+	return examObject, stdio.GetEmptyErrorMessage()
 }
 
-func studentExam(username string, session string) (ExamObject,
-	stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
+// diffExam 比对新旧考试安排，时间或地点变化时记录变更并标记。同一课程可能有多场考试（如正考与补考），
+// 故先按课程名称与时间匹配未变化的考试，剩余考试中同名且仅有一场的视为同一场考试被调整。
+// 此前已标记的变更在未再次变化时保留至考试结束，考试时间无法解析时仅保留一次刷新
+func diffExam(ctx context.Context, username string, year string, semester int, previous manager.ExamObject, current manager.ExamObject) {
+	matched := make([]bool, len(previous.Object))
+	pending := make([]int, 0, len(current.Object))
+	for index, item := range current.Object {
+		previousIndex := -1
+		for candidate, previousItem := range previous.Object {
+			if !matched[candidate] && previousItem.Name == item.Name && previousItem.Time == item.Time {
+				previousIndex = candidate
+				break
+			}
+		}
+		if previousIndex < 0 {
+			pending = append(pending, index)
+			continue
+		}
+		matched[previousIndex] = true
+		previousItem := previous.Object[previousIndex]
+		if previousItem.Location == item.Location && previousItem.Room == item.Room {
+			if previousItem.Changed && keepExamChanged(previousItem) {
+				current.Object[index].Changed = true
+				current.Object[index].Previous = previousItem.Previous
+			}
+			continue
+		}
+		markExamChange(ctx, username, year, semester, previousItem, &current.Object[index])
+	}
+	for _, index := range pending {
+		item := current.Object[index]
+		previousIndex := -1
+		for candidate, previousItem := range previous.Object {
+			if matched[candidate] || previousItem.Name != item.Name {
+				continue
+			}
+			if previousIndex >= 0 {
+				// 同名考试有多场发生变化时无法确定对应关系，不记录变更
+				previousIndex = -1
+				break
+			}
+			previousIndex = candidate
+		}
+		if previousIndex < 0 {
+			continue
+		}
+		matched[previousIndex] = true
+		markExamChange(ctx, username, year, semester, previous.Object[previousIndex], &current.Object[index])
+	}
+}
+
+// keepExamChanged 判断已标记的变更是否继续保留，考试结束后不再标记
+func keepExamChanged(item manager.ExamItem) bool {
+	_, end, ok := parseExamTime(item.Time)
+	if !ok {
+		return false
+	}
+	return time.Now().Before(end)
+}
+
+func markExamChange(ctx context.Context, username string, year string, semester int, previousItem manager.ExamItem, item *manager.ExamItem) {
+	change := manager.ExamChange{
+		Name: item.Name,
+		Previous: manager.ExamPrevious{
+			Time:     previousItem.Time,
+			Location: previousItem.Location,
+			Room:     previousItem.Room,
+		},
+		Current: manager.ExamPrevious{
+			Time:     item.Time,
+			Location: item.Location,
+			Room:     item.Room,
 		},
 	}
-	urlString := "http://218.6.163.93:8081/xskscx.aspx?xh=" + username
-	req, _ := http.NewRequest("GET", urlString, nil)
+	err := manager.ExamManager.InsertChange(ctx, username, year, semester, change)
+	if err != nil {
+		stdio.LogWarn(username, "考试安排变更记录失败", err)
+	}
+	item.Changed = true
+	item.Previous = &change.Previous
+}
+
+func (zhengFangSystem zhengFangSystem) studentExam(ctx context.Context, username string, session string, year string, semester int) (manager.ExamObject,
+	stdio.MessagedError) {
+	urlString := zhengFangSystem.page("xskscx") + "?xh=" + username
+	req, _ := http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 	req.Header.Add("Referer", urlString)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := client.Do(req)
+	resp, err := unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.ExamObject{}, unit.UpstreamErrorMessage(username, err)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
@@ -76,15 +179,45 @@ func studentExam(username string, session string) (ExamObject,
 	viewState := r.FindString(string(body))
 	if viewState == "" {
 		stdio.LogError(username, "未发现 __VIEWSTATE", nil)
-		return ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+
+	// 页面默认显示教务系统当前学期，与目标学期不同时需切换学年学期
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		stdio.LogError("", "HTML解析失败", err)
+		return manager.ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	if doc.Find("select[name=xnd]").Find("option[selected]").AttrOr("value", "") != year ||
+		doc.Find("select[name=xqd]").Find("option[selected]").AttrOr("value", "") != strconv.Itoa(semester) {
+		form := url.Values{}
+		form.Set("__EVENTTARGET", "xqd")
+		form.Set("__EVENTARGUMENT", "")
+		form.Set("__VIEWSTATE", doc.Find("#__VIEWSTATE").AttrOr("value", ""))
+		form.Set("xnd", year)
+		form.Set("xqd", strconv.Itoa(semester))
+		req, _ = http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
+		req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
+		req.Header.Add("Referer", urlString)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err = unit.DoUpstream(req)
+		if err != nil {
+			return manager.ExamObject{}, unit.UpstreamErrorMessage(username, err)
+		}
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			stdio.LogError(username, "网络请求失败", err)
+			return manager.ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		}
 	}
 
 	bodyString := string(body)
 	bodyString = strings.ReplaceAll(bodyString, "\n", "")
 	bodyString = strings.ReplaceAll(bodyString, " class=\"alt\"", "")
 
-	examObject := ExamObject{
-		Object: []ExamItem{},
+	examObject := manager.ExamObject{
+		Object: []manager.ExamItem{},
 	}
 
 	var examMatch string
@@ -106,7 +239,7 @@ func studentExam(username string, session string) (ExamObject,
 			continue
 		}
 		explodeExamIndex := r.FindAllString(currentItem, -1)
-		currentExamItem := ExamItem{}
+		currentExamItem := manager.ExamItem{}
 		currentExamItem.Name = explodeExamIndex[1][4 : len(explodeExamIndex[1])-5]
 		currentExamItem.Time = explodeExamIndex[3][4 : len(explodeExamIndex[3])-5]
 		currentExamItem.Location = explodeExamIndex[4][4 : len(explodeExamIndex[4])-5]
@@ -119,6 +252,158 @@ result:
 	return examObject, stdio.GetEmptyErrorMessage()
 }
 
-func teacherExam() (ExamObject, stdio.MessagedError) {
-	return ExamObject{}, stdio.GetErrorMessage(-500, "TODO")
+func (zhengFangSystem zhengFangSystem) teacherExam(ctx context.Context, username string, session string, year string, semester int) (manager.ExamObject, stdio.MessagedError) {
+	urlString := zhengFangSystem.page("jsjkcx") + "?zgh=" + username
+	req, _ := http.NewRequestWithContext(ctx, "GET", urlString, nil)
+	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
+	req.Header.Add("Referer", urlString)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := unit.DoUpstream(req)
+	if err != nil {
+		return manager.ExamObject{}, unit.UpstreamErrorMessage(username, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		stdio.LogError("", "HTML解析失败", err)
+		return manager.ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	viewState := doc.Find("#__VIEWSTATE").AttrOr("value", "")
+	if viewState == "" {
+		stdio.LogError(username, "未发现 __VIEWSTATE", nil)
+		return manager.ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+
+	if doc.Find("select[name=xnd]").Find("option[selected]").AttrOr("value", "") != year ||
+		doc.Find("select[name=xqd]").Find("option[selected]").AttrOr("value", "") != strconv.Itoa(semester) {
+		form := url.Values{}
+		form.Set("__EVENTTARGET", "xqd")
+		form.Set("__EVENTARGUMENT", "")
+		form.Set("__VIEWSTATE", viewState)
+		form.Set("xnd", year)
+		form.Set("xqd", strconv.Itoa(semester))
+		req, _ = http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
+		req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
+		req.Header.Add("Referer", urlString)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err = unit.DoUpstream(req)
+		if err != nil {
+			return manager.ExamObject{}, unit.UpstreamErrorMessage(username, err)
+		}
+		doc, err = goquery.NewDocumentFromReader(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			stdio.LogError("", "HTML解析失败", err)
+			return manager.ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		}
+	}
+
+	examObject := manager.ExamObject{
+		Object: []manager.ExamItem{},
+	}
+	// 监考安排表各列顺序随教务系统版本变化，按表头文字定位各字段所在列
+	columns := map[string]int{}
+	doc.Find("#DataGrid1").Find("tr").Each(func(trIndex int, tr *goquery.Selection) {
+		cells := tr.Find("td").Map(func(_ int, td *goquery.Selection) string {
+			return strings.TrimSpace(strings.ReplaceAll(td.Text(), "\u00a0", ""))
+		})
+		if trIndex == 0 {
+			for index, title := range cells {
+				switch title {
+				case "课程名称":
+					columns["name"] = index
+				case "考试时间":
+					columns["time"] = index
+				case "校区", "考试校区":
+					columns["location"] = index
+				case "考试地点", "教室", "考场":
+					columns["room"] = index
+				case "座位号", "考试人数", "人数":
+					columns["set_num"] = index
+				case "监考类型", "监考角色", "角色":
+					columns["role"] = index
+				}
+			}
+			return
+		}
+		cell := func(key string) string {
+			index, exist := columns[key]
+			if !exist || index >= len(cells) {
+				return ""
+			}
+			return cells[index]
+		}
+		item := manager.ExamItem{
+			Name:     cell("name"),
+			Time:     cell("time"),
+			Location: cell("location"),
+			SetNum:   cell("set_num"),
+			Room:     cell("room"),
+			Role:     cell("role"),
+		}
+		if item.Name == "" {
+			return
+		}
+		if item.Location == "" {
+			item.Location = item.Room
+		}
+		examObject.Object = append(examObject.Object, item)
+	})
+	if len(columns) == 0 {
+		stdio.LogInfo(username, "用户目标学期无监考安排")
+	}
+	stdio.LogVerbose(username, "用户获取监考安排信息成功")
+	return examObject, stdio.GetEmptyErrorMessage()
+}
+
+func (examModuleImpl examModuleImpl) Calendar(ctx context.Context, username string, year string, semester int) (string, stdio.MessagedError) {
+	exam, errMessage := ExamModule.Get(ctx, username, year, semester)
+	if errMessage.HasInfo {
+		return "", errMessage
+	}
+	events := make([]unit.ICalendarEvent, 0)
+	for index, item := range exam.Object {
+		start, end, ok := parseExamTime(item.Time)
+		if !ok {
+			stdio.LogWarn(username, "考试时间解析失败："+item.Time, nil)
+			continue
+		}
+		description := ""
+		if item.Role != "" {
+			description = "监考角色：" + item.Role
+		} else if item.SetNum != "" {
+			description = "座位号：" + item.SetNum
+		}
+		location := item.Location
+		if item.Room != "" && item.Room != item.Location {
+			location += " " + item.Room
+		}
+		events = append(events, unit.ICalendarEvent{
+			UID:         username + "-exam-" + year + "-" + strconv.Itoa(semester) + "-" + strconv.Itoa(index) + "@tool.eclass.sgpublic.xyz",
+			Summary:     item.Name,
+			Location:    location,
+			Description: description,
+			Start:       start,
+			End:         end,
+		})
+	}
+	stdio.LogVerbose(username, "用户导出考试日历成功")
+	return unit.BuildICalendar(year+" 第"+strconv.Itoa(semester)+"学期考试安排", events), stdio.GetEmptyErrorMessage()
+}
+
+var examTimeRegexp = regexp.MustCompile("(\\d{4})\\D(\\d{1,2})\\D(\\d{1,2})\\D*?(\\d{1,2}):(\\d{2})\\s*-\\s*(\\d{1,2}):(\\d{2})")
+
+// parseExamTime 解析形如“2021年01月12日(08:30-10:30)”的考试时间
+func parseExamTime(timeString string) (time.Time, time.Time, bool) {
+	match := examTimeRegexp.FindStringSubmatch(timeString)
+	if match == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	var values [7]int
+	for index := range values {
+		values[index], _ = strconv.Atoi(match[index+1])
+	}
+	start := time.Date(values[0], time.Month(values[1]), values[2], values[3], values[4], 0, 0, time.Local)
+	end := time.Date(values[0], time.Month(values[1]), values[2], values[5], values[6], 0, 0, time.Local)
+	return start, end, true
 }
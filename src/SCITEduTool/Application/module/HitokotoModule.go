@@ -3,24 +3,26 @@ package module
 import (
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 )
 
 type hitokotoModule interface {
-	Get() (manager.HitokotoItem, stdio.MessagedError)
-	Refresh() (manager.HitokotoItem, stdio.MessagedError)
+	Get(ctx context.Context) (manager.HitokotoItem, stdio.MessagedError)
+	Refresh(ctx context.Context) (manager.HitokotoItem, stdio.MessagedError)
 }
 
 type hitokotoModuleImpl struct{}
 
 var HitokotoModule hitokotoModule = hitokotoModuleImpl{}
 
-func (hitokotoModuleImpl hitokotoModuleImpl) Get() (manager.HitokotoItem, stdio.MessagedError) {
-	hitokoto, errMessage := manager.HitokotoManager.Get()
-	if errMessage.HasInfo {
-		return manager.HitokotoItem{}, errMessage
+func (hitokotoModuleImpl hitokotoModuleImpl) Get(ctx context.Context) (manager.HitokotoItem, stdio.MessagedError) {
+	hitokoto, err := manager.HitokotoManager.Get(ctx)
+	if err != nil {
+		return manager.HitokotoItem{}, manager.ErrorMessage("", err)
 	}
 	if !hitokoto.Exist {
 		stdio.LogInfo("", "Hitokoto待更新")
@@ -30,7 +32,7 @@ func (hitokotoModuleImpl hitokotoModuleImpl) Get() (manager.HitokotoItem, stdio.
 	}
 
 insert:
-	hitokoto, errMessage = HitokotoModule.Refresh()
+	hitokoto, errMessage := HitokotoModule.Refresh(ctx)
 	if !errMessage.HasInfo {
 		return hitokoto, stdio.GetEmptyErrorMessage()
 	} else {
@@ -38,17 +40,11 @@ insert:
 	}
 }
 
-func (hitokotoModuleImpl hitokotoModuleImpl) Refresh() (manager.HitokotoItem, stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-	req, _ := http.NewRequest("GET", "https://v1.hitokoto.cn/?encode=json", nil)
-	resp, err := client.Do(req)
+func (hitokotoModuleImpl hitokotoModuleImpl) Refresh(ctx context.Context) (manager.HitokotoItem, stdio.MessagedError) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://v1.hitokoto.cn/?encode=json", nil)
+	resp, err := unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError("", "网络请求失败", err)
-		return manager.HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.HitokotoItem{}, unit.UpstreamErrorMessage("", err)
 	}
 	body, _ := ioutil.ReadAll(resp.Body)
 	_ = resp.Body.Close()
@@ -58,9 +54,9 @@ func (hitokotoModuleImpl hitokotoModuleImpl) Refresh() (manager.HitokotoItem, st
 		stdio.LogError("", "Hitokoto解析失败", err)
 		return manager.HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理失败")
 	}
-	errMessage := manager.HitokotoManager.Insert(item)
-	if errMessage.HasInfo {
-		return manager.HitokotoItem{}, stdio.GetErrorMessage(-500, "请求处理失败")
+	err = manager.HitokotoManager.Insert(ctx, item)
+	if err != nil {
+		return manager.HitokotoItem{}, manager.ErrorMessage("", err)
 	}
 	return item, stdio.GetEmptyErrorMessage()
 }
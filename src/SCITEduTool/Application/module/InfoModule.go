@@ -1,9 +1,10 @@
 package module
 
 import (
-	"SCITEduTool/Application/consts"
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"context"
 	"github.com/PuerkitoBio/goquery"
 	"net/http"
 	"net/url"
@@ -13,18 +14,18 @@ import (
 )
 
 type infoModule interface {
-	Get(username string) (manager.UserInfo, stdio.MessagedError)
-	Refresh(username string, session string, identify int) (manager.UserInfo, stdio.MessagedError)
+	Get(ctx context.Context, username string) (manager.UserInfo, stdio.MessagedError)
+	Refresh(ctx context.Context, username string, session string, identify int) (manager.UserInfo, stdio.MessagedError)
 }
 
 type infoModuleImpl struct{}
 
 var InfoModule infoModule = infoModuleImpl{}
 
-func (infoModuleImpl infoModuleImpl) Get(username string) (manager.UserInfo, stdio.MessagedError) {
-	info, errMessage := manager.InfoManager.Get(username)
-	if errMessage.HasInfo {
-		return manager.UserInfo{}, errMessage
+func (infoModuleImpl infoModuleImpl) Get(ctx context.Context, username string) (manager.UserInfo, stdio.MessagedError) {
+	info, err := manager.InfoManager.Get(ctx, username)
+	if err != nil {
+		return manager.UserInfo{}, manager.ErrorMessage(username, err)
 	}
 	if !info.Exist {
 		stdio.LogInfo(username, "用户信息不存在")
@@ -36,11 +37,11 @@ func (infoModuleImpl infoModuleImpl) Get(username string) (manager.UserInfo, std
 	stdio.LogInfo(username, "用户基本信息过期")
 
 refresh:
-	session, identify, errMessage := SessionModule.Get(username, "")
+	session, identify, errMessage := SessionModule.Get(ctx, username, "")
 	if errMessage.HasInfo {
 		return manager.UserInfo{}, errMessage
 	}
-	info, errMessage = InfoModule.Refresh(username, session, identify)
+	info, errMessage = InfoModule.Refresh(ctx, username, session, identify)
 	if errMessage.HasInfo {
 		return manager.UserInfo{}, errMessage
 	} else {
@@ -48,32 +49,19 @@ refresh:
 	}
 }
 
-func (infoModuleImpl infoModuleImpl) Refresh(username string, session string, identify int) (manager.UserInfo, stdio.MessagedError) {
-	switch identify {
-	case 0:
-		return studentInfo(username, session)
-	case 1:
-		return teacherInfo(username, session)
-	default:
-		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
+func (infoModuleImpl infoModuleImpl) Refresh(ctx context.Context, username string, session string, identify int) (manager.UserInfo, stdio.MessagedError) {
+	return CurrentEduSystem.Info(ctx, username, session, identify)
 }
 
-func studentInfo(username string, session string) (manager.UserInfo, stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-	urlString := "http://218.6.163.93:8081/xsgrxx.aspx?xh=" + username
-	req, _ := http.NewRequest("GET", urlString, nil)
+func (zhengFangSystem zhengFangSystem) studentInfo(ctx context.Context, username string, session string) (manager.UserInfo, stdio.MessagedError) {
+	urlString := zhengFangSystem.page("xsgrxx") + "?xh=" + username
+	req, _ := http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 	req.Header.Add("Referer", urlString)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := client.Do(req)
+	resp, err := unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.UserInfo{}, unit.UpstreamErrorMessage(username, err)
 	}
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	resp.Body.Close()
@@ -134,15 +122,14 @@ func studentInfo(username string, session string) (manager.UserInfo, stdio.Messa
 		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 
-	urlString = "http://218.6.163.93:8081/tjkbcx.aspx?xh=" + username
-	req, _ = http.NewRequest("GET", urlString, nil)
+	urlString = zhengFangSystem.page("tjkbcx") + "?xh=" + username
+	req, _ = http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 	req.Header.Add("Referer", urlString)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err = client.Do(req)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.UserInfo{}, unit.UpstreamErrorMessage(username, err)
 	}
 	doc, err = goquery.NewDocumentFromReader(resp.Body)
 	resp.Body.Close()
@@ -169,7 +156,7 @@ func studentInfo(username string, session string) (manager.UserInfo, stdio.Messa
 		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 
-	yearStart, _ := strconv.Atoi(strings.Split(consts.SchoolYear, "-")[0])
+	yearStart, _ := strconv.Atoi(strings.Split(manager.CalendarManager.Current().SchoolYear, "-")[0])
 	lblZymcId := -1
 	for i := 0; i > -6; i-- {
 		year := strconv.Itoa(yearStart+i) + "-" + strconv.Itoa(yearStart+1+i)
@@ -178,19 +165,18 @@ func studentInfo(username string, session string) (manager.UserInfo, stdio.Messa
 		form.Set("__EVENTARGUMENT", "")
 		form.Set("__LASTFOCUS", "")
 		form.Set("__VIEWSTATE", viewState)
-		form.Set("__VIEWSTATEGENERATOR", "3189F21D")
+		form.Set("__VIEWSTATEGENERATOR", zhengFangSystem.viewStateGenerator("tjkbcx"))
 		form.Set("xn", year)
 		form.Set("xq", "1")
 		form.Set("nj", gradePre)
 		form.Set("xy", strconv.Itoa(lblXyId))
-		req, _ = http.NewRequest("POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
+		req, _ = http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
 		req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 		req.Header.Add("Referer", urlString)
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-		resp, err = client.Do(req)
+		resp, err = unit.DoUpstream(req)
 		if err != nil {
-			stdio.LogError(username, "网络请求失败", err)
-			return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
+			return manager.UserInfo{}, unit.UpstreamErrorMessage(username, err)
 		}
 
 		doc, err = goquery.NewDocumentFromReader(resp.Body)
@@ -216,10 +202,19 @@ func studentInfo(username string, session string) (manager.UserInfo, stdio.Messa
 		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 
-	manager.ChartManager.WriteFacultyName(lblXyId, lblXy)
-	manager.ChartManager.WriteSpecialtyName(lblXyId, lblZymcId, lblZymc)
-	manager.ChartManager.WriteClassName(lblXyId, lblZymcId, class, lblXzb)
-	manager.InfoManager.Update(username, name, lblXyId, lblZymcId, class, grade)
+	err = manager.ChartManager.WriteFacultyName(ctx, lblXyId, lblXy)
+	if err == nil {
+		err = manager.ChartManager.WriteSpecialtyName(ctx, lblXyId, lblZymcId, lblZymc)
+	}
+	if err == nil {
+		err = manager.ChartManager.WriteClassName(ctx, lblXyId, lblZymcId, class, lblXzb)
+	}
+	if err == nil {
+		err = manager.InfoManager.Update(ctx, username, name, lblXyId, lblZymcId, class, grade)
+	}
+	if err != nil {
+		return manager.UserInfo{}, manager.ErrorMessage(username, err)
+	}
 	return manager.UserInfo{
 		Name:      name,
 		Faculty:   lblXyId,
@@ -229,6 +224,32 @@ func studentInfo(username string, session string) (manager.UserInfo, stdio.Messa
 	}, stdio.GetEmptyErrorMessage()
 }
 
-func teacherInfo(username string, session string) (manager.UserInfo, stdio.MessagedError) {
-	return manager.UserInfo{}, stdio.GetErrorMessage(-500, "TODO")
+func (zhengFangSystem zhengFangSystem) teacherInfo(ctx context.Context, username string, session string) (manager.UserInfo, stdio.MessagedError) {
+	urlString := zhengFangSystem.page("js_main") + "?xh=" + username
+	req, _ := http.NewRequestWithContext(ctx, "GET", urlString, nil)
+	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
+	req.Header.Add("Referer", urlString)
+	resp, err := unit.DoUpstream(req)
+	if err != nil {
+		return manager.UserInfo{}, unit.UpstreamErrorMessage(username, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		stdio.LogError("", "HTML解析失败", err)
+		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	name := strings.TrimSuffix(strings.TrimSpace(doc.Find("#xhxm").Text()), "老师")
+	if name == "" {
+		stdio.LogError(username, "教师姓名获取失败", nil)
+		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	err = manager.InfoManager.Update(ctx, username, name, 0, 0, 0, 0)
+	if err != nil {
+		return manager.UserInfo{}, manager.ErrorMessage(username, err)
+	}
+	return manager.UserInfo{
+		Name:     name,
+		Identify: 1,
+	}, stdio.GetEmptyErrorMessage()
 }
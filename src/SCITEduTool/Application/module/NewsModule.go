@@ -3,97 +3,253 @@ package module
 import (
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"context"
+	"encoding/base64"
+	"errors"
 	"net/http"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 type newsModule interface {
-	ListNewsByType(tid int, page int) ([]manager.NewsItem, bool, stdio.MessagedError)
-	GetTypeChart() ([]manager.NewsTypeChartItem, stdio.MessagedError)
-	RefreshTypeChart() ([]manager.NewsTypeChartItem, stdio.MessagedError)
-	GetNewsById(tid int, id int) (manager.NewsItem, stdio.MessagedError)
-	RefreshNews(tid int, id int) (manager.NewsItem, stdio.MessagedError)
-	GetHeadlines() ([]manager.NewsItem, stdio.MessagedError)
-	RefreshHeadlines() ([]manager.NewsItem, stdio.MessagedError)
+	InitNews(conf NewsConfig)
+	ListNewsByType(ctx context.Context, tid int, cursor string, page int, size int) ([]manager.NewsItem, string, bool, stdio.MessagedError)
+	SyncNews(ctx context.Context, tid int, pages int) stdio.MessagedError
+	GetTypeChart(ctx context.Context) ([]manager.NewsTypeChartItem, stdio.MessagedError)
+	RefreshTypeChart(ctx context.Context) ([]manager.NewsTypeChartItem, stdio.MessagedError)
+	GetNewsById(ctx context.Context, tid int, id int) (manager.NewsItem, stdio.MessagedError)
+	RefreshNews(ctx context.Context, tid int, id int) (manager.NewsItem, stdio.MessagedError)
+	GetHeadlines(ctx context.Context) ([]manager.NewsItem, stdio.MessagedError)
+	RefreshHeadlines(ctx context.Context) ([]manager.NewsItem, stdio.MessagedError)
+	GetNewsContent(ctx context.Context, tid int, id int) (manager.NewsContentObject, stdio.MessagedError)
+	RefreshNewsContent(ctx context.Context, tid int, id int) (manager.NewsContentObject, stdio.MessagedError)
+	SearchNews(ctx context.Context, keyword string, tid int, start string, end string, page int) ([]manager.NewsItem, bool, stdio.MessagedError)
+	GetFeed(ctx context.Context, tid int) (unit.Feed, stdio.MessagedError)
+	GetHeadlinesFeed(ctx context.Context) (unit.Feed, stdio.MessagedError)
 }
 
 type newsModuleImpl struct{}
 
 var NewsModule newsModule = newsModuleImpl{}
 
-func (newsModuleImpl newsModuleImpl) ListNewsByType(tid int, page int) ([]manager.NewsItem, bool, stdio.MessagedError) {
-	exist, errMessage := manager.NewsManager.CheckChartExist(tid)
-	if errMessage.HasInfo {
-		stdio.LogInfo("", "新闻类别查询失败")
-		return nil, false, errMessage
-	}
-	if !exist {
-		stdio.LogInfo("", "新闻类别不存在")
-		return nil, false, stdio.GetErrorMessage(-500, "请求处理出错")
+const (
+	newsWorkerCount = 5
+	newsHostLimit   = 4
+	newsCallTimeout = time.Minute
+)
+
+type NewsConfig struct {
+	PageSize    int `json:"page_size"`
+	MaxPageSize int `json:"max_page_size"`
+	// SyncInterval 新闻列表的缓存有效期（秒），读取第一页时该类别距上次同步超过此时间则重新同步
+	SyncInterval int `json:"sync_interval"`
+}
+
+var newsConfig = GetDefaultNewsConfig()
+
+var newsCallGroup = unit.NewCallGroup(newsCallTimeout)
+var newsHostLimiter = unit.NewHostLimiter(newsHostLimit)
+
+// newsSyncTime 记录各类别最近一次同步成功的时间，进程重启后首次读取会重新同步
+var newsSyncTime = struct {
+	sync.Mutex
+	items map[int]time.Time
+}{items: map[int]time.Time{}}
+
+func GetDefaultNewsConfig() NewsConfig {
+	return NewsConfig{
+		PageSize:     10,
+		MaxPageSize:  50,
+		SyncInterval: 600,
 	}
+}
 
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+func (newsModuleImpl newsModuleImpl) InitNews(conf NewsConfig) {
+	defaultConf := GetDefaultNewsConfig()
+	if conf.MaxPageSize <= 0 {
+		conf.MaxPageSize = defaultConf.MaxPageSize
+	}
+	if conf.PageSize <= 0 || conf.PageSize > conf.MaxPageSize {
+		stdio.LogWarn("", "新闻分页大小不正确，将使用默认值", nil)
+		conf.PageSize = defaultConf.PageSize
+		if conf.PageSize > conf.MaxPageSize {
+			conf.PageSize = conf.MaxPageSize
+		}
+	}
+	if conf.SyncInterval <= 0 {
+		stdio.LogWarn("", "新闻同步间隔不正确，将使用默认值", nil)
+		conf.SyncInterval = defaultConf.SyncInterval
 	}
+	newsConfig = conf
+	stdio.LogVerbose("", "新闻配置成功")
+}
 
-	pageIndex := strconv.Itoa(page/2 + 1)
-	urlString := "http://www.scit.cn/newslist" + strconv.Itoa(tid) + "_" + pageIndex + ".htm"
-	req, _ := http.NewRequest("GET", urlString, nil)
-	resp, err := client.Do(req)
+// fetchNewsDocument 请求学校官网页面并解析，同一主机同时进行的请求数不超过 newsHostLimit
+func fetchNewsDocument(ctx context.Context, urlString string) (*goquery.Document, stdio.MessagedError) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlString, nil)
+	if err != nil {
+		stdio.LogError("", "网络请求创建失败", err)
+		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	err = newsHostLimiter.Acquire(ctx, req.URL.Host)
+	if err != nil {
+		return nil, unit.UpstreamErrorMessage("", err)
+	}
+	defer newsHostLimiter.Release(req.URL.Host)
+	resp, err := unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError("", "网络请求失败", err)
-		return nil, false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return nil, unit.UpstreamErrorMessage("", err)
 	}
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	resp.Body.Close()
 	if err != nil {
 		stdio.LogError("", "HTML解析失败", err)
-		return nil, false, stdio.GetErrorMessage(-500, "请求处理出错")
+		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
-	items := make([]manager.NewsItem, 0)
-	indexStart := 10 * (page % 2)
-	hasNext := false
-	r, _ := regexp.Compile("_(\\d*)\\.")
-	doc.Find(".newslist").Find("ul").Find("li").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		if i < indexStart {
-			return true
+	return doc, stdio.GetEmptyErrorMessage()
+}
+
+// ListNewsByType 从数据库中分页读取新闻，cursor 为上一页返回的游标；不传游标时 page 作为偏移页码兼容旧版客户端。
+// 读取第一页时若该类别距上次同步已超过 sync_interval，先同步第一页；同步失败但已有缓存时返回缓存内容
+func (newsModuleImpl newsModuleImpl) ListNewsByType(ctx context.Context, tid int, cursor string, page int, size int) ([]manager.NewsItem, string,
+	bool, stdio.MessagedError) {
+	exist, err := manager.NewsManager.CheckChartExist(ctx, tid)
+	if err != nil {
+		return nil, "", false, manager.ErrorMessage("", err)
+	}
+	if !exist {
+		stdio.LogInfo("", "新闻类别不存在")
+		return nil, "", false, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	if size <= 0 {
+		size = newsConfig.PageSize
+	}
+	if size > newsConfig.MaxPageSize {
+		size = newsConfig.MaxPageSize
+	}
+	query := manager.NewsListQuery{
+		Tid:  tid,
+		Size: size + 1,
+	}
+	if cursor != "" {
+		var errMessage stdio.MessagedError
+		query.After, errMessage = decodeNewsCursor(cursor)
+		if errMessage.HasInfo {
+			return nil, "", false, errMessage
 		}
-		if i == indexStart+11 {
-			hasNext = true
-			return false
+	} else if page > 0 {
+		query.Offset = page * size
+	}
+
+	var syncMessage stdio.MessagedError
+	if cursor == "" && page <= 0 && newsSyncExpired(tid) {
+		_, syncMessage = newsCallGroup.Do(ctx, "sync:"+strconv.Itoa(tid), func(ctx context.Context) (interface{}, stdio.MessagedError) {
+			return nil, NewsModule.SyncNews(ctx, tid, 1)
+		})
+	}
+	items, err := manager.NewsManager.ListNews(ctx, query)
+	if err != nil {
+		return nil, "", false, manager.ErrorMessage("", err)
+	}
+	if syncMessage.HasInfo {
+		if len(items) == 0 {
+			return nil, "", false, syncMessage
 		}
-		idPre := r.FindString(s.Find("a").AttrOr("href", ""))
-		if idPre == "" {
-			stdio.LogWarn("", "tid获取失败，url: "+urlString+", index: "+strconv.Itoa(i), err)
-			return true
+		stdio.LogWarn("", "新闻同步失败，将返回已缓存的新闻，tid: "+strconv.Itoa(tid), nil)
+	}
+	hasNext := len(items) > size
+	if hasNext {
+		items = items[:size]
+	}
+	nextCursor := ""
+	if len(items) > 0 {
+		last := items[len(items)-1]
+		nextCursor = encodeNewsCursor(manager.NewsCursor{
+			Valid:      true,
+			CreateTime: last.CreateTime,
+			Nid:        last.Nid,
+		})
+	}
+	return items, nextCursor, hasNext, stdio.GetEmptyErrorMessage()
+}
+
+// SyncNews 从学校官网同步指定类别的前 pages 页新闻，某页中的新闻均已存在时提前结束
+func (newsModuleImpl newsModuleImpl) SyncNews(ctx context.Context, tid int, pages int) stdio.MessagedError {
+	for pageIndex := 1; pageIndex <= pages; pageIndex++ {
+		ids, hasNext, errMessage := crawlNewsPage(ctx, tid, pageIndex)
+		if errMessage.HasInfo {
+			return errMessage
 		}
+		var newIds []int
+		for _, id := range ids {
+			exist, err := manager.NewsManager.CheckNewsExist(ctx, tid, id)
+			if err != nil {
+				return manager.ErrorMessage("", err)
+			}
+			if !exist {
+				newIds = append(newIds, id)
+			}
+		}
+		unit.RunBounded(len(newIds), newsWorkerCount, func(index int) {
+			NewsModule.GetNewsById(ctx, tid, newIds[index])
+		})
+		if len(newIds) > 0 {
+			stdio.LogVerbose("", "新闻同步完成，tid: "+strconv.Itoa(tid)+", page: "+strconv.Itoa(pageIndex)+
+				", 新增: "+strconv.Itoa(len(newIds)))
+		}
+		if len(newIds) == 0 || !hasNext {
+			break
+		}
+	}
+	newsSyncTime.Lock()
+	newsSyncTime.items[tid] = time.Now()
+	newsSyncTime.Unlock()
+	return stdio.GetEmptyErrorMessage()
+}
+
+// newsSyncExpired 判断指定类别距上次同步成功是否已超过 sync_interval
+func newsSyncExpired(tid int) bool {
+	newsSyncTime.Lock()
+	defer newsSyncTime.Unlock()
+	last, ok := newsSyncTime.items[tid]
+	return !ok || time.Since(last) > time.Duration(newsConfig.SyncInterval)*time.Second
+}
+
+// crawlNewsPage 读取学校官网新闻列表中的一页，返回该页新闻 ID 及是否存在下一页
+func crawlNewsPage(ctx context.Context, tid int, pageIndex int) ([]int, bool, stdio.MessagedError) {
+	pageString := strconv.Itoa(pageIndex)
+	urlString := "http://www.scit.cn/newslist" + strconv.Itoa(tid) + "_" + pageString + ".htm"
+	doc, errMessage := fetchNewsDocument(ctx, urlString)
+	if errMessage.HasInfo {
+		return nil, false, errMessage
+	}
+	if doc.Find(".current").Text() != pageString {
+		stdio.LogDebug("", "current: "+doc.Find(".current").Text(), nil)
+		return nil, false, stdio.GetEmptyErrorMessage()
+	}
+	var ids []int
+	r, _ := regexp.Compile("_(\\d*)\\.")
+	doc.Find(".newslist").Find("ul").Find("li").Each(func(i int, s *goquery.Selection) {
+		idPre := r.FindString(s.Find("a").AttrOr("href", ""))
 		if len(idPre) <= 2 {
-			stdio.LogWarn("", "tid获取失败，url: "+urlString+", index: "+strconv.Itoa(i), err)
-			return true
+			stdio.LogWarn("", "tid获取失败，url: "+urlString+", index: "+strconv.Itoa(i), nil)
+			return
 		}
 		id, err := strconv.Atoi(idPre[1 : len(idPre)-1])
 		if err != nil {
 			stdio.LogWarn("", "tid获取失败，url: "+urlString+", index: "+strconv.Itoa(i), err)
-			return true
-		}
-		item, errMessage := NewsModule.GetNewsById(tid, id)
-		if errMessage.HasInfo {
-			return true
+			return
 		}
-
-		items = append(items, item)
-		return true
+		ids = append(ids, id)
 	})
-	if doc.Find(".current").Text() != pageIndex {
-		stdio.LogDebug("", "current: "+doc.Find(".current").Text(), nil)
-		return make([]manager.NewsItem, 0), false, stdio.GetEmptyErrorMessage()
-	}
+	hasNext := false
 	doc.Find(".manu").EachWithBreak(func(_ int, s1 *goquery.Selection) bool {
 		if s1.AttrOr("valign", "null") != "bottom" {
 			return true
@@ -111,19 +267,41 @@ func (newsModuleImpl newsModuleImpl) ListNewsByType(tid int, page int) ([]manage
 		})
 		return true
 	})
+	return ids, hasNext, stdio.GetEmptyErrorMessage()
+}
 
-	return items, hasNext, stdio.GetEmptyErrorMessage()
+func encodeNewsCursor(cursor manager.NewsCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor.CreateTime + "," + strconv.Itoa(cursor.Nid)))
 }
 
-func (newsModuleImpl newsModuleImpl) GetTypeChart() ([]manager.NewsTypeChartItem, stdio.MessagedError) {
-	var items []manager.NewsTypeChartItem
-	var errMessage stdio.MessagedError
-	items, errMessage = manager.NewsManager.GetTypeChart()
-	if errMessage.HasInfo {
-		return nil, errMessage
+func decodeNewsCursor(cursor string) (manager.NewsCursor, stdio.MessagedError) {
+	content, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return manager.NewsCursor{}, stdio.GetErrorMessage(-500, "无效的参数")
+	}
+	index := strings.LastIndex(string(content), ",")
+	if index < 0 {
+		return manager.NewsCursor{}, stdio.GetErrorMessage(-500, "无效的参数")
+	}
+	nid, err := strconv.Atoi(string(content[index+1:]))
+	if err != nil {
+		return manager.NewsCursor{}, stdio.GetErrorMessage(-500, "无效的参数")
+	}
+	return manager.NewsCursor{
+		Valid:      true,
+		CreateTime: string(content[:index]),
+		Nid:        nid,
+	}, stdio.GetEmptyErrorMessage()
+}
+
+func (newsModuleImpl newsModuleImpl) GetTypeChart(ctx context.Context) ([]manager.NewsTypeChartItem, stdio.MessagedError) {
+	items, err := manager.NewsManager.GetTypeChart(ctx)
+	if err != nil {
+		return nil, manager.ErrorMessage("", err)
 	}
 	if len(items) == 0 {
-		items, errMessage = NewsModule.RefreshTypeChart()
+		var errMessage stdio.MessagedError
+		items, errMessage = NewsModule.RefreshTypeChart(ctx)
 		if errMessage.HasInfo {
 			return nil, errMessage
 		}
@@ -131,25 +309,11 @@ func (newsModuleImpl newsModuleImpl) GetTypeChart() ([]manager.NewsTypeChartItem
 	return items, stdio.GetEmptyErrorMessage()
 }
 
-func (newsModuleImpl newsModuleImpl) RefreshTypeChart() ([]manager.NewsTypeChartItem, stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
+func (newsModuleImpl newsModuleImpl) RefreshTypeChart(ctx context.Context) ([]manager.NewsTypeChartItem, stdio.MessagedError) {
 	urlString := "http://m.scit.cn/news.aspx"
-	req, _ := http.NewRequest("GET", urlString, nil)
-	resp, err := client.Do(req)
-	if err != nil {
-		stdio.LogError("", "网络请求失败", err)
-		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		stdio.LogError("", "HTML解析失败", err)
-		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
+	doc, errMessage := fetchNewsDocument(ctx, urlString)
+	if errMessage.HasInfo {
+		return nil, errMessage
 	}
 
 	var charts []manager.NewsTypeChartItem
@@ -161,7 +325,7 @@ func (newsModuleImpl newsModuleImpl) RefreshTypeChart() ([]manager.NewsTypeChart
 		r, _ := regexp.Compile("tid=(\\d+)")
 		tidPre := r.FindString(href)
 		if len(tidPre) <= 4 {
-			stdio.LogError("", "tid获取失败", err)
+			stdio.LogError("", "tid获取失败", nil)
 			return
 		}
 		tid, err := strconv.Atoi(tidPre[4:])
@@ -173,49 +337,46 @@ func (newsModuleImpl newsModuleImpl) RefreshTypeChart() ([]manager.NewsTypeChart
 		item.TypeId = tid
 		charts = append(charts, item)
 	})
-	manager.NewsManager.UpdateTypeChart(charts)
+	err := manager.NewsManager.UpdateTypeChart(ctx, charts)
+	if err != nil {
+		return nil, manager.ErrorMessage("", err)
+	}
 	return charts, stdio.GetEmptyErrorMessage()
 }
 
-func (newsModuleImpl newsModuleImpl) GetNewsById(tid int, id int) (manager.NewsItem, stdio.MessagedError) {
-	exist, errMessage := manager.NewsManager.CheckNewsExist(tid, id)
-	if errMessage.HasInfo {
-		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-	if !exist {
-		return NewsModule.RefreshNews(tid, id)
-	}
-	item, errMessage := manager.NewsManager.GetNewsById(tid, id)
+// GetNewsById 获取新闻摘要，同一新闻的并发请求共享同一次获取
+func (newsModuleImpl newsModuleImpl) GetNewsById(ctx context.Context, tid int, id int) (manager.NewsItem, stdio.MessagedError) {
+	item, errMessage := newsCallGroup.Do(ctx, "news:"+strconv.Itoa(tid)+":"+strconv.Itoa(id), func(ctx context.Context) (interface{},
+		stdio.MessagedError) {
+		return getNewsById(ctx, tid, id)
+	})
 	if errMessage.HasInfo {
-		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
-	} else {
-		return item, stdio.GetEmptyErrorMessage()
+		return manager.NewsItem{}, errMessage
 	}
+	return item.(manager.NewsItem), stdio.GetEmptyErrorMessage()
 }
 
-func (newsModuleImpl newsModuleImpl) RefreshNews(tid int, id int) (manager.NewsItem, stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+func getNewsById(ctx context.Context, tid int, id int) (manager.NewsItem, stdio.MessagedError) {
+	item, err := manager.NewsManager.GetNewsById(ctx, tid, id)
+	if errors.Is(err, manager.ErrNotFound) {
+		return NewsModule.RefreshNews(ctx, tid, id)
 	}
-	urlString := "http://www.scit.cn/newsli" + strconv.Itoa(tid) + "_" + strconv.Itoa(id) + ".htm"
-	req, _ := http.NewRequest("GET", urlString, nil)
-	resp, err := client.Do(req)
 	if err != nil {
-		stdio.LogError("", "网络请求失败", err)
-		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.NewsItem{}, manager.ErrorMessage("", err)
 	}
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		stdio.LogError("", "HTML解析失败", err)
-		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	return item, stdio.GetEmptyErrorMessage()
+}
+
+func (newsModuleImpl newsModuleImpl) RefreshNews(ctx context.Context, tid int, id int) (manager.NewsItem, stdio.MessagedError) {
+	urlString := "http://www.scit.cn/newsli" + strconv.Itoa(tid) + "_" + strconv.Itoa(id) + ".htm"
+	doc, errMessage := fetchNewsDocument(ctx, urlString)
+	if errMessage.HasInfo {
+		return manager.NewsItem{}, errMessage
 	}
 	item := manager.NewsItem{}
 	item.Title = doc.Find(".news_title").Text()
 	if item.Title == "" {
-		stdio.LogDebug("", "新闻标题解析失败："+urlString, err)
+		stdio.LogDebug("", "新闻标题解析失败："+urlString, nil)
 		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 	item.Title = strings.ReplaceAll(item.Title, "\t", "")
@@ -230,12 +391,12 @@ func (newsModuleImpl newsModuleImpl) RefreshNews(tid int, id int) (manager.NewsI
 	item.Title = strings.ReplaceAll(item.Title, " ", " ")
 	newsTimePre := doc.Find(".news_time")
 	if newsTimePre.Text() == "" {
-		stdio.LogDebug("", "新闻创建时间获取失败："+urlString, err)
+		stdio.LogDebug("", "新闻创建时间获取失败："+urlString, nil)
 		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 	newsTime := strings.Split(newsTimePre.Text(), " ")
 	if len(newsTime) < 1 {
-		stdio.LogDebug("", "新闻创建时间解析失败："+urlString, err)
+		stdio.LogDebug("", "新闻创建时间解析失败："+urlString, nil)
 		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 	item.CreateTime = newsTime[0]
@@ -301,30 +462,34 @@ func (newsModuleImpl newsModuleImpl) RefreshNews(tid int, id int) (manager.NewsI
 		}
 	})
 	if item.Title == "" {
-		stdio.LogError("", "新闻标题获取失败，tid: "+strconv.Itoa(tid)+", nid: "+strconv.Itoa(id), err)
+		stdio.LogError("", "新闻标题获取失败，tid: "+strconv.Itoa(tid)+", nid: "+strconv.Itoa(id), nil)
 		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	} else if item.Summary == "" && len(item.Images) == 0 {
-		stdio.LogError("", "新闻简介获取失败，tid: "+strconv.Itoa(tid)+", nid: "+strconv.Itoa(id), err)
+		stdio.LogError("", "新闻简介获取失败，tid: "+strconv.Itoa(tid)+", nid: "+strconv.Itoa(id), nil)
 		return manager.NewsItem{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	} else {
 		item.Tid = tid
 		item.Nid = id
-		manager.NewsManager.UpdateNews(item)
+		err := manager.NewsManager.UpdateNews(ctx, item)
+		if err != nil {
+			return manager.NewsItem{}, manager.ErrorMessage("", err)
+		}
 		return item, stdio.GetEmptyErrorMessage()
 	}
 }
 
-func (newsModuleImpl newsModuleImpl) GetHeadlines() ([]manager.NewsItem, stdio.MessagedError) {
-	headlines, errMessage := manager.NewsManager.GetHeadlines()
-	if errMessage.HasInfo {
-		return nil, errMessage
+func (newsModuleImpl newsModuleImpl) GetHeadlines(ctx context.Context) ([]manager.NewsItem, stdio.MessagedError) {
+	var errMessage stdio.MessagedError
+	headlines, err := manager.NewsManager.GetHeadlines(ctx)
+	if err != nil {
+		return nil, manager.ErrorMessage("", err)
 	}
 	var headline = headlines.News
 	if headlines.Exist && !headlines.Expired {
 		goto result
 	}
 	stdio.LogDebug("", "头条数据待更新", nil)
-	headline, errMessage = NewsModule.RefreshHeadlines()
+	headline, errMessage = NewsModule.RefreshHeadlines(ctx)
 	if errMessage.HasInfo {
 		return nil, errMessage
 	}
@@ -332,7 +497,7 @@ result:
 	news := make([]manager.NewsItem, 0)
 	for _, item := range headline {
 		if item.Title == "" || item.Summary == "" {
-			newsItem, errMessage := NewsModule.GetNewsById(item.Tid, item.Nid)
+			newsItem, errMessage := NewsModule.GetNewsById(ctx, item.Tid, item.Nid)
 			if errMessage.HasInfo {
 				return nil, errMessage
 			}
@@ -344,25 +509,11 @@ result:
 	return news, stdio.GetEmptyErrorMessage()
 }
 
-func (newsModuleImpl newsModuleImpl) RefreshHeadlines() ([]manager.NewsItem, stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
+func (newsModuleImpl newsModuleImpl) RefreshHeadlines(ctx context.Context) ([]manager.NewsItem, stdio.MessagedError) {
 	urlString := "http://m.scit.cn/"
-	req, _ := http.NewRequest("GET", urlString, nil)
-	resp, err := client.Do(req)
-	if err != nil {
-		stdio.LogError("", "网络请求失败", err)
-		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
-
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		stdio.LogError("", "HTML解析失败", err)
-		return nil, stdio.GetErrorMessage(-500, "请求处理出错")
+	doc, errMessage := fetchNewsDocument(ctx, urlString)
+	if errMessage.HasInfo {
+		return nil, errMessage
 	}
 
 	var headlines []manager.NewsItem
@@ -373,7 +524,7 @@ func (newsModuleImpl newsModuleImpl) RefreshHeadlines() ([]manager.NewsItem, std
 		r, _ := regexp.Compile("tid=(\\d+)")
 		tidPre := r.FindString(href)
 		if len(tidPre) <= 2 {
-			stdio.LogError("", "tid获取失败", err)
+			stdio.LogError("", "tid获取失败", nil)
 			return
 		}
 		tid, err := strconv.Atoi(tidPre[4:])
@@ -408,7 +559,7 @@ func (newsModuleImpl newsModuleImpl) RefreshHeadlines() ([]manager.NewsItem, std
 		r, _ := regexp.Compile("tid=(\\d+)")
 		tidPre := r.FindString(href)
 		if len(tidPre) <= 4 {
-			stdio.LogError("", "tid获取失败", err)
+			stdio.LogError("", "tid获取失败", nil)
 			return
 		}
 		tid, err := strconv.Atoi(tidPre[4:])
@@ -435,6 +586,186 @@ func (newsModuleImpl newsModuleImpl) RefreshHeadlines() ([]manager.NewsItem, std
 
 		headlines = append(headlines, item)
 	})
-	manager.NewsManager.UpdateHeadlines(headlines)
+	err := manager.NewsManager.UpdateHeadlines(ctx, headlines)
+	if err != nil {
+		return nil, manager.ErrorMessage("", err)
+	}
 	return headlines, stdio.GetEmptyErrorMessage()
 }
+
+var newsAttachmentExtensions = []string{
+	".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx", ".pdf", ".txt", ".zip", ".rar", ".7z",
+}
+
+func (newsModuleImpl newsModuleImpl) GetNewsContent(ctx context.Context, tid int, id int) (manager.NewsContentObject, stdio.MessagedError) {
+	content, err := manager.NewsManager.GetContent(ctx, tid, id)
+	if err != nil {
+		return manager.NewsContentObject{}, manager.ErrorMessage("", err)
+	}
+	if content.Exist && !content.Expired {
+		return content.Content, stdio.GetEmptyErrorMessage()
+	}
+	return NewsModule.RefreshNewsContent(ctx, tid, id)
+}
+
+func (newsModuleImpl newsModuleImpl) RefreshNewsContent(ctx context.Context, tid int, id int) (manager.NewsContentObject, stdio.MessagedError) {
+	urlString := "http://www.scit.cn/newsli" + strconv.Itoa(tid) + "_" + strconv.Itoa(id) + ".htm"
+	doc, errMessage := fetchNewsDocument(ctx, urlString)
+	if errMessage.HasInfo {
+		return manager.NewsContentObject{}, errMessage
+	}
+	newsText := doc.Find(".news_text")
+	if newsText.Length() == 0 {
+		stdio.LogDebug("", "新闻正文获取失败："+urlString, nil)
+		return manager.NewsContentObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+
+	content := manager.NewsContentObject{
+		Images:      make([]string, 0),
+		Attachments: make([]manager.NewsAttachment, 0),
+	}
+	newsText.Find("img").Each(func(i int, s *goquery.Selection) {
+		img := unit.ResolveURL(urlString, s.AttrOr("src", ""))
+		if img == "" {
+			return
+		}
+		for _, imageItem := range content.Images {
+			if imageItem == img {
+				return
+			}
+		}
+		content.Images = append(content.Images, img)
+	})
+	newsText.Find("a").Each(func(i int, s *goquery.Selection) {
+		link := unit.ResolveURL(urlString, s.AttrOr("href", ""))
+		if link == "" || !isNewsAttachment(link) {
+			return
+		}
+		for _, attachment := range content.Attachments {
+			if attachment.Url == link {
+				return
+			}
+		}
+		name := strings.TrimSpace(s.Text())
+		if name == "" {
+			name = path.Base(link)
+		}
+		content.Attachments = append(content.Attachments, manager.NewsAttachment{
+			Name: name,
+			Url:  link,
+		})
+	})
+	newsHtml, err := newsText.Html()
+	if err != nil {
+		stdio.LogError("", "新闻正文解析失败，tid: "+strconv.Itoa(tid)+", nid: "+strconv.Itoa(id), err)
+		return manager.NewsContentObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	content.Content, err = unit.SanitizeHTML(newsHtml, urlString)
+	if err != nil {
+		stdio.LogError("", "新闻正文过滤失败，tid: "+strconv.Itoa(tid)+", nid: "+strconv.Itoa(id), err)
+		return manager.NewsContentObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	err = manager.NewsManager.UpdateContent(ctx, tid, id, content)
+	if err != nil {
+		return manager.NewsContentObject{}, manager.ErrorMessage("", err)
+	}
+	return content, stdio.GetEmptyErrorMessage()
+}
+
+func isNewsAttachment(link string) bool {
+	link = strings.ToLower(strings.Split(link, "?")[0])
+	for _, extension := range newsAttachmentExtensions {
+		if strings.HasSuffix(link, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchNews 在已缓存的新闻中搜索，关键词按空白拆分，最多取前 5 个
+func (newsModuleImpl newsModuleImpl) SearchNews(ctx context.Context, keyword string, tid int, start string, end string, page int) ([]manager.NewsItem,
+	bool, stdio.MessagedError) {
+	keywords := strings.Fields(keyword)
+	if len(keywords) == 0 {
+		return nil, false, stdio.GetErrorMessage(-500, "无效的参数")
+	}
+	if len(keywords) > 5 {
+		keywords = keywords[:5]
+	}
+	news, hasNext, err := manager.NewsManager.SearchNews(ctx, manager.NewsSearchQuery{
+		Keywords: keywords,
+		Tid:      tid,
+		Start:    start,
+		End:      end,
+		Page:     page,
+		Size:     20,
+	})
+	if err != nil {
+		return nil, false, manager.ErrorMessage("", err)
+	}
+	return news, hasNext, stdio.GetEmptyErrorMessage()
+}
+
+// GetFeed 由已缓存的新闻生成订阅源
+func (newsModuleImpl newsModuleImpl) GetFeed(ctx context.Context, tid int) (unit.Feed, stdio.MessagedError) {
+	charts, errMessage := NewsModule.GetTypeChart(ctx)
+	if errMessage.HasInfo {
+		return unit.Feed{}, errMessage
+	}
+	name := ""
+	for _, chart := range charts {
+		if chart.TypeId == tid && chart.Out == 1 {
+			name = chart.TypeName
+			break
+		}
+	}
+	if name == "" {
+		stdio.LogInfo("", "新闻类别不存在")
+		return unit.Feed{}, stdio.GetErrorMessage(-404, "新闻类别不存在")
+	}
+	news, _, _, errMessage := NewsModule.ListNewsByType(ctx, tid, "", 0, 30)
+	if errMessage.HasInfo {
+		return unit.Feed{}, errMessage
+	}
+	return unit.Feed{
+		Title:       "四川工商学院 - " + name,
+		Link:        "http://www.scit.cn/newslist" + strconv.Itoa(tid) + "_1.htm",
+		Description: "四川工商学院" + name,
+		Items:       getFeedItems(news),
+	}, stdio.GetEmptyErrorMessage()
+}
+
+func (newsModuleImpl newsModuleImpl) GetHeadlinesFeed(ctx context.Context) (unit.Feed, stdio.MessagedError) {
+	news, errMessage := NewsModule.GetHeadlines(ctx)
+	if errMessage.HasInfo {
+		return unit.Feed{}, errMessage
+	}
+	return unit.Feed{
+		Title:       "四川工商学院 - 头条新闻",
+		Link:        "http://m.scit.cn/",
+		Description: "四川工商学院头条新闻",
+		Items:       getFeedItems(news),
+	}, stdio.GetEmptyErrorMessage()
+}
+
+func getFeedItems(news []manager.NewsItem) []unit.FeedItem {
+	items := make([]unit.FeedItem, 0, len(news))
+	for _, item := range news {
+		link := "http://www.scit.cn/newsli" + strconv.Itoa(item.Tid) + "_" + strconv.Itoa(item.Nid) + ".htm"
+		feedItem := unit.FeedItem{
+			GUID:    link,
+			Title:   item.Title,
+			Link:    link,
+			Summary: item.Summary,
+		}
+		if len(item.Images) > 0 {
+			feedItem.Image = item.Images[0]
+		}
+		published, err := time.ParseInLocation("2006-01-02", item.CreateTime, time.Local)
+		if err == nil {
+			feedItem.Published = published
+		}
+		items = append(items, feedItem)
+	}
+	return items
+}
@@ -0,0 +1,311 @@
+package module
+
+import (
+	"SCITEduTool/Application/manager"
+	"SCITEduTool/Application/stdio"
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type schedulerModule interface {
+	Start(conf SchedulerConfig)
+	Status() []SchedulerJobStatus
+}
+
+type schedulerModuleImpl struct{}
+
+var SchedulerModule schedulerModule = schedulerModuleImpl{}
+
+type SchedulerConfig struct {
+	Enable   bool               `json:"enable"`
+	Table    SchedulerJobConfig `json:"table"`
+	Info     SchedulerJobConfig `json:"info"`
+	Headline SchedulerJobConfig `json:"headline"`
+	News     SchedulerJobConfig `json:"news"`
+}
+
+// SchedulerJobConfig 定时任务配置，时间单位均为秒，Lead 为提前刷新的时间窗口，
+// Jitter 为每次执行前的随机延迟上限，Batch 为单次执行最多刷新的数据条数，新闻同步任务中为每个类别同步的页数
+type SchedulerJobConfig struct {
+	Interval    int `json:"interval"`
+	Lead        int `json:"lead"`
+	Concurrency int `json:"concurrency"`
+	Jitter      int `json:"jitter"`
+	Batch       int `json:"batch"`
+}
+
+type SchedulerJobStatus struct {
+	Name        string `json:"name"`
+	Running     bool   `json:"running"`
+	LastStart   int64  `json:"last_start"`
+	LastEnd     int64  `json:"last_end"`
+	LastTotal   int    `json:"last_total"`
+	LastFailed  int    `json:"last_failed"`
+	LastError   string `json:"last_error"`
+	TotalRuns   int    `json:"total_runs"`
+	TotalFailed int    `json:"total_failed"`
+}
+
+type schedulerTask struct {
+	Name string
+	Run  func(ctx context.Context) stdio.MessagedError
+}
+
+type schedulerJob struct {
+	Name   string
+	Config SchedulerJobConfig
+	List   func(ctx context.Context, conf SchedulerJobConfig) ([]schedulerTask, stdio.MessagedError)
+}
+
+var schedulerLock sync.Mutex
+var schedulerStatus []*SchedulerJobStatus
+
+func GetDefaultSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		Enable: true,
+		Table: SchedulerJobConfig{
+			Interval:    600,
+			Lead:        3600,
+			Concurrency: 2,
+			Jitter:      60,
+			Batch:       20,
+		},
+		Info: SchedulerJobConfig{
+			Interval:    600,
+			Lead:        3600,
+			Concurrency: 2,
+			Jitter:      60,
+			Batch:       20,
+		},
+		Headline: SchedulerJobConfig{
+			Interval:    300,
+			Lead:        600,
+			Concurrency: 1,
+			Jitter:      30,
+			Batch:       1,
+		},
+		News: SchedulerJobConfig{
+			Interval:    1800,
+			Lead:        0,
+			Concurrency: 1,
+			Jitter:      120,
+			Batch:       2,
+		},
+	}
+}
+
+func (schedulerModuleImpl schedulerModuleImpl) Start(conf SchedulerConfig) {
+	if !conf.Enable {
+		stdio.LogInfo("", "后台定时刷新已关闭")
+		return
+	}
+	jobs := []schedulerJob{
+		{Name: "table", Config: conf.Table, List: listTableTasks},
+		{Name: "info", Config: conf.Info, List: listInfoTasks},
+		{Name: "headline", Config: conf.Headline, List: listHeadlineTasks},
+		{Name: "news", Config: conf.News, List: listNewsTasks},
+	}
+	defaultConf := GetDefaultSchedulerConfig()
+	defaults := []SchedulerJobConfig{defaultConf.Table, defaultConf.Info, defaultConf.Headline, defaultConf.News}
+	for index, job := range jobs {
+		job.Config = checkSchedulerJobConfig(job.Name, job.Config, defaults[index])
+		status := &SchedulerJobStatus{Name: job.Name}
+		schedulerLock.Lock()
+		schedulerStatus = append(schedulerStatus, status)
+		schedulerLock.Unlock()
+		go runSchedulerJob(job, status)
+	}
+	stdio.LogVerbose("", "后台定时刷新配置成功")
+}
+
+func (schedulerModuleImpl schedulerModuleImpl) Status() []SchedulerJobStatus {
+	schedulerLock.Lock()
+	defer schedulerLock.Unlock()
+	status := make([]SchedulerJobStatus, 0, len(schedulerStatus))
+	for _, item := range schedulerStatus {
+		status = append(status, *item)
+	}
+	return status
+}
+
+func checkSchedulerJobConfig(name string, conf SchedulerJobConfig, defaultConf SchedulerJobConfig) SchedulerJobConfig {
+	if conf.Interval <= 0 {
+		stdio.LogWarn("", "定时任务 "+name+" 执行间隔不正确，将使用默认值", nil)
+		conf.Interval = defaultConf.Interval
+	}
+	if conf.Lead <= 0 {
+		conf.Lead = defaultConf.Lead
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = defaultConf.Concurrency
+	}
+	if conf.Jitter < 0 {
+		conf.Jitter = 0
+	}
+	if conf.Batch <= 0 {
+		conf.Batch = defaultConf.Batch
+	}
+	return conf
+}
+
+func runSchedulerJob(job schedulerJob, status *SchedulerJobStatus) {
+	for {
+		if job.Config.Jitter > 0 {
+			time.Sleep(time.Duration(rand.Intn(job.Config.Jitter+1)) * time.Second)
+		}
+		runSchedulerOnce(job, status)
+		time.Sleep(time.Duration(job.Config.Interval) * time.Second)
+	}
+}
+
+// runSchedulerOnce 执行一次定时任务，同一任务内最多同时执行 Concurrency 个刷新
+func runSchedulerOnce(job schedulerJob, status *SchedulerJobStatus) {
+	schedulerLock.Lock()
+	status.Running = true
+	status.LastStart = time.Now().Unix()
+	schedulerLock.Unlock()
+
+	ctx := context.Background()
+	tasks, errMessage := job.List(ctx, job.Config)
+	failed := 0
+	lastError := ""
+	if errMessage.HasInfo {
+		failed = 1
+		lastError = "list (" + strconv.Itoa(errMessage.Code) + ")"
+	} else {
+		var lock sync.Mutex
+		var group sync.WaitGroup
+		limit := make(chan struct{}, job.Config.Concurrency)
+		for _, task := range tasks {
+			group.Add(1)
+			limit <- struct{}{}
+			go func(task schedulerTask) {
+				defer func() {
+					<-limit
+					group.Done()
+				}()
+				errMessage := task.Run(ctx)
+				if !errMessage.HasInfo {
+					return
+				}
+				stdio.LogWarn(task.Name, "定时任务 "+job.Name+" 刷新失败", nil)
+				lock.Lock()
+				failed++
+				lastError = task.Name + " (" + strconv.Itoa(errMessage.Code) + ")"
+				lock.Unlock()
+			}(task)
+		}
+		group.Wait()
+	}
+
+	schedulerLock.Lock()
+	status.Running = false
+	status.LastEnd = time.Now().Unix()
+	status.LastTotal = len(tasks)
+	status.LastFailed = failed
+	if lastError != "" {
+		status.LastError = lastError
+	}
+	status.TotalRuns++
+	status.TotalFailed += failed
+	schedulerLock.Unlock()
+	if len(tasks) > 0 {
+		stdio.LogDebug("", "定时任务 "+job.Name+" 执行完成", nil)
+	}
+}
+
+func listTableTasks(ctx context.Context, conf SchedulerJobConfig) ([]schedulerTask, stdio.MessagedError) {
+	current := manager.CalendarManager.Current()
+	usernames, err := manager.TableManager.ListExpiring(ctx, current.SchoolYear, current.Semester,
+		time.Now().Unix()+int64(conf.Lead), conf.Batch)
+	if err != nil {
+		return nil, manager.ErrorMessage("", err)
+	}
+	tasks := make([]schedulerTask, 0, len(usernames))
+	for _, username := range usernames {
+		username := username
+		tasks = append(tasks, schedulerTask{
+			Name: username,
+			Run: func(ctx context.Context) stdio.MessagedError {
+				info, errMessage := InfoModule.Get(ctx, username)
+				if errMessage.HasInfo {
+					return errMessage
+				}
+				session, _, errMessage := SessionModule.Get(ctx, username, "")
+				if errMessage.HasInfo {
+					return errMessage
+				}
+				_, errMessage = TableModule.Refresh(ctx, username, info, current.SchoolYear, current.Semester, session)
+				return errMessage
+			},
+		})
+	}
+	return tasks, stdio.GetEmptyErrorMessage()
+}
+
+func listInfoTasks(ctx context.Context, conf SchedulerJobConfig) ([]schedulerTask, stdio.MessagedError) {
+	usernames, err := manager.InfoManager.ListExpiring(ctx, time.Now().Unix()+int64(conf.Lead), conf.Batch)
+	if err != nil {
+		return nil, manager.ErrorMessage("", err)
+	}
+	tasks := make([]schedulerTask, 0, len(usernames))
+	for _, username := range usernames {
+		username := username
+		tasks = append(tasks, schedulerTask{
+			Name: username,
+			Run: func(ctx context.Context) stdio.MessagedError {
+				session, identify, errMessage := SessionModule.Get(ctx, username, "")
+				if errMessage.HasInfo {
+					return errMessage
+				}
+				_, errMessage = InfoModule.Refresh(ctx, username, session, identify)
+				return errMessage
+			},
+		})
+	}
+	return tasks, stdio.GetEmptyErrorMessage()
+}
+
+func listHeadlineTasks(ctx context.Context, conf SchedulerJobConfig) ([]schedulerTask, stdio.MessagedError) {
+	expired, err := manager.NewsManager.GetHeadlinesExpired(ctx)
+	if err != nil {
+		return nil, manager.ErrorMessage("", err)
+	}
+	if expired != 0 && expired >= time.Now().Unix()+int64(conf.Lead) {
+		return []schedulerTask{}, stdio.GetEmptyErrorMessage()
+	}
+	return []schedulerTask{
+		{
+			Name: "",
+			Run: func(ctx context.Context) stdio.MessagedError {
+				_, errMessage := NewsModule.RefreshHeadlines(ctx)
+				return errMessage
+			},
+		},
+	}, stdio.GetEmptyErrorMessage()
+}
+
+// listNewsTasks 为每个对外展示的新闻类别生成同步任务
+func listNewsTasks(ctx context.Context, conf SchedulerJobConfig) ([]schedulerTask, stdio.MessagedError) {
+	charts, errMessage := NewsModule.GetTypeChart(ctx)
+	if errMessage.HasInfo {
+		return nil, errMessage
+	}
+	tasks := make([]schedulerTask, 0, len(charts))
+	for _, chart := range charts {
+		if chart.Out != 1 {
+			continue
+		}
+		tid := chart.TypeId
+		tasks = append(tasks, schedulerTask{
+			Name: "tid " + strconv.Itoa(tid),
+			Run: func(ctx context.Context) stdio.MessagedError {
+				return NewsModule.SyncNews(ctx, tid, conf.Batch)
+			},
+		})
+	}
+	return tasks, stdio.GetEmptyErrorMessage()
+}
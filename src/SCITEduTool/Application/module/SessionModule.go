@@ -4,6 +4,7 @@ import (
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/stdio"
 	"SCITEduTool/Application/unit"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -14,19 +15,19 @@ import (
 )
 
 type sessionModule interface {
-	Get(username string, password string) (string, int, stdio.MessagedError)
-	Refresh(username string, password string) (string, int, stdio.MessagedError)
-	GetVerifyLocation(username string, password string) (string, int, stdio.MessagedError)
+	Get(ctx context.Context, username string, password string) (string, int, stdio.MessagedError)
+	Refresh(ctx context.Context, username string, password string) (string, int, stdio.MessagedError)
+	GetVerifyLocation(ctx context.Context, username string, password string) (string, int, stdio.MessagedError)
 }
 
 type sessionModuleImpl struct{}
 
 var SessionModule sessionModule = sessionModuleImpl{}
 
-func (sessionModuleImpl sessionModuleImpl) Get(username string, password string) (string, int, stdio.MessagedError) {
-	sessionExists, err := manager.SessionManager.Get(username)
-	if err.HasInfo {
-		return "", 0, err
+func (sessionModuleImpl sessionModuleImpl) Get(ctx context.Context, username string, password string) (string, int, stdio.MessagedError) {
+	sessionExists, err := manager.SessionManager.Get(ctx, username)
+	if err != nil {
+		return "", 0, manager.ErrorMessage(username, err)
 	}
 	if !sessionExists.Exist {
 		goto refresh
@@ -41,40 +42,48 @@ func (sessionModuleImpl sessionModuleImpl) Get(username string, password string)
 	stdio.LogInfo(username, "用户 ASP.NET_SessionId 过期")
 
 refresh:
-	session, identify, err := SessionModule.Refresh(username, password)
-	if !err.HasInfo {
+	session, identify, errMessage := SessionModule.Refresh(ctx, username, password)
+	if !errMessage.HasInfo {
 		return session, identify, stdio.GetEmptyErrorMessage()
 	}
-	if err.Code == -401 && password == "" {
+	if errMessage.Code == -401 && password == "" {
 		return "", 0, stdio.GetErrorMessage(-401, "登陆状态失效，请重新登录")
 	} else {
-		return "", 0, err
+		return "", 0, errMessage
 	}
 }
 
-func (sessionModuleImpl sessionModuleImpl) Refresh(username string, password string) (string, int, stdio.MessagedError) {
-	var errMessage stdio.MessagedError
-	if password == "" {
-		password, errMessage = manager.SessionManager.GetUserPassword(username, "")
-		if errMessage.HasInfo {
-			return "", 0, errMessage
-		}
+func (sessionModuleImpl sessionModuleImpl) Refresh(ctx context.Context, username string, password string) (string, int, stdio.MessagedError) {
+	password, err := manager.SessionManager.GetUserPassword(ctx, username, password)
+	if err != nil {
+		return "", 0, manager.ErrorMessage(username, err)
 	}
-	location, identify, errMessage := SessionModule.GetVerifyLocation(username, password)
+	session, identify, errMessage := CurrentEduSystem.Login(ctx, username, password)
 	if errMessage.HasInfo {
 		return "", 0, errMessage
 	}
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	err = manager.SessionManager.Update(ctx, username, password, session, identify)
+	if err != nil {
+		return "", 0, manager.ErrorMessage(username, err)
+	}
+	return session, identify, stdio.GetEmptyErrorMessage()
+}
+
+func (sessionModuleImpl sessionModuleImpl) GetVerifyLocation(ctx context.Context, username string, password string) (string, int, stdio.MessagedError) {
+	return CurrentEduSystem.VerifyLocation(ctx, username, password)
+}
+
+func (zhengFangSystem zhengFangSystem) Login(ctx context.Context, username string, password string) (string, int, stdio.MessagedError) {
+	location, identify, errMessage := zhengFangSystem.VerifyLocation(ctx, username, password)
+	if errMessage.HasInfo {
+		return "", 0, errMessage
 	}
-	req, _ := http.NewRequest("GET", location, nil)
-	resp, err := client.Do(req)
+	req, _ := http.NewRequestWithContext(ctx, "GET", location, nil)
+	resp, err := unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", 0, unit.UpstreamErrorMessage(username, err)
 	}
+	_ = resp.Body.Close()
 	cookies := resp.Header.Values("Set-Cookie")
 	r, _ := regexp.Compile("ASP.NET_SessionId=(.*?);")
 	session := ""
@@ -94,21 +103,19 @@ func (sessionModuleImpl sessionModuleImpl) Refresh(username string, password str
 	}
 	session = session[18 : len(session)-1]
 	stdio.LogVerbose(username, "用户获取 ASP.NET_SessionId 成功")
-	manager.SessionManager.Update(username, password, session, identify)
 	return session, identify, stdio.GetEmptyErrorMessage()
 }
 
-func (sessionModuleImpl sessionModuleImpl) GetVerifyLocation(username string, password string) (string, int, stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+func (zhengFangSystem zhengFangSystem) VerifyLocation(ctx context.Context, username string, password string) (string, int, stdio.MessagedError) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", zhengFangSystem.conf.CasUrl+"/login", nil)
+	resp, err := unit.DoUpstream(req)
+	if err != nil {
+		return "", 0, unit.UpstreamErrorMessage(username, err)
 	}
-
-	req, _ := http.NewRequest("GET", "http://218.6.163.95:18080/zfca/login", nil)
-	resp, err := client.Do(req)
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	resp.Body.Close()
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
+		stdio.LogError("", "HTML解析失败", err)
 		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 	cookies := resp.Header.Values("Set-Cookie")
@@ -130,12 +137,6 @@ func (sessionModuleImpl sessionModuleImpl) GetVerifyLocation(username string, pa
 	}
 	Jsessionid1 = Jsessionid1[11 : len(Jsessionid1)-1]
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		stdio.LogError("", "HTML解析失败", err)
-		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
-	}
 	ltDoc := doc.Find(".btn").Find("span").Find("input")
 	if ltDoc.AttrOr("name", "nil") != "lt" {
 		stdio.LogError(username, "lt 获取失败", nil)
@@ -149,14 +150,11 @@ func (sessionModuleImpl sessionModuleImpl) GetVerifyLocation(username string, pa
 
 	passwordDecode := password
 	//IF !DEBUG
-	decode, errDecode := unit.RSAStaticUnit.DecodePublicEncode(passwordDecode)
+	envelope, errDecode := unit.RSAStaticUnit.OpenEnvelope(unit.ParseCipherText(passwordDecode), false)
 	if errDecode.HasInfo {
 		return "", 0, errDecode
 	}
-	if len(decode) <= 8 {
-		return "", 0, stdio.GetErrorMessage(-401, "密码校验失败")
-	}
-	passwordDecode = decode[8:]
+	passwordDecode = envelope.Data
 	//ENDIF
 
 	form := url.Values{}
@@ -169,14 +167,14 @@ func (sessionModuleImpl sessionModuleImpl) GetVerifyLocation(username string, pa
 	form.Set("lt", lt)
 	form.Set("_eventId", "submit")
 	form.Set("submit1", "+")
-	req, _ = http.NewRequest("POST", "http://218.6.163.95:18080/zfca/login;jsessionid="+
+	req, _ = http.NewRequestWithContext(ctx, "POST", zhengFangSystem.conf.CasUrl+"/login;jsessionid="+
 		Jsessionid1, strings.NewReader(strings.TrimSpace(form.Encode())))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err = client.Do(req)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", 0, unit.UpstreamErrorMessage(username, err)
 	}
+	_ = resp.Body.Close()
 	cookies = resp.Header.Values("Set-Cookie")
 	r, _ = regexp.Compile("CASTGC=(.*?);")
 	castgc := ""
@@ -201,12 +199,12 @@ func (sessionModuleImpl sessionModuleImpl) GetVerifyLocation(username string, pa
 		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 
-	req, _ = http.NewRequest("GET", location[0], nil)
-	resp, err = client.Do(req)
+	req, _ = http.NewRequestWithContext(ctx, "GET", location[0], nil)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "请求失败创建", err)
-		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", 0, unit.UpstreamErrorMessage(username, err)
 	}
+	_ = resp.Body.Close()
 	cookies = resp.Header.Values("Set-Cookie")
 	r, _ = regexp.Compile("JSESSIONID=(.*?);")
 	Jsessionid2 := ""
@@ -229,27 +227,26 @@ func (sessionModuleImpl sessionModuleImpl) GetVerifyLocation(username string, pa
 		stdio.LogError(username, "第二次跳转失败", nil)
 		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
-	req, _ = http.NewRequest("GET", location[0], nil)
+	req, _ = http.NewRequestWithContext(ctx, "GET", location[0], nil)
 	req.AddCookie(&http.Cookie{Name: "JSESSIONID", Value: Jsessionid1})
 	req.AddCookie(&http.Cookie{Name: "CASTGC", Value: castgc})
 	req.AddCookie(&http.Cookie{Name: "JSESSIONID", Value: Jsessionid2})
-	resp, err = client.Do(req)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", 0, unit.UpstreamErrorMessage(username, err)
 	}
+	_ = resp.Body.Close()
 	location = resp.Header.Values("Location")
 	if len(location) != 1 {
 		stdio.LogError(username, "第三次跳转失败", nil)
 		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
 
-	req, _ = http.NewRequest("GET", location[0], nil)
+	req, _ = http.NewRequestWithContext(ctx, "GET", location[0], nil)
 	req.AddCookie(&http.Cookie{Name: "JSESSIONID", Value: Jsessionid2})
-	resp, err = client.Do(req)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", 0, unit.UpstreamErrorMessage(username, err)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	identity := -1
@@ -270,18 +267,18 @@ func (sessionModuleImpl sessionModuleImpl) GetVerifyLocation(username string, pa
 
 	identities := []string{"student", "teacher"}
 	location = []string{
-		"http://218.6.163.95:18080/zfca/login?yhlx=" + identities[identity] +
-			"&login=0122579031373493708&url=xs_main.aspx",
+		zhengFangSystem.conf.CasUrl + "/login?yhlx=" + identities[identity] +
+			"&login=" + zhengFangSystem.conf.CasLoginToken + "&url=xs_main.aspx",
 	}
-	req, _ = http.NewRequest("GET", location[0], nil)
+	req, _ = http.NewRequestWithContext(ctx, "GET", location[0], nil)
 	req.AddCookie(&http.Cookie{Name: "JSESSIONID", Value: Jsessionid1})
 	req.AddCookie(&http.Cookie{Name: "CASTGC", Value: castgc})
 	req.AddCookie(&http.Cookie{Name: "JSESSIONID", Value: Jsessionid2})
-	resp, err = client.Do(req)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return "", 0, stdio.GetErrorMessage(-500, "请求处理出错")
+		return "", 0, unit.UpstreamErrorMessage(username, err)
 	}
+	_ = resp.Body.Close()
 	location = resp.Header.Values("Location")
 	if len(location) != 1 {
 		stdio.LogError(username, "跳转链接获取失败", nil)
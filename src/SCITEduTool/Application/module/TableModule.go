@@ -1,41 +1,54 @@
 package module
 
 import (
+	"SCITEduTool/Application/consts"
 	"SCITEduTool/Application/manager"
 	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"context"
 	"encoding/json"
+	"html"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 type tableModule interface {
-	Get(username string, year string, semester int) (manager.TableObject, stdio.MessagedError)
-	Refresh(username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError)
+	Get(ctx context.Context, username string, year string, semester int) (manager.TableObject, stdio.MessagedError)
+	Refresh(ctx context.Context, username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError)
+	Calendar(ctx context.Context, username string, year string, semester int) (string, stdio.MessagedError)
 }
 
 type tableModuleImpl struct{}
 
 var TableModule tableModule = tableModuleImpl{}
 
-func (tableModuleImpl tableModuleImpl) Get(username string, year string, semester int) (manager.TableObject, stdio.MessagedError) {
-	info, errMessage := InfoModule.Get(username)
+func (tableModuleImpl tableModuleImpl) Get(ctx context.Context, username string, year string, semester int) (manager.TableObject, stdio.MessagedError) {
+	info, errMessage := InfoModule.Get(ctx, username)
 	if errMessage.HasInfo {
 		return manager.TableObject{}, errMessage
 	}
-	table, errMessage := manager.TableManager.Get(username, info, year, semester)
-	if errMessage.HasInfo {
-		return manager.TableObject{}, errMessage
+	var table manager.TableContent
+	var err error
+	if info.Identify == 1 {
+		table, err = manager.TableManager.GetTeacher(ctx, username, year, semester)
+	} else {
+		table, err = manager.TableManager.Get(ctx, info, year, semester)
+	}
+	if err != nil {
+		return manager.TableObject{}, manager.ErrorMessage(username, err)
 	}
 	if !table.Exist {
 		goto refresh
 	}
 	if !table.Expired {
 		var object = manager.TableObject{}
-		err := json.Unmarshal([]byte(table.Table), &object)
+		err = json.Unmarshal([]byte(table.Table), &object)
 		if err != nil {
 			return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
 		}
@@ -43,11 +56,11 @@ func (tableModuleImpl tableModuleImpl) Get(username string, year string, semeste
 	}
 
 refresh:
-	session, _, errMessage := SessionModule.Get(username, "")
+	session, _, errMessage := SessionModule.Get(ctx, username, "")
 	if errMessage.HasInfo {
 		return manager.TableObject{}, errMessage
 	}
-	tableContent, errMessage := TableModule.Refresh(username, info, year, semester, session)
+	tableContent, errMessage := TableModule.Refresh(ctx, username, info, year, semester, session)
 	if errMessage.HasInfo {
 		return manager.TableObject{}, errMessage
 	} else {
@@ -55,32 +68,67 @@ refresh:
 	}
 }
 
-func (tableModuleImpl tableModuleImpl) Refresh(username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError) {
-	switch info.Identify {
-	case 0:
-		return studentTable(username, info, year, semester, session)
-	case 1:
-		return teacherTable(username, info, year, semester, session)
-	default:
-		return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+func (tableModuleImpl tableModuleImpl) Refresh(ctx context.Context, username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError) {
+	return CurrentEduSystem.Table(ctx, username, info, year, semester, session)
+}
+
+func (tableModuleImpl tableModuleImpl) Calendar(ctx context.Context, username string, year string, semester int) (string, stdio.MessagedError) {
+	semesterItem, exist := manager.CalendarManager.Find(year, semester)
+	if !exist {
+		stdio.LogInfo(username, "校历中不存在目标学期，无法导出日历")
+		return "", stdio.GetErrorMessage(-500, "目标学期校历不存在")
+	}
+	table, errMessage := TableModule.Get(ctx, username, year, semester)
+	if errMessage.HasInfo {
+		return "", errMessage
+	}
+
+	weekStart := manager.CalendarManager.WeekStart(semesterItem)
+
+	events := make([]unit.ICalendarEvent, 0)
+	for dayIndex, day := range table.Object {
+		for classIndex, class := range day {
+			lessonTime := consts.LessonTime[classIndex]
+			for itemIndex, item := range class.Data {
+				for _, week := range item.Range {
+					// 上游课表的周次可能超出校历中的教学周数，超出部分不导出
+					if !manager.CalendarManager.InWeeks(semesterItem, week) {
+						continue
+					}
+					date := weekStart.AddDate(0, 0, (week-1)*7+dayIndex)
+					if manager.CalendarManager.IsHoliday(semesterItem, date) {
+						continue
+					}
+					events = append(events, unit.ICalendarEvent{
+						UID: strings.Join([]string{
+							username, year, strconv.Itoa(semester), strconv.Itoa(dayIndex),
+							strconv.Itoa(classIndex), strconv.Itoa(itemIndex), strconv.Itoa(week),
+						}, "-") + "@tool.eclass.sgpublic.xyz",
+						Summary:     item.Name,
+						Location:    item.Room,
+						Description: "教师：" + item.Teacher + "\n第" + strconv.Itoa(week) + "周",
+						Start: time.Date(date.Year(), date.Month(), date.Day(),
+							lessonTime[0][0], lessonTime[0][1], 0, 0, time.Local),
+						End: time.Date(date.Year(), date.Month(), date.Day(),
+							lessonTime[1][0], lessonTime[1][1], 0, 0, time.Local),
+					})
+				}
+			}
+		}
 	}
+	stdio.LogVerbose(username, "用户导出课表日历成功")
+	return unit.BuildICalendar(year+" 第"+strconv.Itoa(semester)+"学期课表", events), stdio.GetEmptyErrorMessage()
 }
 
-func studentTable(username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError) {
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
-	urlString := "http://218.6.163.93:8081/tjkbcx.aspx?xh=" + username
-	req, _ := http.NewRequest("GET", urlString, nil)
+func (zhengFangSystem zhengFangSystem) studentTable(ctx context.Context, username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError) {
+	urlString := zhengFangSystem.page("tjkbcx") + "?xh=" + username
+	req, _ := http.NewRequestWithContext(ctx, "GET", urlString, nil)
 	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 	req.Header.Add("Referer", urlString)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := client.Do(req)
+	resp, err := unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.TableObject{}, unit.UpstreamErrorMessage(username, err)
 	}
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	resp.Body.Close()
@@ -99,21 +147,20 @@ func studentTable(username string, info manager.UserInfo, year string, semester
 	form.Set("__EVENTARGUMENT", "")
 	form.Set("__LASTFOCUS", "")
 	form.Set("__VIEWSTATE", viewState)
-	form.Set("__VIEWSTATEGENERATOR", "3189F21D")
+	form.Set("__VIEWSTATEGENERATOR", zhengFangSystem.viewStateGenerator("tjkbcx"))
 	form.Set("xn", year)
 	form.Set("xq", strconv.Itoa(semester))
 	form.Set("nj", strconv.Itoa(info.Grade))
 	form.Set("xy", strconv.Itoa(info.Faculty))
 	form.Set("zy", strconv.Itoa(info.Specialty))
 	form.Set("kb", "")
-	req, _ = http.NewRequest("POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
+	req, _ = http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
 	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 	req.Header.Add("Referer", urlString)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err = client.Do(req)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.TableObject{}, unit.UpstreamErrorMessage(username, err)
 	}
 
 	doc, err = goquery.NewDocumentFromReader(resp.Body)
@@ -122,9 +169,9 @@ func studentTable(username string, info manager.UserInfo, year string, semester
 		stdio.LogError("", "HTML解析失败", err)
 		return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
 	}
-	className, errMessage := manager.ChartManager.GetClassName(info.Faculty, info.Specialty, info.Class)
-	if errMessage.HasInfo {
-		return manager.TableObject{}, errMessage
+	className, err := manager.ChartManager.GetClassName(ctx, info.Faculty, info.Specialty, info.Class)
+	if err != nil {
+		return manager.TableObject{}, manager.ErrorMessage(username, err)
 	}
 	tableId := ""
 	selected := false
@@ -157,21 +204,20 @@ func studentTable(username string, info manager.UserInfo, year string, semester
 	form.Set("__EVENTARGUMENT", "")
 	form.Set("__LASTFOCUS", "")
 	form.Set("__VIEWSTATE", viewState)
-	form.Set("__VIEWSTATEGENERATOR", "3189F21D")
+	form.Set("__VIEWSTATEGENERATOR", zhengFangSystem.viewStateGenerator("tjkbcx"))
 	form.Set("xn", year)
 	form.Set("xq", strconv.Itoa(semester))
 	form.Set("nj", strconv.Itoa(info.Grade))
 	form.Set("xy", strconv.Itoa(info.Faculty))
 	form.Set("zy", strconv.Itoa(info.Specialty))
 	form.Set("kb", tableId)
-	req, _ = http.NewRequest("POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
+	req, _ = http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
 	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
 	req.Header.Add("Referer", urlString)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err = client.Do(req)
+	resp, err = unit.DoUpstream(req)
 	if err != nil {
-		stdio.LogError(username, "网络请求失败", err)
-		return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		return manager.TableObject{}, unit.UpstreamErrorMessage(username, err)
 	}
 
 	doc, err = goquery.NewDocumentFromReader(resp.Body)
@@ -296,10 +342,171 @@ parse:
 			}
 		}
 	}
-	manager.TableManager.Update(username, info, year, semester, tableId, tableObject)
+	err = manager.TableManager.Update(ctx, username, info, year, semester, tableId, tableObject)
+	if err != nil {
+		return manager.TableObject{}, manager.ErrorMessage(username, err)
+	}
+	return tableObject, stdio.GetEmptyErrorMessage()
+}
+
+func (zhengFangSystem zhengFangSystem) teacherTable(ctx context.Context, username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError) {
+	urlString := zhengFangSystem.page("jskbcx") + "?zgh=" + username
+	req, _ := http.NewRequestWithContext(ctx, "GET", urlString, nil)
+	req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
+	req.Header.Add("Referer", urlString)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := unit.DoUpstream(req)
+	if err != nil {
+		return manager.TableObject{}, unit.UpstreamErrorMessage(username, err)
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		stdio.LogError("", "HTML解析失败", err)
+		return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+	viewState := doc.Find("#__VIEWSTATE").AttrOr("value", "")
+	if viewState == "" {
+		stdio.LogError(username, "未发现 __VIEWSTATE", nil)
+		return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+
+	if doc.Find("#xn").Find("option[selected]").AttrOr("value", "") != year ||
+		doc.Find("#xq").Find("option[selected]").AttrOr("value", "") != strconv.Itoa(semester) {
+		form := url.Values{}
+		form.Set("__EVENTTARGET", "xq")
+		form.Set("__EVENTARGUMENT", "")
+		form.Set("__LASTFOCUS", "")
+		form.Set("__VIEWSTATE", viewState)
+		form.Set("xn", year)
+		form.Set("xq", strconv.Itoa(semester))
+		req, _ = http.NewRequestWithContext(ctx, "POST", urlString, strings.NewReader(strings.TrimSpace(form.Encode())))
+		req.AddCookie(&http.Cookie{Name: "ASP.NET_SessionId", Value: session})
+		req.Header.Add("Referer", urlString)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err = unit.DoUpstream(req)
+		if err != nil {
+			return manager.TableObject{}, unit.UpstreamErrorMessage(username, err)
+		}
+		doc, err = goquery.NewDocumentFromReader(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			stdio.LogError("", "HTML解析失败", err)
+			return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+		}
+	}
+
+	tableObject := manager.TableObject{}
+	resultCount := 0
+	doc.Find("#Table1").Find("td").Each(func(_ int, td *goquery.Selection) {
+		cellHtml, err := td.Html()
+		if err != nil {
+			return
+		}
+		cellHtml = strings.ReplaceAll(cellHtml, "\n", "")
+		if !strings.Contains(cellHtml, "<br/>") {
+			return
+		}
+		// 教师课表单元格内每门课程依次为：课程名、上课时间、上课班级、教室，多门课程之间以空行分隔
+		var lessonLines [][]string
+		var current []string
+		for _, line := range strings.Split(cellHtml, "<br/>") {
+			line = strings.TrimSpace(html.UnescapeString(line))
+			if line == "" {
+				if len(current) > 0 {
+					lessonLines = append(lessonLines, current)
+					current = nil
+				}
+				continue
+			}
+			current = append(current, line)
+		}
+		if len(current) > 0 {
+			lessonLines = append(lessonLines, current)
+		}
+		for _, lines := range lessonLines {
+			if len(lines) < 2 {
+				continue
+			}
+			day, class, weeks, ok := parseTeacherLessonTime(lines[1])
+			if !ok {
+				stdio.LogWarn(username, "教师课表上课时间解析失败："+lines[1], nil)
+				continue
+			}
+			item := manager.LessonSingleItem{
+				Name:    lines[0],
+				Range:   weeks,
+				Teacher: info.Name,
+			}
+			if len(lines) > 2 {
+				item.Class = lines[2]
+			}
+			if len(lines) > 3 {
+				item.Room = lines[3]
+			}
+			tableObject.Object[day][class].Data = append(tableObject.Object[day][class].Data, item)
+			resultCount++
+		}
+	})
+	if resultCount == 0 {
+		stdio.LogError(username, "课表数据为空", nil)
+		return manager.TableObject{}, stdio.GetErrorMessage(-500, "课表数据为空")
+	}
+
+	for dayIndex, day := range tableObject.Object {
+		for classIndex, class := range day {
+			if class.Data != nil {
+				continue
+			}
+			tableObject.Object[dayIndex][classIndex] = manager.LessonItem{
+				Data: []manager.LessonSingleItem{},
+			}
+		}
+	}
+	err = manager.TableManager.UpdateTeacher(ctx, username, year, semester, tableObject)
+	if err != nil {
+		return manager.TableObject{}, manager.ErrorMessage(username, err)
+	}
 	return tableObject, stdio.GetEmptyErrorMessage()
 }
 
-func teacherTable(username string, info manager.UserInfo, year string, semester int, session string) (manager.TableObject, stdio.MessagedError) {
-	return manager.TableObject{}, stdio.GetErrorMessage(-500, "TODO")
+var teacherLessonTimeRegexp = regexp.MustCompile("周([一二三四五六日])第(\\d+)[,，\\d]*节\\{第([\\d,\\-]+)周(\\|([单双])周)?\\}")
+
+// parseTeacherLessonTime 解析形如“周一第1,2节{第1-16周|单周}”的上课时间，返回星期、大节序号与周次
+func parseTeacherLessonTime(timeString string) (int, int, []int, bool) {
+	match := teacherLessonTimeRegexp.FindStringSubmatch(timeString)
+	if match == nil {
+		return 0, 0, nil, false
+	}
+	day := strings.Index("一二三四五六日", match[1]) / len("一")
+	period, err := strconv.Atoi(match[2])
+	if err != nil || period < 1 {
+		return 0, 0, nil, false
+	}
+	class := (period - 1) / 2
+	if class >= len(consts.LessonTime) {
+		return 0, 0, nil, false
+	}
+	var weeks []int
+	for _, item := range strings.Split(match[3], ",") {
+		localRange := strings.SplitN(item, "-", 2)
+		if len(localRange) == 1 {
+			localRange = append(localRange, localRange[0])
+		}
+		start, err := strconv.Atoi(localRange[0])
+		if err != nil {
+			return 0, 0, nil, false
+		}
+		end, err := strconv.Atoi(localRange[1])
+		if err != nil {
+			return 0, 0, nil, false
+		}
+		for index := start; index <= end; index++ {
+			if (match[5] == "单" && index%2 == 0) || (match[5] == "双" && index%2 == 1) {
+				continue
+			}
+			weeks = append(weeks, index)
+		}
+	}
+	return day, class, weeks, true
 }
@@ -0,0 +1,117 @@
+package module
+
+import (
+	"SCITEduTool/Application/manager"
+	"SCITEduTool/Application/stdio"
+	"context"
+	"strings"
+)
+
+// ZhengFangConfig 正方教务系统配置，BaseUrl 为教务系统地址，CasUrl 为统一身份认证地址，
+// ViewStateGenerator 以页面名称（不含 .aspx）为键
+type ZhengFangConfig struct {
+	BaseUrl            string            `json:"base_url"`
+	CasUrl             string            `json:"cas_url"`
+	CasLoginToken      string            `json:"cas_login_token"`
+	ViewStateGenerator map[string]string `json:"view_state_generator"`
+}
+
+type zhengFangSystem struct {
+	conf ZhengFangConfig
+}
+
+func GetDefaultZhengFangConfig() ZhengFangConfig {
+	return ZhengFangConfig{
+		BaseUrl:       "http://218.6.163.93:8081",
+		CasUrl:        "http://218.6.163.95:18080/zfca",
+		CasLoginToken: "0122579031373493708",
+		ViewStateGenerator: map[string]string{
+			"tjkbcx": "3189F21D",
+			"xscj":   "17EB693E",
+		},
+	}
+}
+
+func newZhengFangSystem(conf ZhengFangConfig) zhengFangSystem {
+	defaultConf := GetDefaultZhengFangConfig()
+	if conf.BaseUrl == "" {
+		conf.BaseUrl = defaultConf.BaseUrl
+	}
+	if conf.CasUrl == "" {
+		conf.CasUrl = defaultConf.CasUrl
+	}
+	if conf.CasLoginToken == "" {
+		conf.CasLoginToken = defaultConf.CasLoginToken
+	}
+	if conf.ViewStateGenerator == nil {
+		conf.ViewStateGenerator = make(map[string]string)
+	}
+	for page, value := range defaultConf.ViewStateGenerator {
+		if _, exist := conf.ViewStateGenerator[page]; !exist {
+			conf.ViewStateGenerator[page] = value
+		}
+	}
+	conf.BaseUrl = strings.TrimSuffix(conf.BaseUrl, "/")
+	conf.CasUrl = strings.TrimSuffix(conf.CasUrl, "/")
+	return zhengFangSystem{conf: conf}
+}
+
+func (zhengFangSystem zhengFangSystem) Name() string {
+	return "zhengfang"
+}
+
+// page 返回教务系统页面地址，name 不含 .aspx
+func (zhengFangSystem zhengFangSystem) page(name string) string {
+	return zhengFangSystem.conf.BaseUrl + "/" + name + ".aspx"
+}
+
+func (zhengFangSystem zhengFangSystem) viewStateGenerator(name string) string {
+	return zhengFangSystem.conf.ViewStateGenerator[name]
+}
+
+func (zhengFangSystem zhengFangSystem) Info(ctx context.Context, username string, session string, identify int) (manager.UserInfo, stdio.MessagedError) {
+	switch identify {
+	case 0:
+		return zhengFangSystem.studentInfo(ctx, username, session)
+	case 1:
+		return zhengFangSystem.teacherInfo(ctx, username, session)
+	default:
+		return manager.UserInfo{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+}
+
+func (zhengFangSystem zhengFangSystem) Table(ctx context.Context, username string, info manager.UserInfo, year string, semester int,
+	session string) (manager.TableObject, stdio.MessagedError) {
+	switch info.Identify {
+	case 0:
+		return zhengFangSystem.studentTable(ctx, username, info, year, semester, session)
+	case 1:
+		return zhengFangSystem.teacherTable(ctx, username, info, year, semester, session)
+	default:
+		return manager.TableObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+}
+
+func (zhengFangSystem zhengFangSystem) Achieve(ctx context.Context, username string, info manager.UserInfo, year string, semester int,
+	session string) (manager.AchieveObject, stdio.MessagedError) {
+	switch info.Identify {
+	case 0:
+		return zhengFangSystem.studentAchieve(ctx, username, year, semester, session)
+	case 1:
+		return manager.AchieveObject{}, stdio.GetErrorMessage(-500, "什么？老师还有成绩单？(°Д°≡°Д°)")
+	default:
+		return manager.AchieveObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+}
+
+func (zhengFangSystem zhengFangSystem) Exam(ctx context.Context, username string, session string, identify int, year string,
+	semester int) (manager.ExamObject, stdio.MessagedError) {
+	switch identify {
+	case 0:
+		return zhengFangSystem.studentExam(ctx, username, session, year, semester)
+	case 1:
+		return zhengFangSystem.teacherExam(ctx, username, session, year, semester)
+	default:
+		return manager.ExamObject{}, stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+}
@@ -0,0 +1,175 @@
+package unit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 客户端加密方式，由登录请求的 enc 参数指定，GetKey 返回服务端支持的加密方式。
+// pkcs1 为旧版 RSA PKCS#1 v1.5；rsa-oaep-256 为 RSA-OAEP，哈希与 MGF1 均使用 SHA-256；
+// x25519-aes-gcm 为混合加密，密文为 base64(临时公钥 32 字节 || IV 12 字节 || AES-256-GCM 密文与标签)，
+// AES 密钥为 HKDF-SHA256(ikm=X25519(临时私钥, exchange_key), salt=临时公钥 || exchange_key, info=hybridInfo)
+const (
+	CipherPKCS1  = "pkcs1"
+	CipherOAEP   = "rsa-oaep-256"
+	CipherHybrid = "x25519-aes-gcm"
+)
+
+var CipherSchemes = []string{CipherPKCS1, CipherOAEP, CipherHybrid}
+
+const hybridInfo = "SCITEduTool x25519-aes-gcm"
+
+// envelopeMaxAge 与 envelopeMaxSkew 为信封时间戳允许早于与晚于服务器时间的秒数，与接口 ts 参数的校验一致
+const (
+	envelopeMaxAge  = 600
+	envelopeMaxSkew = 30
+)
+
+// maxCipherTextLength CipherText.String 编码后的最大长度，密文需保存于 user_token.u_password
+const maxCipherTextLength = 600
+
+var ErrCipherScheme = errors.New("不支持的加密方式")
+var ErrEnvelopeMalformed = errors.New("信封格式错误")
+var ErrEnvelopeExpired = errors.New("信封已过期")
+var ErrEnvelopeReplayed = errors.New("信封重复使用")
+
+// CipherText 客户端提交的密文，保存时以 String 编码，可由 ParseCipherText 还原后再次解密，编码后不得超过 600 字符
+type CipherText struct {
+	Scheme string
+	Kid    string
+	Data   string
+}
+
+// Envelope rsa-oaep-256 与 x25519-aes-gcm 加密前的明文信封，JSON 格式为
+// {"nonce":"随机字符串","ts":加密时的 Unix 时间戳（秒）,"data":"原文"}。
+// nonce 为 16 至 64 位随机字符串，有效期内同一 nonce 只能使用一次；ts 需在服务器时间前 600 秒至后 30 秒内。
+// pkcs1 沿用旧版格式，明文为 GetKey 返回的 8 位 hash 与原文直接拼接，不校验时效
+type Envelope struct {
+	Nonce     string `json:"nonce"`
+	Timestamp int64  `json:"ts"`
+	Data      string `json:"data"`
+}
+
+// String 编码为 [加密方式:]kid:密文，pkcs1 省略加密方式以兼容已保存的密文
+func (cipherText CipherText) String() string {
+	if cipherText.Scheme == "" || cipherText.Scheme == CipherPKCS1 {
+		return cipherText.Kid + ":" + cipherText.Data
+	}
+	return cipherText.Scheme + ":" + cipherText.Kid + ":" + cipherText.Data
+}
+
+// ParseCipherText 解析 CipherText.String 编码的密文，未附加密钥 ID 的旧版密文使用 LegacyKid
+func ParseCipherText(data string) CipherText {
+	parts := strings.SplitN(data, ":", 3)
+	switch len(parts) {
+	case 1:
+		return CipherText{Scheme: CipherPKCS1, Kid: LegacyKid, Data: data}
+	case 2:
+		return CipherText{Scheme: CipherPKCS1, Kid: parts[0], Data: parts[1]}
+	default:
+		return CipherText{Scheme: parts[0], Kid: parts[1], Data: parts[2]}
+	}
+}
+
+// parseEnvelope 解析解密后的明文，fresh 为 true 时校验时间戳并记录 nonce
+func parseEnvelope(scheme string, plain []byte, fresh bool) (Envelope, error) {
+	if scheme == CipherPKCS1 {
+		if len(plain) <= 8 {
+			return Envelope{}, ErrEnvelopeMalformed
+		}
+		return Envelope{
+			Nonce: string(plain[:8]),
+			Data:  string(plain[8:]),
+		}, nil
+	}
+	envelope := Envelope{}
+	if json.Unmarshal(plain, &envelope) != nil || len(envelope.Nonce) < 16 || len(envelope.Nonce) > 64 ||
+		envelope.Data == "" {
+		return Envelope{}, ErrEnvelopeMalformed
+	}
+	if !fresh {
+		return envelope, nil
+	}
+	age := time.Now().Unix() - envelope.Timestamp
+	if age > envelopeMaxAge || age < -envelopeMaxSkew {
+		return Envelope{}, ErrEnvelopeExpired
+	}
+	if !usedNonces.add(envelope.Nonce, envelope.Timestamp+envelopeMaxAge) {
+		return Envelope{}, ErrEnvelopeReplayed
+	}
+	return envelope, nil
+}
+
+// decryptHybrid 解密 x25519-aes-gcm 密文
+func decryptHybrid(exchangeKey *ecdh.PrivateKey, data []byte) ([]byte, error) {
+	if len(data) < 32+12+16 {
+		return nil, ErrEnvelopeMalformed
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(data[:32])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := exchangeKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(append([]byte{}, data[:32]...), exchangeKey.PublicKey().Bytes()...)
+	block, err := aes.NewCipher(hkdfSHA256(shared, salt, []byte(hybridInfo)))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, data[32:44], data[44:], nil)
+}
+
+// hkdfSHA256 RFC 5869 HKDF，仅输出一个分组（32 字节）
+func hkdfSHA256(ikm []byte, salt []byte, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// nonceCache 有效期内已使用的信封 nonce
+type nonceCache struct {
+	lock     sync.Mutex
+	nonces   map[string]int64
+	prunedAt int64
+}
+
+var usedNonces = nonceCache{
+	nonces: make(map[string]int64),
+}
+
+// add 记录 nonce 及其过期时间，nonce 已存在时返回 false
+func (cache *nonceCache) add(nonce string, expired int64) bool {
+	timeNow := time.Now().Unix()
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.prunedAt+envelopeMaxAge < timeNow {
+		for key, keyExpired := range cache.nonces {
+			if keyExpired < timeNow {
+				delete(cache.nonces, key)
+			}
+		}
+		cache.prunedAt = timeNow
+	}
+	if _, exist := cache.nonces[nonce]; exist {
+		return false
+	}
+	cache.nonces[nonce] = expired
+	return true
+}
@@ -0,0 +1,159 @@
+package unit
+
+import (
+	"crypto/ecdh"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func envelopeJSON(nonce string, ts int64, data string) []byte {
+	return []byte(`{"nonce":"` + nonce + `","ts":` + strconv.FormatInt(ts, 10) + `,"data":"` + data + `"}`)
+}
+
+func TestParseEnvelope(t *testing.T) {
+	timeNow := time.Now().Unix()
+	tests := []struct {
+		name   string
+		scheme string
+		plain  []byte
+		fresh  bool
+		data   string
+		err    error
+	}{
+		{name: "pkcs1", scheme: CipherPKCS1, plain: []byte("12345678password"), fresh: true, data: "password"},
+		{name: "pkcs1 缺少原文", scheme: CipherPKCS1, plain: []byte("12345678"), fresh: true, err: ErrEnvelopeMalformed},
+		{name: "当前时间", scheme: CipherOAEP, plain: envelopeJSON("nonce-current-0001", timeNow, "password"), fresh: true,
+			data: "password"},
+		{name: "有效期边界", scheme: CipherHybrid, plain: envelopeJSON("nonce-max-age-0001", timeNow-envelopeMaxAge+1, "password"),
+			fresh: true, data: "password"},
+		{name: "已过期", scheme: CipherHybrid, plain: envelopeJSON("nonce-expired-0001", timeNow-envelopeMaxAge-1, "password"),
+			fresh: true, err: ErrEnvelopeExpired},
+		{name: "时钟误差边界", scheme: CipherHybrid, plain: envelopeJSON("nonce-max-skew-001", timeNow+envelopeMaxSkew-1, "password"),
+			fresh: true, data: "password"},
+		{name: "超出时钟误差", scheme: CipherHybrid, plain: envelopeJSON("nonce-skewed-00001", timeNow+envelopeMaxSkew+2, "password"),
+			fresh: true, err: ErrEnvelopeExpired},
+		{name: "已保存的密文不校验时效", scheme: CipherHybrid, plain: envelopeJSON("nonce-stored-00001", 1, "password"),
+			data: "password"},
+		{name: "nonce 过短", scheme: CipherOAEP, plain: envelopeJSON("short", timeNow, "password"), fresh: true,
+			err: ErrEnvelopeMalformed},
+		{name: "原文为空", scheme: CipherOAEP, plain: envelopeJSON("nonce-empty-00001", timeNow, ""), fresh: true,
+			err: ErrEnvelopeMalformed},
+		{name: "非 JSON", scheme: CipherOAEP, plain: []byte("12345678password"), fresh: true, err: ErrEnvelopeMalformed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envelope, err := parseEnvelope(test.scheme, test.plain, test.fresh)
+			if err != test.err {
+				t.Fatalf("解析结果应为 %v，实际为 %v", test.err, err)
+			}
+			if envelope.Data != test.data {
+				t.Fatalf("原文应为 %q，实际为 %q", test.data, envelope.Data)
+			}
+		})
+	}
+}
+
+func TestParseEnvelopeReplay(t *testing.T) {
+	plain := envelopeJSON("nonce-replayed-001", time.Now().Unix(), "password")
+	if _, err := parseEnvelope(CipherOAEP, plain, true); err != nil {
+		t.Fatalf("首次使用应通过，实际为 %v", err)
+	}
+	if _, err := parseEnvelope(CipherHybrid, plain, true); err != ErrEnvelopeReplayed {
+		t.Fatalf("重复使用应返回 ErrEnvelopeReplayed，实际为 %v", err)
+	}
+	if _, err := parseEnvelope(CipherHybrid, plain, false); err != nil {
+		t.Fatalf("已保存的密文不应记录 nonce，实际为 %v", err)
+	}
+}
+
+func TestNonceCacheAdd(t *testing.T) {
+	timeNow := time.Now().Unix()
+	tests := []struct {
+		name     string
+		nonces   map[string]int64
+		prunedAt int64
+		nonce    string
+		added    bool
+	}{
+		{name: "新 nonce", nonces: map[string]int64{}, prunedAt: timeNow, nonce: "nonce", added: true},
+		{name: "有效期内重复", nonces: map[string]int64{"nonce": timeNow + envelopeMaxAge}, prunedAt: timeNow, nonce: "nonce"},
+		{name: "已过期但尚未清理", nonces: map[string]int64{"nonce": timeNow - 1}, prunedAt: timeNow, nonce: "nonce"},
+		{name: "已过期且已清理", nonces: map[string]int64{"nonce": timeNow - 1}, prunedAt: timeNow - envelopeMaxAge - 1,
+			nonce: "nonce", added: true},
+		{name: "清理时保留未过期的 nonce", nonces: map[string]int64{"nonce": timeNow + envelopeMaxAge},
+			prunedAt: timeNow - envelopeMaxAge - 1, nonce: "nonce"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := nonceCache{nonces: test.nonces, prunedAt: test.prunedAt}
+			if added := cache.add(test.nonce, timeNow+envelopeMaxAge); added != test.added {
+				t.Fatalf("记录结果应为 %v，实际为 %v", test.added, added)
+			}
+			if _, exist := cache.nonces[test.nonce]; !exist {
+				t.Fatal("nonce 应保留在缓存中")
+			}
+		})
+	}
+}
+
+// TestHKDFSHA256 RFC 5869 测试用例 1 输出的第一个分组
+func TestHKDFSHA256(t *testing.T) {
+	okm := hkdfSHA256(mustHex(t, "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b"), mustHex(t, "000102030405060708090a0b0c"),
+		mustHex(t, "f0f1f2f3f4f5f6f7f8f9"))
+	if hex.EncodeToString(okm) != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf" {
+		t.Fatalf("HKDF 输出错误：%x", okm)
+	}
+}
+
+// TestDecryptHybrid 使用 RFC 7748 的 X25519 密钥对，临时私钥为 Alice 的私钥，exchange_key 为 Bob 的私钥，IV 为 000102…0b
+func TestDecryptHybrid(t *testing.T) {
+	exchangeKey, err := ecdh.X25519().NewPrivateKey(mustHex(t, "5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vector := "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a" + // 临时公钥
+		"000102030405060708090a0b" + // IV
+		"a6f4072aca717f91f495141937241952075d8e5a10973124d984261c8ee9654fbe9c1da46cd17461b7656c5fcf275e85" +
+		"99f3bf69ae7011c5a40ba36c58535a3491507b788a11d73026f5d8ad" // 密文与标签
+	plain := `{"nonce":"0123456789abcdef","ts":1700000000,"data":"123456"}`
+	tests := []struct {
+		name   string
+		modify func(data []byte) []byte
+		plain  string
+		fail   bool
+	}{
+		{name: "标准向量", modify: func(data []byte) []byte { return data }, plain: plain},
+		{name: "临时公钥被修改", modify: func(data []byte) []byte { data[0] ^= 1; return data }, fail: true},
+		{name: "IV 被修改", modify: func(data []byte) []byte { data[32] ^= 1; return data }, fail: true},
+		{name: "密文被修改", modify: func(data []byte) []byte { data[44] ^= 1; return data }, fail: true},
+		{name: "标签被修改", modify: func(data []byte) []byte { data[len(data)-1] ^= 1; return data }, fail: true},
+		{name: "长度不足", modify: func(data []byte) []byte { return data[:32+12+15] }, fail: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := decryptHybrid(exchangeKey, test.modify(mustHex(t, vector)))
+			if test.fail {
+				if err == nil {
+					t.Fatal("解密应失败")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != test.plain {
+				t.Fatalf("解密结果错误：%s", result)
+			}
+		})
+	}
+}
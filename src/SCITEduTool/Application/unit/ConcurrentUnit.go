@@ -0,0 +1,119 @@
+package unit
+
+import (
+	"SCITEduTool/Application/stdio"
+	"context"
+	"sync"
+	"time"
+)
+
+// CallGroup 合并相同 key 的并发调用，调用未结束时后来者等待并共享同一结果。
+// 共享的调用使用脱离调用方取消的 ctx 执行，并受 timeout 限制，任一调用方取消只结束其自身的等待
+type CallGroup struct {
+	timeout time.Duration
+	lock    sync.Mutex
+	calls   map[string]*groupCall
+}
+
+type groupCall struct {
+	done       chan struct{}
+	value      interface{}
+	errMessage stdio.MessagedError
+}
+
+func NewCallGroup(timeout time.Duration) *CallGroup {
+	return &CallGroup{
+		timeout: timeout,
+		calls:   make(map[string]*groupCall),
+	}
+}
+
+// Do 执行或等待 key 对应的调用，ctx 结束时放弃等待并返回对应的错误信息，调用本身继续执行直至完成或超时
+func (group *CallGroup) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, stdio.MessagedError)) (interface{},
+	stdio.MessagedError) {
+	group.lock.Lock()
+	call, exist := group.calls[key]
+	if !exist {
+		call = &groupCall{done: make(chan struct{})}
+		group.calls[key] = call
+		go group.run(ctx, key, call, fn)
+	}
+	group.lock.Unlock()
+	select {
+	case <-call.done:
+		return call.value, call.errMessage
+	case <-ctx.Done():
+		return nil, UpstreamErrorMessage("", ctx.Err())
+	}
+}
+
+func (group *CallGroup) run(ctx context.Context, key string, call *groupCall, fn func(ctx context.Context) (interface{}, stdio.MessagedError)) {
+	callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), group.timeout)
+	defer cancel()
+	call.value, call.errMessage = fn(callCtx)
+	group.lock.Lock()
+	delete(group.calls, key)
+	group.lock.Unlock()
+	close(call.done)
+}
+
+// HostLimiter 限制对同一主机同时进行的请求数量
+type HostLimiter struct {
+	limit int
+	lock  sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func NewHostLimiter(limit int) *HostLimiter {
+	return &HostLimiter{
+		limit: limit,
+		hosts: make(map[string]chan struct{}),
+	}
+}
+
+// Acquire 等待主机的空闲名额，ctx 结束时放弃等待并返回 ctx.Err()，此时无需 Release
+func (limiter *HostLimiter) Acquire(ctx context.Context, host string) error {
+	limiter.lock.Lock()
+	slots, exist := limiter.hosts[host]
+	if !exist {
+		slots = make(chan struct{}, limiter.limit)
+		limiter.hosts[host] = slots
+	}
+	limiter.lock.Unlock()
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (limiter *HostLimiter) Release(host string) {
+	limiter.lock.Lock()
+	slots := limiter.hosts[host]
+	limiter.lock.Unlock()
+	<-slots
+}
+
+// RunBounded 以最多 workers 个协程执行 fn(0) 至 fn(count-1)，全部执行完毕后返回
+func RunBounded(count int, workers int, fn func(index int)) {
+	if workers <= 0 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	var group sync.WaitGroup
+	for i := 0; i < workers && i < count; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for index := range indexes {
+				fn(index)
+			}
+		}()
+	}
+	for index := 0; index < count; index++ {
+		indexes <- index
+	}
+	close(indexes)
+	group.Wait()
+}
@@ -0,0 +1,83 @@
+package unit
+
+import (
+	"SCITEduTool/Application/stdio"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitingContext 在调用方开始等待共享结果（首次调用 Done）时发出通知
+type waitingContext struct {
+	context.Context
+	once    sync.Once
+	waiting chan struct{}
+}
+
+func (ctx *waitingContext) Done() <-chan struct{} {
+	ctx.once.Do(func() {
+		close(ctx.waiting)
+	})
+	return ctx.Context.Done()
+}
+
+func TestCallGroupCancelledCaller(t *testing.T) {
+	group := NewCallGroup(time.Second)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, stdio.MessagedError) {
+		atomic.AddInt32(&calls, 1)
+		close(started)
+		select {
+		case <-release:
+			return "news", stdio.GetEmptyErrorMessage()
+		case <-ctx.Done():
+			return nil, UpstreamErrorMessage("", ctx.Err())
+		}
+	}
+
+	firstCtx, cancel := context.WithCancel(context.Background())
+	firstDone := make(chan stdio.MessagedError)
+	go func() {
+		_, errMessage := group.Do(firstCtx, "key", fn)
+		firstDone <- errMessage
+	}()
+	<-started
+
+	secondCtx := &waitingContext{Context: context.Background(), waiting: make(chan struct{})}
+	secondDone := make(chan interface{})
+	go func() {
+		value, errMessage := group.Do(secondCtx, "key", fn)
+		if errMessage.HasInfo {
+			t.Errorf("第二个调用方不应受第一个调用方取消的影响：%d", errMessage.Code)
+		}
+		secondDone <- value
+	}()
+	<-secondCtx.waiting
+
+	cancel()
+	if errMessage := <-firstDone; errMessage.Code != -499 {
+		t.Fatalf("取消的调用方应返回 -499，实际为 %d", errMessage.Code)
+	}
+	close(release)
+	if value := <-secondDone; value != "news" {
+		t.Fatalf("第二个调用方应获得共享结果，实际为 %v", value)
+	}
+	if calls != 1 {
+		t.Fatalf("相同 key 的调用应只执行一次，实际为 %d 次", calls)
+	}
+}
+
+func TestCallGroupTimeout(t *testing.T) {
+	group := NewCallGroup(10 * time.Millisecond)
+	_, errMessage := group.Do(context.Background(), "key", func(ctx context.Context) (interface{}, stdio.MessagedError) {
+		<-ctx.Done()
+		return nil, UpstreamErrorMessage("", ctx.Err())
+	})
+	if errMessage.Code != -504 {
+		t.Fatalf("共享调用超时应返回 -504，实际为 %d", errMessage.Code)
+	}
+}
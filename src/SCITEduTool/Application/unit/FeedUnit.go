@@ -0,0 +1,184 @@
+package unit
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type Feed struct {
+	Title       string
+	Link        string
+	SelfLink    string
+	Description string
+	Items       []FeedItem
+}
+
+type FeedItem struct {
+	GUID      string
+	Title     string
+	Link      string
+	Summary   string
+	Image     string
+	Published time.Time
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	AtomLink      rssLink   `xml:"atom:link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	Description string        `xml:"description"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomDocument struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+// BuildRSS 生成 RSS 2.0 文档
+func BuildRSS(feed Feed) (string, error) {
+	document := rssDocument{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title: feed.Title,
+			Link:  feed.Link,
+			AtomLink: rssLink{
+				Href: feed.SelfLink,
+				Rel:  "self",
+				Type: "application/rss+xml",
+			},
+			Description: feed.Description,
+			Language:    "zh-cn",
+		},
+	}
+	if updated := feedUpdated(feed); !updated.IsZero() {
+		document.Channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+	for _, item := range feed.Items {
+		rss := rssItem{
+			Title: item.Title,
+			Link:  item.Link,
+			GUID: rssGUID{
+				IsPermaLink: "false",
+				Value:       item.GUID,
+			},
+			Description: item.Summary,
+		}
+		if !item.Published.IsZero() {
+			rss.PubDate = item.Published.Format(time.RFC1123Z)
+		}
+		if item.Image != "" {
+			rss.Enclosure = &rssEnclosure{
+				Url:  item.Image,
+				Type: "image/jpeg",
+			}
+		}
+		document.Channel.Items = append(document.Channel.Items, rss)
+	}
+	content, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(content), nil
+}
+
+// BuildAtom 生成 Atom 1.0 文档，条目缺少发布时间时使用订阅源的更新时间
+func BuildAtom(feed Feed) (string, error) {
+	updated := feedUpdated(feed)
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	document := atomDocument{
+		Title:   feed.Title,
+		ID:      feed.SelfLink,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: feed.Link},
+			{Href: feed.SelfLink, Rel: "self", Type: "application/atom+xml"},
+		},
+	}
+	for _, item := range feed.Items {
+		published := item.Published
+		if published.IsZero() {
+			published = updated
+		}
+		document.Entries = append(document.Entries, atomEntry{
+			Title:   item.Title,
+			ID:      item.GUID,
+			Updated: published.Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: item.Link, Rel: "alternate"},
+			},
+			Summary: item.Summary,
+		})
+	}
+	content, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(content), nil
+}
+
+func feedUpdated(feed Feed) time.Time {
+	var updated time.Time
+	for _, item := range feed.Items {
+		if item.Published.After(updated) {
+			updated = item.Published
+		}
+	}
+	return updated
+}
@@ -0,0 +1,163 @@
+package unit
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// sanitizeAllowedTags 保留的标签及其允许的属性，其余标签仅保留文本内容
+var sanitizeAllowedTags = map[atom.Atom][]string{
+	atom.P:          nil,
+	atom.Br:         nil,
+	atom.Strong:     nil,
+	atom.B:          nil,
+	atom.Em:         nil,
+	atom.I:          nil,
+	atom.U:          nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Ul:         nil,
+	atom.Ol:         nil,
+	atom.Li:         nil,
+	atom.Blockquote: nil,
+	atom.Table:      nil,
+	atom.Thead:      nil,
+	atom.Tbody:      nil,
+	atom.Tr:         nil,
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Th:         {"colspan", "rowspan"},
+	atom.A:          {"href"},
+	atom.Img:        {"src", "alt"},
+}
+
+// sanitizeDroppedTags 连同内容一起移除的标签
+var sanitizeDroppedTags = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Input:    true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Textarea: true,
+	atom.Noscript: true,
+}
+
+// SanitizeHTML 将 HTML 片段过滤为安全的标签子集，链接与图片地址按 base 转换为绝对地址，
+// 仅保留 http、https 与 mailto 链接
+func SanitizeHTML(content string, base string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	nodes, err := html.ParseFragment(strings.NewReader(content), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "div",
+		DataAtom: atom.Div,
+	})
+	if err != nil {
+		return "", err
+	}
+	builder := strings.Builder{}
+	for _, node := range nodes {
+		writeSanitizedNode(&builder, node, baseURL)
+	}
+	return strings.TrimSpace(builder.String()), nil
+}
+
+// ResolveURL 将相对地址按 base 转换为绝对地址，转换失败或协议不受支持时返回空字符串
+func ResolveURL(base string, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	return resolveURL(baseURL, ref)
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(refURL)
+	switch resolved.Scheme {
+	case "http", "https", "mailto":
+		return resolved.String()
+	default:
+		return ""
+	}
+}
+
+func writeSanitizedNode(builder *strings.Builder, node *html.Node, base *url.URL) {
+	switch node.Type {
+	case html.TextNode:
+		builder.WriteString(html.EscapeString(node.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if sanitizeDroppedTags[node.DataAtom] {
+		return
+	}
+	attributes, allowed := sanitizeAllowedTags[node.DataAtom]
+	if !allowed {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			writeSanitizedNode(builder, child, base)
+		}
+		return
+	}
+
+	var attributeString strings.Builder
+	for _, attribute := range node.Attr {
+		if !containsString(attributes, attribute.Key) {
+			continue
+		}
+		value := attribute.Val
+		if attribute.Key == "href" || attribute.Key == "src" {
+			value = resolveURL(base, value)
+			if value == "" {
+				continue
+			}
+		}
+		attributeString.WriteString(" " + attribute.Key + "=\"" + html.EscapeString(value) + "\"")
+	}
+	if node.DataAtom == atom.Img {
+		if !strings.Contains(attributeString.String(), " src=") {
+			return
+		}
+		builder.WriteString("<img" + attributeString.String() + "/>")
+		return
+	}
+	if node.DataAtom == atom.Br {
+		builder.WriteString("<br/>")
+		return
+	}
+	builder.WriteString("<" + node.Data + attributeString.String() + ">")
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeSanitizedNode(builder, child, base)
+	}
+	builder.WriteString("</" + node.Data + ">")
+}
+
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package unit
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type ICalendarEvent struct {
+	UID         string
+	Summary     string
+	Location    string
+	Description string
+	Start       time.Time
+	End         time.Time
+}
+
+// BuildICalendar 按 RFC 5545 生成 VCALENDAR 文本
+func BuildICalendar(name string, events []ICalendarEvent) string {
+	// DTSTAMP 取当日零点，使同一天内相同课表生成的内容一致，便于客户端缓存
+	now := time.Now()
+	stamp := formatICalendarTime(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local))
+	var lines []string
+	lines = append(lines,
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//SCITEduTool//API//CN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:"+escapeICalendarText(name),
+		"X-WR-TIMEZONE:"+time.Local.String(),
+	)
+	for _, event := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+event.UID,
+			"DTSTAMP:"+stamp,
+			"DTSTART:"+formatICalendarTime(event.Start),
+			"DTEND:"+formatICalendarTime(event.End),
+			"SUMMARY:"+escapeICalendarText(event.Summary),
+		)
+		if event.Location != "" {
+			lines = append(lines, "LOCATION:"+escapeICalendarText(event.Location))
+		}
+		if event.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+escapeICalendarText(event.Description))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	builder := strings.Builder{}
+	for _, line := range lines {
+		builder.WriteString(foldICalendarLine(line))
+		builder.WriteString("\r\n")
+	}
+	return builder.String()
+}
+
+func formatICalendarTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func escapeICalendarText(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\\\")
+	text = strings.ReplaceAll(text, ";", "\\;")
+	text = strings.ReplaceAll(text, ",", "\\,")
+	text = strings.ReplaceAll(text, "\r\n", "\\n")
+	text = strings.ReplaceAll(text, "\n", "\\n")
+	return text
+}
+
+// foldICalendarLine 将超过 75 字节的内容行折叠，且不拆分 UTF-8 字符
+func foldICalendarLine(line string) string {
+	if len(line) <= 75 {
+		return line
+	}
+	builder := strings.Builder{}
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		builder.WriteString(line[:cut])
+		builder.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74
+	}
+	builder.WriteString(line)
+	return builder.String()
+}
@@ -0,0 +1,83 @@
+package unit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// JWTHeader JWT 头部，仅支持 HS256，Kid 为签名密钥 ID
+type JWTHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+var ErrJWTMalformed = errors.New("JWT 格式错误")
+var ErrJWTUnknownKey = errors.New("JWT 签名密钥不存在")
+var ErrJWTSignature = errors.New("JWT 签名无效")
+
+// SignJWT 使用 HS256 签发 JWT，claims 序列化为载荷
+func SignJWT(kid string, secret []byte, claims interface{}) (string, error) {
+	header, err := json.Marshal(JWTHeader{
+		Alg: "HS256",
+		Typ: "JWT",
+		Kid: kid,
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signJWT(signingInput, secret)), nil
+}
+
+// ParseJWT 校验 JWT 签名并将载荷解析至 claims，secretOf 按 kid 返回密钥，密钥不存在时返回 nil。
+// 仅校验签名，过期时间等声明由调用方校验
+func ParseJWT(token string, secretOf func(kid string) []byte, claims interface{}) (JWTHeader, error) {
+	header := JWTHeader{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return header, ErrJWTMalformed
+	}
+	headerContent, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header, ErrJWTMalformed
+	}
+	err = json.Unmarshal(headerContent, &header)
+	if err != nil || header.Alg != "HS256" {
+		return header, ErrJWTMalformed
+	}
+	secret := secretOf(header.Kid)
+	if secret == nil {
+		return header, ErrJWTUnknownKey
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return header, ErrJWTMalformed
+	}
+	if !hmac.Equal(signature, signJWT(parts[0]+"."+parts[1], secret)) {
+		return header, ErrJWTSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return header, ErrJWTMalformed
+	}
+	if json.Unmarshal(payload, claims) != nil {
+		return header, ErrJWTMalformed
+	}
+	return header, nil
+}
+
+func signJWT(signingInput string, secret []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(signingInput))
+	return h.Sum(nil)
+}
@@ -0,0 +1,250 @@
+package unit
+
+import (
+	"SCITEduTool/Application/stdio"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type migrationUnit interface {
+	Status() ([]MigrationStatus, stdio.MessagedError)
+	Up(target int, dryRun bool) ([]MigrationStep, stdio.MessagedError)
+	Down(count int, dryRun bool) ([]MigrationStep, stdio.MessagedError)
+}
+
+type migrationUnitImpl struct{}
+
+var MigrationUnit migrationUnit = migrationUnitImpl{}
+
+// Migration 数据库结构版本，Up 与 Down 以 SqlDialect.Name() 为键，Down 为空的版本不可回滚
+type Migration struct {
+	Version int
+	Name    string
+	Up      map[string][]string
+	Down    map[string][]string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt int64
+	// Unknown 数据库中已应用但当前程序中不存在的版本
+	Unknown bool
+}
+
+type MigrationStep struct {
+	Version    int
+	Name       string
+	Up         bool
+	Statements []string
+}
+
+func (migrationStep MigrationStep) Title() string {
+	return fmt.Sprintf("%04d_%s", migrationStep.Version, migrationStep.Name)
+}
+
+func (migrationUnitImpl migrationUnitImpl) Status() ([]MigrationStatus, stdio.MessagedError) {
+	applied, errMessage := getAppliedMigrations(false)
+	if errMessage.HasInfo {
+		return nil, errMessage
+	}
+	var status []MigrationStatus
+	for _, migration := range migrations {
+		appliedAt, exist := applied[migration.Version]
+		status = append(status, MigrationStatus{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   exist,
+			AppliedAt: appliedAt,
+		})
+		delete(applied, migration.Version)
+	}
+	for version, appliedAt := range applied {
+		status = append(status, MigrationStatus{
+			Version:   version,
+			Applied:   true,
+			AppliedAt: appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, stdio.GetEmptyErrorMessage()
+}
+
+// Up 依次应用未应用的迁移，target 为 0 时应用至最新版本；dryRun 时仅返回将要执行的语句
+func (migrationUnitImpl migrationUnitImpl) Up(target int, dryRun bool) ([]MigrationStep, stdio.MessagedError) {
+	applied, errMessage := getAppliedMigrations(!dryRun)
+	if errMessage.HasInfo {
+		return nil, errMessage
+	}
+	var steps []MigrationStep
+	for _, migration := range migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, exist := applied[migration.Version]; exist {
+			continue
+		}
+		statements, exist := migration.Up[Dialect.Name()]
+		if !exist {
+			stdio.LogError("", fmt.Sprintf("数据库迁移 %04d 缺少 %s 语句", migration.Version, Dialect.Name()), nil)
+			return steps, stdio.GetErrorMessage(-500, "数据库迁移失败")
+		}
+		step := MigrationStep{
+			Version:    migration.Version,
+			Name:       migration.Name,
+			Up:         true,
+			Statements: statements,
+		}
+		if !dryRun {
+			errMessage = runMigrationStep(step)
+			if errMessage.HasInfo {
+				return steps, errMessage
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, stdio.GetEmptyErrorMessage()
+}
+
+// Down 按版本倒序回滚最近应用的 count 个迁移，其中存在不可回滚的版本时不执行任何回滚
+func (migrationUnitImpl migrationUnitImpl) Down(count int, dryRun bool) ([]MigrationStep, stdio.MessagedError) {
+	if count < 1 {
+		stdio.LogError("", fmt.Sprintf("回滚数量需不小于 1：%d", count), nil)
+		return nil, stdio.GetErrorMessage(-500, "数据库迁移失败")
+	}
+	applied, errMessage := getAppliedMigrations(false)
+	if errMessage.HasInfo {
+		return nil, errMessage
+	}
+	var versions []int
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if count < len(versions) {
+		versions = versions[:count]
+	}
+	var steps []MigrationStep
+	for _, version := range versions {
+		var migration *Migration
+		for index := range migrations {
+			if migrations[index].Version == version {
+				migration = &migrations[index]
+				break
+			}
+		}
+		if migration == nil {
+			stdio.LogError("", fmt.Sprintf("数据库迁移 %04d 不存在，无法回滚", version), nil)
+			return nil, stdio.GetErrorMessage(-500, "数据库迁移失败")
+		}
+		if len(migration.Down) == 0 {
+			stdio.LogError("", fmt.Sprintf("数据库迁移 %04d 不可回滚", version), nil)
+			return nil, stdio.GetErrorMessage(-500, "数据库迁移失败")
+		}
+		statements, exist := migration.Down[Dialect.Name()]
+		if !exist {
+			stdio.LogError("", fmt.Sprintf("数据库迁移 %04d 缺少 %s 回滚语句", version, Dialect.Name()), nil)
+			return nil, stdio.GetErrorMessage(-500, "数据库迁移失败")
+		}
+		steps = append(steps, MigrationStep{
+			Version:    migration.Version,
+			Name:       migration.Name,
+			Statements: statements,
+		})
+	}
+	if dryRun {
+		return steps, stdio.GetEmptyErrorMessage()
+	}
+	for index, step := range steps {
+		errMessage = runMigrationStep(step)
+		if errMessage.HasInfo {
+			return steps[:index], errMessage
+		}
+	}
+	return steps, stdio.GetEmptyErrorMessage()
+}
+
+// getAppliedMigrations 返回已应用的版本及应用时间，create 为 false 且版本表不存在时视为未应用任何版本
+func getAppliedMigrations(create bool) (map[int]int64, stdio.MessagedError) {
+	applied := make(map[int]int64)
+	if create {
+		_, err := DB.Exec("create table if not exists `schema_migrations` (" +
+			"`version` int NOT NULL PRIMARY KEY, `name` varchar(255) NOT NULL, `applied_at` int NOT NULL)")
+		if err != nil {
+			stdio.LogError("", "数据库版本表创建失败", err)
+			return nil, stdio.GetErrorMessage(-500, "数据库迁移失败")
+		}
+	} else {
+		count := 0
+		err := DB.QueryRow(Dialect.TableExistsQuery(), "schema_migrations").Scan(&count)
+		if err != nil {
+			stdio.LogError("", "数据库SQL指令执行失败", err)
+			return nil, stdio.GetErrorMessage(-500, "数据库迁移失败")
+		}
+		if count == 0 {
+			return applied, stdio.GetEmptyErrorMessage()
+		}
+	}
+	rows, err := DB.Query("select `version`,`applied_at` from `schema_migrations`")
+	if err != nil {
+		stdio.LogError("", "数据库SQL指令执行失败", err)
+		return nil, stdio.GetErrorMessage(-500, "数据库迁移失败")
+	}
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			_ = rows.Close()
+			stdio.LogError("", "数据库SQL指令执行失败", err)
+			return nil, stdio.GetErrorMessage(-500, "数据库迁移失败")
+		}
+		applied[version] = appliedAt
+	}
+	_ = rows.Close()
+	return applied, stdio.GetEmptyErrorMessage()
+}
+
+// runMigrationStep 在同一事务中执行迁移语句并更新版本表，MySQL 的 DDL 会隐式提交，失败时需人工检查
+func runMigrationStep(step MigrationStep) stdio.MessagedError {
+	tx, err := DB.Begin()
+	if err != nil {
+		stdio.LogError("", "数据库开始事务失败", err)
+		return stdio.GetErrorMessage(-500, "数据库迁移失败")
+	}
+	for _, statement := range step.Statements {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			_ = tx.Rollback()
+			stdio.LogError("", "数据库迁移 "+step.Title()+" 执行失败", err)
+			return stdio.GetErrorMessage(-500, "数据库迁移失败")
+		}
+	}
+	if step.Up {
+		_, err = tx.Exec("insert into `schema_migrations` (`version`, `name`, `applied_at`) values (?, ?, ?)",
+			step.Version, step.Name, time.Now().Unix())
+	} else {
+		_, err = tx.Exec("delete from `schema_migrations` where `version`=?", step.Version)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		stdio.LogError("", "数据库版本表更新失败", err)
+		return stdio.GetErrorMessage(-500, "数据库迁移失败")
+	}
+	err = tx.Commit()
+	if err != nil {
+		stdio.LogError("", "数据库迁移 "+step.Title()+" 提交失败", err)
+		return stdio.GetErrorMessage(-500, "数据库迁移失败")
+	}
+	if step.Up {
+		stdio.LogInfo("", "数据库迁移已应用："+step.Title())
+	} else {
+		stdio.LogInfo("", "数据库迁移已回滚："+step.Title())
+	}
+	return stdio.GetEmptyErrorMessage()
+}
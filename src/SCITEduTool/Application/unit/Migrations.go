@@ -0,0 +1,430 @@
+package unit
+
+// migrations 按版本号升序排列，已发布的迁移不可修改，结构变更需追加新版本。
+// Up 与 Down 以 SqlDialect.Name() 为键
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up: map[string][]string{
+			"mysql": {
+				"CREATE TABLE IF NOT EXISTS `achieve_update` (" +
+					"`a_id` int(11) NOT NULL AUTO_INCREMENT," +
+					"`u_id` varchar(20) NOT NULL," +
+					"`a_school_year` varchar(10) NOT NULL," +
+					"`a_semester` tinyint(4) NOT NULL," +
+					"`a_name` varchar(255) NOT NULL," +
+					"`a_mark` varchar(20) NOT NULL," +
+					"`a_credit` varchar(10) NOT NULL," +
+					"`a_create_time` int(11) NOT NULL," +
+					"PRIMARY KEY (`a_id`) USING BTREE," +
+					"INDEX `achieve_update`(`u_id`, `a_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `class_chart` (" +
+					"`f_id` smallint(6) NOT NULL," +
+					"`s_id` smallint(6) NOT NULL," +
+					"`c_id` tinyint(4) NOT NULL," +
+					"`c_name` varchar(30) NOT NULL," +
+					"UNIQUE INDEX `class_chart`(`c_name`, `f_id`, `s_id`, `c_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `class_schedule` (" +
+					"`t_id` varchar(30) NOT NULL," +
+					"`t_faculty` smallint(6) NOT NULL," +
+					"`t_specialty` smallint(6) NOT NULL," +
+					"`t_class` tinyint(4) NOT NULL," +
+					"`t_grade` smallint(6) NOT NULL," +
+					"`t_school_year` varchar(10) NOT NULL," +
+					"`t_semester` tinyint(4) NOT NULL," +
+					"`t_content` text NOT NULL," +
+					"`t_expired` int(10) UNSIGNED NOT NULL," +
+					"UNIQUE INDEX `class_schedule`(`t_id`, `t_faculty`, `t_specialty`, `t_class`, `t_grade`, `t_school_year`, `t_semester`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `exam_change` (" +
+					"`c_id` int(11) NOT NULL AUTO_INCREMENT," +
+					"`u_id` varchar(20) NOT NULL," +
+					"`e_school_year` varchar(10) NOT NULL," +
+					"`e_semester` tinyint(4) NOT NULL," +
+					"`e_name` varchar(255) NOT NULL," +
+					"`c_previous_time` varchar(255) NOT NULL," +
+					"`c_previous_location` varchar(255) NOT NULL," +
+					"`c_time` varchar(255) NOT NULL," +
+					"`c_location` varchar(255) NOT NULL," +
+					"`c_create_time` int(11) NOT NULL," +
+					"PRIMARY KEY (`c_id`) USING BTREE," +
+					"INDEX `exam_change`(`u_id`, `e_school_year`, `e_semester`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `exam_schedule` (" +
+					"`u_id` varchar(20) NOT NULL," +
+					"`e_school_year` varchar(10) NOT NULL," +
+					"`e_semester` tinyint(4) NOT NULL," +
+					"`e_content` text NOT NULL," +
+					"`e_expired` int(10) UNSIGNED NOT NULL," +
+					"PRIMARY KEY (`u_id`, `e_school_year`, `e_semester`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `faculty_chart` (" +
+					"`f_id` smallint(6) NOT NULL," +
+					"`f_name` varchar(30) NOT NULL," +
+					"UNIQUE INDEX `faculty_chart`(`f_id`, `f_name`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `hitokoto` (" +
+					"`h_id` int(11) NOT NULL AUTO_INCREMENT," +
+					"`h_index` int(255) NOT NULL DEFAULT 0," +
+					"`h_content` text NOT NULL," +
+					"`h_type` text NOT NULL," +
+					"`h_from` text NOT NULL," +
+					"`h_from_who` text NOT NULL," +
+					"`h_creator` text NOT NULL," +
+					"`h_creator_uid` int(11) NOT NULL DEFAULT 0," +
+					"`h_reviewer` int(11) NOT NULL," +
+					"`h_insert_at` int(11) NOT NULL," +
+					"`h_length` int(11) NOT NULL," +
+					"PRIMARY KEY (`h_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `news` (" +
+					"`n_id` int(11) NOT NULL," +
+					"`n_type_id` int(11) NOT NULL," +
+					"`n_title` varchar(255) NOT NULL," +
+					"`n_summary` varchar(255) NOT NULL," +
+					"`n_images` text NOT NULL," +
+					"`n_create_time` varchar(20) NOT NULL DEFAULT ''," +
+					"PRIMARY KEY (`n_id`) USING BTREE," +
+					"UNIQUE INDEX `news`(`n_id`, `n_type_id`, `n_create_time`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `news_chart` (" +
+					"`n_type_id` int(11) NOT NULL," +
+					"`n_name` varchar(20) NOT NULL," +
+					"`n_out` tinyint(1) NOT NULL DEFAULT 1," +
+					"PRIMARY KEY (`n_type_id`) USING BTREE," +
+					"UNIQUE INDEX `news_chart`(`n_type_id`, `n_name`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `news_content` (" +
+					"`n_id` int(11) NOT NULL," +
+					"`n_type_id` int(11) NOT NULL," +
+					"`n_content` mediumtext NOT NULL," +
+					"`n_extra` text NOT NULL," +
+					"`n_expired` int(11) NOT NULL," +
+					"PRIMARY KEY (`n_id`, `n_type_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `news_headline` (" +
+					"`h_id` int(11) NOT NULL," +
+					"`h_type_id` int(11) NOT NULL," +
+					"`h_image` varchar(255) NOT NULL," +
+					"`h_expired` int(11) NOT NULL," +
+					"PRIMARY KEY (`h_id`) USING BTREE," +
+					"UNIQUE INDEX `news_headline`(`h_id`, `h_type_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `sign_keys` (" +
+					"`app_key` tinytext NOT NULL," +
+					"`app_secret` tinytext NOT NULL," +
+					"`platform` tinytext NOT NULL," +
+					"`mail` tinytext NOT NULL," +
+					"`build` int(10) NOT NULL," +
+					"`available` tinyint(1) NULL DEFAULT 1" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `specialty_chart` (" +
+					"`s_id` smallint(6) NOT NULL," +
+					"`s_name` varchar(30) NOT NULL," +
+					"`f_id` smallint(6) NOT NULL," +
+					"INDEX `specialty_chart`(`s_name`, `s_id`, `f_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `student_achieve` (" +
+					"`u_id` varchar(20) NOT NULL," +
+					"`u_faculty` smallint(6) NOT NULL," +
+					"`u_specialty` smallint(6) NOT NULL," +
+					"`u_class` tinyint(4) NOT NULL," +
+					"`u_grade` smallint(6) NOT NULL," +
+					"`a_content_01` text NULL," +
+					"`a_content_02` text NULL," +
+					"`a_content_03` text NULL," +
+					"`a_content_04` text NULL," +
+					"`a_content_05` text NULL," +
+					"`a_content_06` text NULL," +
+					"`a_content_07` text NULL," +
+					"`a_content_08` text NULL," +
+					"`a_content_09` text NULL," +
+					"`a_content_10` text NULL," +
+					"`a_content_11` text NULL," +
+					"`a_content_12` text NULL," +
+					"PRIMARY KEY (`u_id`) USING BTREE," +
+					"INDEX `student_achieve`(`u_id`, `u_faculty`, `u_specialty`, `u_class`, `u_grade`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `teacher_schedule` (" +
+					"`t_teacher` varchar(20) NOT NULL," +
+					"`t_school_year` varchar(10) NOT NULL," +
+					"`t_semester` tinyint(4) NOT NULL," +
+					"`t_content` text NOT NULL," +
+					"`t_expired` int(10) UNSIGNED NOT NULL," +
+					"PRIMARY KEY (`t_teacher`, `t_school_year`, `t_semester`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `user_info` (" +
+					"`u_id` varchar(20) NOT NULL," +
+					"`u_name` tinytext NULL," +
+					"`u_identify` tinyint(2) NOT NULL DEFAULT 0," +
+					"`u_level` tinyint(2) NOT NULL DEFAULT 0," +
+					"`u_faculty` smallint(6) NOT NULL DEFAULT 0," +
+					"`u_specialty` smallint(6) NOT NULL DEFAULT 0," +
+					"`u_class` tinyint(4) NOT NULL DEFAULT 0," +
+					"`u_grade` smallint(6) NOT NULL DEFAULT 0," +
+					"`u_info_expired` int(11) NOT NULL DEFAULT 0," +
+					"PRIMARY KEY (`u_id`) USING BTREE," +
+					"UNIQUE INDEX `user_info`(`u_id`, `u_identify`, `u_faculty`, `u_specialty`, `u_class`, `u_grade`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `user_subscription` (" +
+					"`u_id` varchar(20) NOT NULL," +
+					"`s_version` int(11) NOT NULL DEFAULT 0," +
+					"PRIMARY KEY (`u_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+				"CREATE TABLE IF NOT EXISTS `user_token` (" +
+					"`u_id` varchar(20) NOT NULL," +
+					"`u_password` varchar(600) NOT NULL DEFAULT ''," +
+					"`u_session` varchar(30) NOT NULL DEFAULT ''," +
+					"`u_session_expired` int(11) NOT NULL," +
+					"`u_token_effective` tinyint(1) NOT NULL," +
+					"PRIMARY KEY (`u_id`) USING BTREE," +
+					"UNIQUE INDEX `user_token`(`u_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+			},
+			"sqlite": {
+				"CREATE TABLE IF NOT EXISTS `achieve_update` (" +
+					"`a_id` INTEGER PRIMARY KEY AUTOINCREMENT," +
+					"`u_id` varchar(20) NOT NULL," +
+					"`a_school_year` varchar(10) NOT NULL," +
+					"`a_semester` tinyint NOT NULL," +
+					"`a_name` varchar(255) NOT NULL," +
+					"`a_mark` varchar(20) NOT NULL," +
+					"`a_credit` varchar(10) NOT NULL," +
+					"`a_create_time` int NOT NULL)",
+				"CREATE INDEX IF NOT EXISTS `idx_achieve_update` ON `achieve_update` (`u_id`, `a_id`)",
+				"CREATE TABLE IF NOT EXISTS `class_chart` (" +
+					"`f_id` smallint NOT NULL," +
+					"`s_id` smallint NOT NULL," +
+					"`c_id` tinyint NOT NULL," +
+					"`c_name` varchar(30) NOT NULL)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_class_chart` ON `class_chart` (`c_name`, `f_id`, `s_id`, `c_id`)",
+				"CREATE TABLE IF NOT EXISTS `class_schedule` (" +
+					"`t_id` varchar(30) NOT NULL," +
+					"`t_faculty` smallint NOT NULL," +
+					"`t_specialty` smallint NOT NULL," +
+					"`t_class` tinyint NOT NULL," +
+					"`t_grade` smallint NOT NULL," +
+					"`t_school_year` varchar(10) NOT NULL," +
+					"`t_semester` tinyint NOT NULL," +
+					"`t_content` text NOT NULL," +
+					"`t_expired` int NOT NULL)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_class_schedule` ON `class_schedule` (`t_id`, `t_faculty`, `t_specialty`, `t_class`, `t_grade`, `t_school_year`, `t_semester`)",
+				"CREATE TABLE IF NOT EXISTS `exam_change` (" +
+					"`c_id` INTEGER PRIMARY KEY AUTOINCREMENT," +
+					"`u_id` varchar(20) NOT NULL," +
+					"`e_school_year` varchar(10) NOT NULL," +
+					"`e_semester` tinyint NOT NULL," +
+					"`e_name` varchar(255) NOT NULL," +
+					"`c_previous_time` varchar(255) NOT NULL," +
+					"`c_previous_location` varchar(255) NOT NULL," +
+					"`c_time` varchar(255) NOT NULL," +
+					"`c_location` varchar(255) NOT NULL," +
+					"`c_create_time` int NOT NULL)",
+				"CREATE INDEX IF NOT EXISTS `idx_exam_change` ON `exam_change` (`u_id`, `e_school_year`, `e_semester`)",
+				"CREATE TABLE IF NOT EXISTS `exam_schedule` (" +
+					"`u_id` varchar(20) NOT NULL," +
+					"`e_school_year` varchar(10) NOT NULL," +
+					"`e_semester` tinyint NOT NULL," +
+					"`e_content` text NOT NULL," +
+					"`e_expired` int NOT NULL," +
+					"PRIMARY KEY (`u_id`, `e_school_year`, `e_semester`))",
+				"CREATE TABLE IF NOT EXISTS `faculty_chart` (" +
+					"`f_id` smallint NOT NULL," +
+					"`f_name` varchar(30) NOT NULL)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_faculty_chart` ON `faculty_chart` (`f_id`, `f_name`)",
+				"CREATE TABLE IF NOT EXISTS `hitokoto` (" +
+					"`h_id` INTEGER PRIMARY KEY AUTOINCREMENT," +
+					"`h_index` int NOT NULL DEFAULT 0," +
+					"`h_content` text NOT NULL," +
+					"`h_type` text NOT NULL," +
+					"`h_from` text NOT NULL," +
+					"`h_from_who` text NOT NULL," +
+					"`h_creator` text NOT NULL," +
+					"`h_creator_uid` int NOT NULL DEFAULT 0," +
+					"`h_reviewer` int NOT NULL," +
+					"`h_insert_at` int NOT NULL," +
+					"`h_length` int NOT NULL)",
+				"CREATE TABLE IF NOT EXISTS `news` (" +
+					"`n_id` int NOT NULL PRIMARY KEY," +
+					"`n_type_id` int NOT NULL," +
+					"`n_title` varchar(255) NOT NULL," +
+					"`n_summary` varchar(255) NOT NULL," +
+					"`n_images` text NOT NULL," +
+					"`n_create_time` varchar(20) NOT NULL DEFAULT '')",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_news` ON `news` (`n_id`, `n_type_id`, `n_create_time`)",
+				"CREATE TABLE IF NOT EXISTS `news_chart` (" +
+					"`n_type_id` int NOT NULL PRIMARY KEY," +
+					"`n_name` varchar(20) NOT NULL," +
+					"`n_out` tinyint NOT NULL DEFAULT 1)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_news_chart` ON `news_chart` (`n_type_id`, `n_name`)",
+				"CREATE TABLE IF NOT EXISTS `news_content` (" +
+					"`n_id` int NOT NULL," +
+					"`n_type_id` int NOT NULL," +
+					"`n_content` text NOT NULL," +
+					"`n_extra` text NOT NULL," +
+					"`n_expired` int NOT NULL," +
+					"PRIMARY KEY (`n_id`, `n_type_id`))",
+				"CREATE TABLE IF NOT EXISTS `news_headline` (" +
+					"`h_id` int NOT NULL PRIMARY KEY," +
+					"`h_type_id` int NOT NULL," +
+					"`h_image` varchar(255) NOT NULL," +
+					"`h_expired` int NOT NULL)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_news_headline` ON `news_headline` (`h_id`, `h_type_id`)",
+				"CREATE TABLE IF NOT EXISTS `sign_keys` (" +
+					"`app_key` text NOT NULL," +
+					"`app_secret` text NOT NULL," +
+					"`platform` text NOT NULL," +
+					"`mail` text NOT NULL," +
+					"`build` int NOT NULL," +
+					"`available` tinyint NULL DEFAULT 1)",
+				"CREATE TABLE IF NOT EXISTS `specialty_chart` (" +
+					"`s_id` smallint NOT NULL," +
+					"`s_name` varchar(30) NOT NULL," +
+					"`f_id` smallint NOT NULL)",
+				"CREATE INDEX IF NOT EXISTS `idx_specialty_chart` ON `specialty_chart` (`s_name`, `s_id`, `f_id`)",
+				"CREATE TABLE IF NOT EXISTS `student_achieve` (" +
+					"`u_id` varchar(20) NOT NULL PRIMARY KEY," +
+					"`u_faculty` smallint NOT NULL," +
+					"`u_specialty` smallint NOT NULL," +
+					"`u_class` tinyint NOT NULL," +
+					"`u_grade` smallint NOT NULL," +
+					"`a_content_01` text NULL," +
+					"`a_content_02` text NULL," +
+					"`a_content_03` text NULL," +
+					"`a_content_04` text NULL," +
+					"`a_content_05` text NULL," +
+					"`a_content_06` text NULL," +
+					"`a_content_07` text NULL," +
+					"`a_content_08` text NULL," +
+					"`a_content_09` text NULL," +
+					"`a_content_10` text NULL," +
+					"`a_content_11` text NULL," +
+					"`a_content_12` text NULL)",
+				"CREATE INDEX IF NOT EXISTS `idx_student_achieve` ON `student_achieve` (`u_id`, `u_faculty`, `u_specialty`, `u_class`, `u_grade`)",
+				"CREATE TABLE IF NOT EXISTS `teacher_schedule` (" +
+					"`t_teacher` varchar(20) NOT NULL," +
+					"`t_school_year` varchar(10) NOT NULL," +
+					"`t_semester` tinyint NOT NULL," +
+					"`t_content` text NOT NULL," +
+					"`t_expired` int NOT NULL," +
+					"PRIMARY KEY (`t_teacher`, `t_school_year`, `t_semester`))",
+				"CREATE TABLE IF NOT EXISTS `user_info` (" +
+					"`u_id` varchar(20) NOT NULL PRIMARY KEY," +
+					"`u_name` text NULL," +
+					"`u_identify` tinyint NOT NULL DEFAULT 0," +
+					"`u_level` tinyint NOT NULL DEFAULT 0," +
+					"`u_faculty` smallint NOT NULL DEFAULT 0," +
+					"`u_specialty` smallint NOT NULL DEFAULT 0," +
+					"`u_class` tinyint NOT NULL DEFAULT 0," +
+					"`u_grade` smallint NOT NULL DEFAULT 0," +
+					"`u_info_expired` int NOT NULL DEFAULT 0)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_user_info` ON `user_info` (`u_id`, `u_identify`, `u_faculty`, `u_specialty`, `u_class`, `u_grade`)",
+				"CREATE TABLE IF NOT EXISTS `user_subscription` (" +
+					"`u_id` varchar(20) NOT NULL PRIMARY KEY," +
+					"`s_version` int NOT NULL DEFAULT 0)",
+				"CREATE TABLE IF NOT EXISTS `user_token` (" +
+					"`u_id` varchar(20) NOT NULL PRIMARY KEY," +
+					"`u_password` varchar(600) NOT NULL DEFAULT ''," +
+					"`u_session` varchar(30) NOT NULL DEFAULT ''," +
+					"`u_session_expired` int NOT NULL," +
+					"`u_token_effective` tinyint NOT NULL)",
+			},
+		},
+		// 基线版本包含全部业务数据，不可回滚
+	},
+	{
+		Version: 2,
+		Name:    "user_device_sessions",
+		Up: map[string][]string{
+			"mysql": {
+				"CREATE TABLE IF NOT EXISTS `user_device_sessions` (" +
+					"`s_id` varchar(32) NOT NULL," +
+					"`u_id` varchar(20) NOT NULL," +
+					"`s_refresh_id` varchar(32) NOT NULL," +
+					"`s_device` varchar(100) NOT NULL DEFAULT ''," +
+					"`s_platform` varchar(20) NOT NULL DEFAULT ''," +
+					"`s_ip` varchar(45) NOT NULL DEFAULT ''," +
+					"`s_create_time` int(11) NOT NULL," +
+					"`s_last_used` int(11) NOT NULL," +
+					"`s_expired` int(11) NOT NULL," +
+					"`s_revoked` tinyint(1) NOT NULL DEFAULT 0," +
+					"PRIMARY KEY (`s_id`) USING BTREE," +
+					"INDEX `user_device_sessions`(`u_id`, `s_revoked`) USING BTREE," +
+					"INDEX `user_device_sessions_revoked`(`s_revoked`, `s_expired`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+			},
+			"sqlite": {
+				"CREATE TABLE IF NOT EXISTS `user_device_sessions` (" +
+					"`s_id` varchar(32) NOT NULL PRIMARY KEY," +
+					"`u_id` varchar(20) NOT NULL," +
+					"`s_refresh_id` varchar(32) NOT NULL," +
+					"`s_device` varchar(100) NOT NULL DEFAULT ''," +
+					"`s_platform` varchar(20) NOT NULL DEFAULT ''," +
+					"`s_ip` varchar(45) NOT NULL DEFAULT ''," +
+					"`s_create_time` int NOT NULL," +
+					"`s_last_used` int NOT NULL," +
+					"`s_expired` int NOT NULL," +
+					"`s_revoked` tinyint NOT NULL DEFAULT 0)",
+				"CREATE INDEX IF NOT EXISTS `idx_user_device_sessions` ON `user_device_sessions` (`u_id`, `s_revoked`)",
+				"CREATE INDEX IF NOT EXISTS `idx_user_device_sessions_revoked` ON `user_device_sessions` (`s_revoked`, `s_expired`)",
+			},
+		},
+		Down: map[string][]string{
+			"mysql":  {"DROP TABLE IF EXISTS `user_device_sessions`"},
+			"sqlite": {"DROP TABLE IF EXISTS `user_device_sessions`"},
+		},
+	},
+	{
+		Version: 3,
+		Name:    "user_retired_tokens",
+		Up: map[string][]string{
+			"mysql": {
+				"CREATE TABLE IF NOT EXISTS `user_retired_tokens` (" +
+					"`t_id` varchar(64) NOT NULL," +
+					"`u_id` varchar(20) NOT NULL," +
+					"`s_id` varchar(32) NOT NULL," +
+					"`t_expired` int(11) NOT NULL," +
+					"PRIMARY KEY (`t_id`) USING BTREE" +
+					") ENGINE = InnoDB CHARACTER SET = utf8 COLLATE = utf8_general_ci ROW_FORMAT = Compact",
+			},
+			"sqlite": {
+				"CREATE TABLE IF NOT EXISTS `user_retired_tokens` (" +
+					"`t_id` varchar(64) NOT NULL PRIMARY KEY," +
+					"`u_id` varchar(20) NOT NULL," +
+					"`s_id` varchar(32) NOT NULL," +
+					"`t_expired` int NOT NULL)",
+			},
+		},
+		Down: map[string][]string{
+			"mysql":  {"DROP TABLE IF EXISTS `user_retired_tokens`"},
+			"sqlite": {"DROP TABLE IF EXISTS `user_retired_tokens`"},
+		},
+	},
+	{
+		// 同一课程的新出成绩只记录一次，先清理已重复写入的记录，保留最早的一条
+		Version: 4,
+		Name:    "achieve_update_unique",
+		Up: map[string][]string{
+			"mysql": {
+				"DELETE `a` FROM `achieve_update` `a` JOIN `achieve_update` `b` ON " +
+					"`a`.`u_id`=`b`.`u_id` AND `a`.`a_school_year`=`b`.`a_school_year` AND " +
+					"`a`.`a_semester`=`b`.`a_semester` AND `a`.`a_name`=`b`.`a_name` AND `a`.`a_id`>`b`.`a_id`",
+				"ALTER TABLE `achieve_update` ADD UNIQUE INDEX " +
+					"`achieve_update_course`(`u_id`, `a_school_year`, `a_semester`, `a_name`) USING BTREE",
+			},
+			"sqlite": {
+				"DELETE FROM `achieve_update` WHERE `a_id` NOT IN (SELECT MIN(`a_id`) FROM `achieve_update` " +
+					"GROUP BY `u_id`, `a_school_year`, `a_semester`, `a_name`)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_achieve_update_course` ON `achieve_update` " +
+					"(`u_id`, `a_school_year`, `a_semester`, `a_name`)",
+			},
+		},
+		Down: map[string][]string{
+			"mysql":  {"ALTER TABLE `achieve_update` DROP INDEX `achieve_update_course`"},
+			"sqlite": {"DROP INDEX IF EXISTS `idx_achieve_update_course`"},
+		},
+	},
+}
@@ -0,0 +1,77 @@
+package unit
+
+import (
+	"SCITEduTool/Application/stdio"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies 可信反向代理的地址段，仅来自这些地址的请求才读取 X-Forwarded-For 与 X-Real-IP
+var trustedProxies []*net.IPNet
+
+// InitTrustedProxies 读取 server.json 中的 trusted_proxies，支持单个 IP 与 CIDR，为空时不信任任何代理
+func InitTrustedProxies(proxies []string) {
+	trustedProxies = nil
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				stdio.LogWarn("", "可信代理地址格式不正确，已忽略："+proxy, nil)
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			trustedProxies = append(trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			stdio.LogWarn("", "可信代理地址格式不正确，已忽略："+proxy, nil)
+			continue
+		}
+		trustedProxies = append(trustedProxies, ipNet)
+	}
+}
+
+// ClientIP 返回请求的客户端 IP。直连地址为可信代理时，取 X-Forwarded-For 中自右向左第一个不可信的地址，
+// 其次为 X-Real-IP；否则直接使用直连地址，避免客户端伪造请求头
+func ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for index := len(forwarded) - 1; index >= 0; index-- {
+		ip := strings.TrimSpace(forwarded[index])
+		if net.ParseIP(ip) == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return remote
+}
+
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,60 +2,264 @@ package unit
 
 import (
 	"SCITEduTool/Application/stdio"
+	"crypto/ecdh"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
+	"errors"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 )
 
 type rsaStaticUnit interface {
-	DecodePublicEncode(data string) (string, stdio.MessagedError)
-	SetPrivateKey(keyConf PrivateKey)
+	DecodePublicEncode(cipherText CipherText) (string, stdio.MessagedError)
+	OpenEnvelope(cipherText CipherText, fresh bool) (Envelope, stdio.MessagedError)
+	GetPublicKey() (string, string)
+	GetExchangeKey() string
+	SetKeyring(keyConf KeyringConfig)
 }
 
 type rsaStaticUnitImpl struct{}
 
 var RSAStaticUnit rsaStaticUnit = rsaStaticUnitImpl{}
 
-var privateKey *rsa.PrivateKey
+// LegacyKid 旧版配置中 content 字段私钥的密钥 ID，未携带 kid 的客户端与密文均使用该密钥
+const LegacyKid = "default"
 
-type PrivateKey struct {
-	Content string `json:"content"`
+var privateKeys map[string]*rsa.PrivateKey
+var exchangeKeys map[string]*ecdh.PrivateKey
+var activeKeyId string
+var activePublicKey string
+
+var kidPattern = regexp.MustCompile("^[A-Za-z0-9_-]{1,32}$")
+
+// KeyringConfig RSA 密钥环配置，Keys 中 ActiveKid 对应的私钥用于下发公钥，其余私钥仅用于解密轮换前加密的数据。
+// Content 为旧版单一私钥，配置后以 LegacyKid 加入密钥环
+type KeyringConfig struct {
+	Content   string       `json:"content,omitempty"`
+	Keys      []RSAKeyItem `json:"keys"`
+	ActiveKid string       `json:"active_kid"`
+}
+
+// RSAKeyItem 密钥环中的私钥，Content 为经过 base64 编码的 PKCS#1 PEM 私钥，
+// ExchangeKey 为经过 base64 编码的 X25519 私钥，用于 x25519-aes-gcm 混合加密，为空时该密钥不支持混合加密
+type RSAKeyItem struct {
+	Kid         string `json:"kid"`
+	Content     string `json:"content"`
+	ExchangeKey string `json:"exchange_key,omitempty"`
+	CreateTime  int64  `json:"create_time"`
 }
 
-func (rsaStaticUnitImpl rsaStaticUnitImpl) DecodePublicEncode(data string) (string, stdio.MessagedError) {
-	dataBase64, err := base64.StdEncoding.DecodeString(data)
+// DecodePublicEncode 按加密方式使用 kid 对应的私钥解密经过 base64 编码的密文，kid 为空时使用 LegacyKid
+func (rsaStaticUnitImpl rsaStaticUnitImpl) DecodePublicEncode(cipherText CipherText) (string, stdio.MessagedError) {
+	kid := cipherText.Kid
+	if kid == "" {
+		kid = LegacyKid
+	}
+	key, exist := privateKeys[kid]
+	if !exist {
+		stdio.LogInfo("", "RSA密钥不存在："+kid)
+		return "", stdio.GetErrorMessage(-403, "密钥已失效，请重新获取")
+	}
+	dataBase64, err := base64.StdEncoding.DecodeString(cipherText.Data)
 	if err != nil {
 		stdio.LogError("", "数据不是base64数据", err)
 		return "", stdio.GetErrorMessage(-500, "请求处理出错")
 	}
-	dataDecrypted, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, dataBase64)
+	var dataDecrypted []byte
+	switch cipherText.Scheme {
+	case "", CipherPKCS1:
+		dataDecrypted, err = rsa.DecryptPKCS1v15(rand.Reader, key, dataBase64)
+	case CipherOAEP:
+		dataDecrypted, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, dataBase64, nil)
+	case CipherHybrid:
+		exchangeKey, exist := exchangeKeys[kid]
+		if !exist {
+			stdio.LogInfo("", "密钥不支持混合加密："+kid)
+			return "", stdio.GetErrorMessage(-403, "密钥已失效，请重新获取")
+		}
+		dataDecrypted, err = decryptHybrid(exchangeKey, dataBase64)
+	default:
+		stdio.LogInfo("", "不支持的加密方式："+cipherText.Scheme)
+		return "", stdio.GetErrorMessage(-403, "不支持的加密方式")
+	}
 	if err != nil {
-		stdio.LogError("", "数据不是RSA加密数据", err)
+		stdio.LogError("", "数据解密失败，加密方式："+cipherText.Scheme, err)
 		return "", stdio.GetErrorMessage(-500, "请求处理出错")
 	} else {
 		return string(dataDecrypted), stdio.GetEmptyErrorMessage()
 	}
 }
 
-func (rsaStaticUnitImpl rsaStaticUnitImpl) SetPrivateKey(keyConf PrivateKey) {
-	if keyConf.Content == "" || strings.Contains(keyConf.Content, "//") {
-		stdio.LogAssert("", "私钥数据为空或格式错误", nil)
+// OpenEnvelope 解密密文并解析明文信封，客户端刚提交的密文应传入 fresh 校验时间戳与 nonce，
+// 解密已保存的密文时不校验时效；编码后超出 maxCipherTextLength 的密文无法保存，直接拒绝
+func (rsaStaticUnitImpl rsaStaticUnitImpl) OpenEnvelope(cipherText CipherText, fresh bool) (Envelope, stdio.MessagedError) {
+	if len(cipherText.String()) > maxCipherTextLength {
+		stdio.LogInfo("", "密文长度超出限制")
+		return Envelope{}, stdio.GetErrorMessage(-401, "密码校验失败")
+	}
+	plain, errMessage := RSAStaticUnit.DecodePublicEncode(cipherText)
+	if errMessage.HasInfo {
+		return Envelope{}, errMessage
+	}
+	scheme := cipherText.Scheme
+	if scheme == "" {
+		scheme = CipherPKCS1
+	}
+	envelope, err := parseEnvelope(scheme, []byte(plain), fresh)
+	switch err {
+	case nil:
+		return envelope, stdio.GetEmptyErrorMessage()
+	case ErrEnvelopeExpired:
+		stdio.LogInfo("", "密文信封已过期")
+		return Envelope{}, stdio.GetErrorMessage(-408, "请求超时")
+	case ErrEnvelopeReplayed:
+		stdio.LogWarn("", "密文信封nonce重复使用", nil)
+		return Envelope{}, stdio.GetErrorMessage(-403, "请求错误")
+	default:
+		stdio.LogInfo("", "密文信封格式错误")
+		return Envelope{}, stdio.GetErrorMessage(-401, "密码校验失败")
+	}
+}
+
+// GetPublicKey 返回当前启用的密钥 ID 与 PEM 格式公钥
+func (rsaStaticUnitImpl rsaStaticUnitImpl) GetPublicKey() (string, string) {
+	return activeKeyId, activePublicKey
+}
+
+// GetExchangeKey 返回当前启用密钥经过 base64 编码的 X25519 公钥，不支持混合加密时返回空字符串
+func (rsaStaticUnitImpl rsaStaticUnitImpl) GetExchangeKey() string {
+	exchangeKey, exist := exchangeKeys[activeKeyId]
+	if !exist {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(exchangeKey.PublicKey().Bytes())
+}
+
+func (rsaStaticUnitImpl rsaStaticUnitImpl) SetKeyring(keyConf KeyringConfig) {
+	privateKeys = make(map[string]*rsa.PrivateKey)
+	exchangeKeys = make(map[string]*ecdh.PrivateKey)
+	if keyConf.Content != "" && !strings.Contains(keyConf.Content, "//") {
+		key, err := ParseRSAKey(keyConf.Content)
+		if err != nil {
+			stdio.LogAssert("", "私钥解析失败", err)
+			os.Exit(0)
+		}
+		privateKeys[LegacyKid] = key
+	}
+	for _, item := range keyConf.Keys {
+		if !kidPattern.MatchString(item.Kid) {
+			stdio.LogAssert("", "密钥ID为空或格式不正确："+item.Kid, nil)
+			os.Exit(0)
+		}
+		if _, exist := privateKeys[item.Kid]; exist {
+			stdio.LogAssert("", "密钥ID重复："+item.Kid, nil)
+			os.Exit(0)
+		}
+		key, err := ParseRSAKey(item.Content)
+		if err != nil {
+			stdio.LogAssert("", "私钥解析失败："+item.Kid, err)
+			os.Exit(0)
+		}
+		privateKeys[item.Kid] = key
+		if item.ExchangeKey == "" {
+			continue
+		}
+		exchangeKey, err := ParseExchangeKey(item.ExchangeKey)
+		if err != nil {
+			stdio.LogAssert("", "X25519私钥解析失败："+item.Kid, err)
+			os.Exit(0)
+		}
+		exchangeKeys[item.Kid] = exchangeKey
+	}
+	if len(privateKeys) == 0 {
+		stdio.LogAssert("", "私钥数据为空或格式错误，请使用 key generate 命令生成密钥", nil)
 		os.Exit(0)
 	}
-	key, err := base64.StdEncoding.DecodeString(keyConf.Content)
+	activeKeyId = keyConf.ActiveKid
+	if activeKeyId == "" {
+		activeKeyId = LegacyKid
+	}
+	key, exist := privateKeys[activeKeyId]
+	if !exist {
+		stdio.LogAssert("", "active_kid对应的私钥不存在", nil)
+		os.Exit(0)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
 	if err != nil {
-		stdio.LogAssert("", "私钥数据解密失败", err)
+		stdio.LogAssert("", "公钥生成失败", err)
 		os.Exit(0)
 	}
+	activePublicKey = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKey,
+	}))
+	if _, exist := exchangeKeys[activeKeyId]; !exist {
+		stdio.LogWarn("", "当前密钥未配置exchange_key，将不支持x25519-aes-gcm加密，可使用 key generate 生成新密钥", nil)
+	}
+	stdio.LogVerbose("", "RSA配置成功，当前密钥："+activeKeyId)
+}
+
+// ParseRSAKey 解析经过 base64 编码的 PKCS#1 PEM 私钥
+func ParseRSAKey(content string) (*rsa.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, err
+	}
 	block, _ := pem.Decode(key)
-	privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	if block == nil {
+		return nil, errors.New("私钥不是PEM格式")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// ParseExchangeKey 解析经过 base64 编码的 X25519 私钥
+func ParseExchangeKey(content string) (*ecdh.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(content)
 	if err != nil {
-		stdio.LogAssert("", "私钥解析失败", err)
-		os.Exit(0)
+		return nil, err
+	}
+	return ecdh.X25519().NewPrivateKey(key)
+}
+
+// GenerateRSAKey 生成新的 RSA 私钥及配套的 X25519 私钥，kid 为空时使用 RSA 公钥 SHA-256 摘要的前 8 字节
+func GenerateRSAKey(kid string, bits int) (RSAKeyItem, error) {
+	if bits != 2048 && bits != 3072 {
+		// 密文需保存于 user_token.u_password，长度受限
+		return RSAKeyItem{}, errors.New("仅支持 2048 或 3072 位密钥")
+	}
+	if kid != "" && !kidPattern.MatchString(kid) {
+		return RSAKeyItem{}, errors.New("密钥ID仅支持不超过32位的字母、数字、下划线与短横线")
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return RSAKeyItem{}, err
+	}
+	exchangeKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return RSAKeyItem{}, err
+	}
+	if kid == "" {
+		publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return RSAKeyItem{}, err
+		}
+		digest := sha256.Sum256(publicKey)
+		kid = hex.EncodeToString(digest[:8])
 	}
-	stdio.LogVerbose("", "RSA配置成功")
+	return RSAKeyItem{
+		Kid: kid,
+		Content: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})),
+		ExchangeKey: base64.StdEncoding.EncodeToString(exchangeKey.Bytes()),
+		CreateTime:  time.Now().Unix(),
+	}, nil
 }
@@ -0,0 +1,59 @@
+package unit
+
+// SqlDialect 屏蔽各数据库之间的 SQL 差异，管理器中的语句仅使用两者共有的语法，
+// 其余部分通过本接口拼接
+type SqlDialect interface {
+	Name() string
+	// RandomBelow 返回 [0, max) 范围内随机整数的表达式
+	RandomBelow(max string) string
+	// LikeEscape 返回 like 子句的转义声明，转义字符为反斜杠
+	LikeEscape() string
+	// TableExistsQuery 返回查询数据表是否存在的语句，参数为表名，结果为匹配数量
+	TableExistsQuery() string
+	// InsertIgnore 返回主键冲突时忽略写入的 insert 语句开头
+	InsertIgnore() string
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect mysqlDialect) RandomBelow(max string) string {
+	return "floor(rand() * " + max + ")"
+}
+
+func (mysqlDialect mysqlDialect) LikeEscape() string {
+	return ""
+}
+
+func (mysqlDialect mysqlDialect) TableExistsQuery() string {
+	return "select count(*) from information_schema.tables where table_schema=database() and table_name=?"
+}
+
+func (mysqlDialect mysqlDialect) InsertIgnore() string {
+	return "insert ignore into"
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect sqliteDialect) RandomBelow(max string) string {
+	return "(abs(random()) % " + max + ")"
+}
+
+func (sqliteDialect sqliteDialect) LikeEscape() string {
+	return " escape '\\'"
+}
+
+func (sqliteDialect sqliteDialect) TableExistsQuery() string {
+	return "select count(*) from sqlite_master where type='table' and name=?"
+}
+
+func (sqliteDialect sqliteDialect) InsertIgnore() string {
+	return "insert or ignore into"
+}
@@ -2,31 +2,69 @@ package unit
 
 import (
 	"SCITEduTool/Application/stdio"
+	"context"
 	"database/sql"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
 )
 
-var Maria *sql.DB
+var DB *sql.DB
 
+var Dialect SqlDialect = mysqlDialect{}
+
+// statements 以 SQL 语句为键缓存的预编译语句
+var statements sync.Map
+
+// ServerConfig 服务配置，TrustedProxies 为可信反向代理的 IP 或 CIDR，见 ClientIP
 type ServerConfig struct {
-	Debug bool      `json:"debug"`
-	Sql   SqlConfig `json:"sql"`
+	Debug          bool      `json:"debug"`
+	Sql            SqlConfig `json:"sql"`
+	TrustedProxies []string  `json:"trusted_proxies"`
 }
 
+// SqlConfig 数据库配置，Driver 为 mysql（默认）或 sqlite，使用 sqlite 时仅需填写 Path
 type SqlConfig struct {
+	Driver   string `json:"driver"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	IP       string `json:"ip"`
 	Port     string `json:"port"`
 	DBName   string `json:"db_name"`
+	Path     string `json:"path"`
 }
 
 func InitSQL(conf SqlConfig) {
 	var err error
+	switch conf.Driver {
+	case "", "mysql":
+		DB, err = openMySQL(conf)
+		Dialect = mysqlDialect{}
+	case "sqlite":
+		DB, err = openSQLite(conf)
+		Dialect = sqliteDialect{}
+	default:
+		stdio.LogAssert("", "不支持的数据库类型："+conf.Driver, nil)
+		os.Exit(0)
+	}
+	if err != nil {
+		stdio.LogAssert("", "数据库模块初始化失败", err)
+		os.Exit(0)
+	}
+	err = DB.Ping()
+	if err != nil {
+		stdio.LogAssert("", "数据库连接失败", err)
+		os.Exit(0)
+	}
+	stdio.LogVerbose("", "SQL配置成功："+Dialect.Name())
+}
+
+func openMySQL(conf SqlConfig) (*sql.DB, error) {
 	if strings.Contains(conf.Username, "//") ||
 		conf.Username == "" || conf.Password == "" {
 		stdio.LogAssert("", "用户名或密码为空或格式不正确", nil)
@@ -36,7 +74,7 @@ func InitSQL(conf SqlConfig) {
 		stdio.LogWarn("", "数据库IP为空或格式不正确，将使用默认值", nil)
 		conf.IP = "localhost"
 	}
-	_, err = strconv.Atoi(conf.Port)
+	_, err := strconv.Atoi(conf.Port)
 	if err != nil {
 		stdio.LogWarn("", "数据库端口为空或格式不正确，将使用默认值", nil)
 		conf.Port = "3306"
@@ -45,19 +83,53 @@ func InitSQL(conf SqlConfig) {
 		stdio.LogWarn("", "数据簿名称为空或格式不正确，将使用默认值", nil)
 		conf.DBName = "scit_edu_tool"
 	}
-	Maria, err = sql.Open("mysql", strings.Join([]string{
+	return sql.Open("mysql", strings.Join([]string{
 		conf.Username, ":", conf.Password,
 		"@tcp(", conf.IP, ":", conf.Port, ")/",
 		conf.DBName, "?charset=utf8",
 	}, ""))
+}
+
+// openSQLite 打开 SQLite 数据库文件，相对路径以运行目录为基准。
+// 事务以 IMMEDIATE 方式开始，写事务之间排队等待而非返回 SQLITE_BUSY
+func openSQLite(conf SqlConfig) (*sql.DB, error) {
+	if strings.Contains(conf.Path, "//") || conf.Path == "" {
+		stdio.LogWarn("", "数据库文件路径为空或格式不正确，将使用默认值", nil)
+		conf.Path = "scit_edu_tool.db"
+	}
+	if !filepath.IsAbs(conf.Path) {
+		baseDir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+		if err != nil {
+			return nil, err
+		}
+		conf.Path = filepath.Join(baseDir, conf.Path)
+	}
+	return sql.Open("sqlite3", "file:"+conf.Path+
+		"?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+}
+
+// Prepare 返回缓存在 DB 上的预编译语句，同一语句只编译一次，连接池会在各连接上按需重新编译。
+// 返回的语句由缓存持有，调用方不应关闭
+func Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if state, exist := statements.Load(query); exist {
+		return state.(*sql.Stmt), nil
+	}
+	state, err := DB.PrepareContext(ctx, query)
 	if err != nil {
-		stdio.LogAssert("", "数据库模块初始化失败", err)
-		os.Exit(0)
+		return nil, err
 	}
-	err = Maria.Ping()
+	if actual, loaded := statements.LoadOrStore(query, state); loaded {
+		_ = state.Close()
+		return actual.(*sql.Stmt), nil
+	}
+	return state, nil
+}
+
+// PrepareTx 返回绑定到事务 tx 的缓存语句，事务结束时自动关闭
+func PrepareTx(ctx context.Context, tx *sql.Tx, query string) (*sql.Stmt, error) {
+	state, err := Prepare(ctx, query)
 	if err != nil {
-		stdio.LogAssert("", "数据库连接失败", err)
-		os.Exit(0)
+		return nil, err
 	}
-	stdio.LogVerbose("", "SQL配置成功")
+	return tx.StmtContext(ctx, state), nil
 }
@@ -0,0 +1,138 @@
+package unit
+
+import (
+	"SCITEduTool/Application/stdio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// UpstreamConfig 上游请求配置，超时单位为秒，RetryBackoff 单位为毫秒。
+// ReadTimeout 为连接建立后等待并读取完整响应的最长时间，Retry 为 GET 请求失败后的最大重试次数
+type UpstreamConfig struct {
+	ConnectTimeout      int `json:"connect_timeout"`
+	ReadTimeout         int `json:"read_timeout"`
+	MaxIdleConns        int `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"`
+	Retry               int `json:"retry"`
+	RetryBackoff        int `json:"retry_backoff"`
+}
+
+var upstreamConfig = GetDefaultUpstreamConfig()
+
+// UpstreamClient 所有上游请求共用的客户端，不自动跟随跳转
+var UpstreamClient = newUpstreamClient(upstreamConfig)
+
+func GetDefaultUpstreamConfig() UpstreamConfig {
+	return UpstreamConfig{
+		ConnectTimeout:      5,
+		ReadTimeout:         15,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 16,
+		Retry:               2,
+		RetryBackoff:        200,
+	}
+}
+
+func InitUpstream(conf UpstreamConfig) {
+	defaultConf := GetDefaultUpstreamConfig()
+	if conf.ConnectTimeout <= 0 {
+		stdio.LogWarn("", "上游连接超时时间不正确，将使用默认值", nil)
+		conf.ConnectTimeout = defaultConf.ConnectTimeout
+	}
+	if conf.ReadTimeout <= 0 {
+		stdio.LogWarn("", "上游读取超时时间不正确，将使用默认值", nil)
+		conf.ReadTimeout = defaultConf.ReadTimeout
+	}
+	if conf.MaxIdleConns <= 0 {
+		conf.MaxIdleConns = defaultConf.MaxIdleConns
+	}
+	if conf.MaxIdleConnsPerHost <= 0 {
+		conf.MaxIdleConnsPerHost = defaultConf.MaxIdleConnsPerHost
+	}
+	if conf.Retry < 0 {
+		conf.Retry = 0
+	}
+	if conf.RetryBackoff <= 0 {
+		conf.RetryBackoff = defaultConf.RetryBackoff
+	}
+	upstreamConfig = conf
+	UpstreamClient = newUpstreamClient(conf)
+	stdio.LogVerbose("", "上游请求配置成功")
+}
+
+func newUpstreamClient(conf UpstreamConfig) *http.Client {
+	connectTimeout := time.Duration(conf.ConnectTimeout) * time.Second
+	readTimeout := time.Duration(conf.ReadTimeout) * time.Second
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   connectTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   connectTimeout,
+			ResponseHeaderTimeout: readTimeout,
+			MaxIdleConns:          conf.MaxIdleConns,
+			MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		Timeout: connectTimeout + readTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// DoUpstream 使用 UpstreamClient 发送请求，请求应由 http.NewRequestWithContext 创建。
+// 无请求体的 GET 请求在网络错误或上游返回 502、503、504 时按指数退避重试，context 结束后不再重试
+func DoUpstream(req *http.Request) (*http.Response, error) {
+	retry := 0
+	if req.Method == http.MethodGet && req.Body == nil {
+		retry = upstreamConfig.Retry
+	}
+	backoff := time.Duration(upstreamConfig.RetryBackoff) * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		resp, err := UpstreamClient.Do(req)
+		if attempt >= retry || req.Context().Err() != nil {
+			return resp, err
+		}
+		if err == nil {
+			if resp.StatusCode != http.StatusBadGateway && resp.StatusCode != http.StatusServiceUnavailable &&
+				resp.StatusCode != http.StatusGatewayTimeout {
+				return resp, nil
+			}
+			_ = resp.Body.Close()
+			stdio.LogDebug("", "上游返回 "+resp.Status+"，准备重试："+req.URL.String(), nil)
+		} else {
+			stdio.LogDebug("", "网络请求失败，准备重试："+req.URL.String(), err)
+		}
+		timer := time.NewTimer(backoff << uint(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// UpstreamErrorMessage 将上游请求错误记录日志并转换为接口错误信息，请求被取消时不视为上游故障
+func UpstreamErrorMessage(username string, err error) stdio.MessagedError {
+	var netError net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		stdio.LogDebug(username, "请求已取消", err)
+		return stdio.GetErrorMessage(-499, "请求已取消")
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netError) && netError.Timeout():
+		stdio.LogWarn(username, "网络请求超时", err)
+		return stdio.GetErrorMessage(-504, "请求超时")
+	default:
+		stdio.LogError(username, "网络请求失败", err)
+		return stdio.GetErrorMessage(-500, "请求处理出错")
+	}
+}
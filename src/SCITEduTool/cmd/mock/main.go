@@ -0,0 +1,28 @@
+// 模拟教务系统，仅用于离线调试，不随服务端一同构建。用法：go run ./cmd/mock [-addr 监听地址] [-fixtures 夹具目录]。
+// 将 edu.json 中的 base_url 与 cas_url 指向该地址即可离线调试全部接口
+package main
+
+import (
+	"SCITEduTool/Application/mock"
+	"SCITEduTool/Application/stdio"
+	"flag"
+	"net/http"
+	"os"
+)
+
+func main() {
+	mockAddr := flag.String("addr", ":18081", "模拟教务系统监听地址")
+	fixtures := flag.String("fixtures", "", "HTML 夹具目录，为空时使用内置夹具")
+	flag.Parse()
+	handler, err := mock.NewZhengFangHandler(*fixtures)
+	if err != nil {
+		stdio.LogAssert("", "模拟教务系统夹具读取失败", err)
+		os.Exit(0)
+	}
+	stdio.LogInfo("", "模拟教务系统已启动，base_url 为 http://localhost"+*mockAddr+"，cas_url 为 http://localhost"+*mockAddr+"/zfca")
+	err = http.ListenAndServe(*mockAddr, handler)
+	if err != nil {
+		stdio.LogAssert("", "模拟教务系统启动失败", err)
+		os.Exit(0)
+	}
+}
@@ -3,13 +3,28 @@ package main
 import (
 	"SCITEduTool/Application"
 	"SCITEduTool/Application/stdio"
+	"SCITEduTool/Application/unit"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"SCITEduTool/Application/api"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			startMigrate(os.Args[2:])
+			return
+		case "key":
+			startKey(os.Args[2:])
+			return
+		}
+	}
 	Application.Application.SetupWithConfig()
 	RegisterAPI()
 }
@@ -20,15 +35,25 @@ func RegisterAPI() {
 	registerApi("/getKey", api.GetKey)
 	registerApi("/login", api.Login)
 	registerApi("/token", api.Token)
+	registerApi("/token/sessions", api.TokenSessions)
 	registerApi("/springboard", api.Springboard)
 	registerApi("/info", api.Info)
 	registerApi("/table", api.Table)
+	registerApi("/table/ics", api.TableICS)
+	registerApi("/table/ics/link", api.TableICSLink)
+	registerApi("/subscription/revoke", api.SubscriptionRevoke)
 	registerApi("/achieve", api.Achieve)
+	registerApi("/achieve/stats", api.AchieveStats)
+	registerApi("/achieve/updates", api.AchieveUpdates)
 	registerApi("/achieve/extract/add", api.Extract)
 	registerApi("/achieve/extract/done", api.ExtractDone)
 	registerApi("/achieve/extract/download", api.ExtractDownload)
 	registerApi("/exam", api.Exam)
+	registerApi("/exam/ics", api.ExamICS)
+	registerApi("/exam/ics/link", api.ExamICSLink)
 	registerApi("/news", api.News)
+	registerApi("/news/feed/", api.NewsFeed)
+	registerApi("/scheduler/status", api.SchedulerStatus)
 	startService(addr)
 }
 
@@ -48,3 +73,146 @@ func startService(addr string) {
 		os.Exit(0)
 	}
 }
+
+// startMigrate 数据库迁移命令，用法：migrate status | up [-target 版本] [-dry-run] | down [-count 数量] [-dry-run]
+func startMigrate(args []string) {
+	if len(args) == 0 {
+		args = []string{"status"}
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	target := flags.Int("target", 0, "迁移至指定版本，0 为最新版本")
+	count := flags.Int("count", 1, "回滚的版本数量")
+	dryRun := flags.Bool("dry-run", false, "仅输出将要执行的 SQL 语句")
+	_ = flags.Parse(args[1:])
+
+	Application.Application.SetupDatabase()
+	var steps []unit.MigrationStep
+	var errMessage stdio.MessagedError
+	switch args[0] {
+	case "status":
+		var status []unit.MigrationStatus
+		status, errMessage = unit.MigrationUnit.Status()
+		if errMessage.HasInfo {
+			os.Exit(1)
+		}
+		for _, item := range status {
+			state := "未应用"
+			if item.Applied {
+				state = "已应用于 " + time.Unix(item.AppliedAt, 0).Format("2006-01-02 15:04:05")
+			}
+			if item.Unknown {
+				item.Name = "（未知版本）"
+			}
+			fmt.Printf("%04d_%s\t%s\n", item.Version, item.Name, state)
+		}
+		return
+	case "up":
+		steps, errMessage = unit.MigrationUnit.Up(*target, *dryRun)
+	case "down":
+		steps, errMessage = unit.MigrationUnit.Down(*count, *dryRun)
+	default:
+		fmt.Println("用法：migrate status | up [-target 版本] [-dry-run] | down [-count 数量] [-dry-run]")
+		os.Exit(1)
+	}
+	if *dryRun {
+		for _, step := range steps {
+			direction := "down"
+			if step.Up {
+				direction = "up"
+			}
+			fmt.Printf("-- %s (%s)\n", step.Title(), direction)
+			for _, statement := range step.Statements {
+				fmt.Println(statement + ";")
+			}
+		}
+	}
+	if errMessage.HasInfo {
+		os.Exit(1)
+	}
+	if len(steps) == 0 {
+		fmt.Println("没有需要执行的迁移")
+	}
+}
+
+// startKey RSA 密钥环管理命令，用法：key list | generate [-kid 密钥ID] [-bits 位数] [-activate=false] | activate -kid 密钥ID。
+// 修改后需重启服务生效，旧密钥需保留以解密已保存的密码
+func startKey(args []string) {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	flags := flag.NewFlagSet("key "+args[0], flag.ExitOnError)
+	kid := flags.String("kid", "", "密钥ID，生成时为空则根据公钥摘要生成")
+	bits := flags.Int("bits", 2048, "密钥位数，支持 2048 或 3072")
+	activate := flags.Bool("activate", true, "生成后立即启用新密钥")
+	_ = flags.Parse(args[1:])
+
+	keyConf, err := Application.Application.ReadKeyring()
+	if err != nil {
+		stdio.LogAssert("", "密钥配置读取失败", err)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "list":
+		if keyConf.Content != "" && !strings.Contains(keyConf.Content, "//") {
+			printKey(unit.LegacyKid, 0, keyConf.ActiveKid == "" || keyConf.ActiveKid == unit.LegacyKid)
+		}
+		for _, item := range keyConf.Keys {
+			printKey(item.Kid, item.CreateTime, item.Kid == keyConf.ActiveKid)
+		}
+		return
+	case "generate":
+		for _, item := range keyConf.Keys {
+			if item.Kid == *kid {
+				fmt.Println("密钥ID已存在：" + *kid)
+				os.Exit(1)
+			}
+		}
+		if *kid == unit.LegacyKid {
+			fmt.Println("密钥ID已被旧版私钥占用：" + *kid)
+			os.Exit(1)
+		}
+		item, err := unit.GenerateRSAKey(*kid, *bits)
+		if err != nil {
+			fmt.Println("密钥生成失败：" + err.Error())
+			os.Exit(1)
+		}
+		keyConf.Keys = append(keyConf.Keys, item)
+		if *activate {
+			keyConf.ActiveKid = item.Kid
+		}
+		fmt.Println("已生成密钥：" + item.Kid)
+	case "activate":
+		exist := *kid == unit.LegacyKid && keyConf.Content != "" && !strings.Contains(keyConf.Content, "//")
+		for _, item := range keyConf.Keys {
+			if item.Kid == *kid {
+				exist = true
+			}
+		}
+		if !exist {
+			fmt.Println("密钥不存在：" + *kid)
+			os.Exit(1)
+		}
+		keyConf.ActiveKid = *kid
+	default:
+		fmt.Println("用法：key list | generate [-kid 密钥ID] [-bits 位数] [-activate=false] | activate -kid 密钥ID")
+		os.Exit(1)
+	}
+	err = Application.Application.WriteKeyring(keyConf)
+	if err != nil {
+		stdio.LogAssert("", "密钥配置写入失败", err)
+		os.Exit(1)
+	}
+	fmt.Println("当前启用密钥：" + keyConf.ActiveKid + "，重启服务后生效")
+}
+
+func printKey(kid string, createTime int64, active bool) {
+	created := "旧版私钥"
+	if createTime > 0 {
+		created = time.Unix(createTime, 0).Format("2006-01-02 15:04:05")
+	}
+	state := ""
+	if active {
+		state = "\t（启用中）"
+	}
+	fmt.Printf("%s\t%s%s\n", kid, created, state)
+}